@@ -3,8 +3,12 @@ package main
 import (
 	"desktop-cleaner/internal/cli"
 	"desktop-cleaner/internal/cli/cli_util"
+	"desktop-cleaner/internal/cli/database"
 	"desktop-cleaner/internal/cli/fs"
 	"desktop-cleaner/internal/cli/git"
+	"desktop-cleaner/internal/cli/history"
+	"desktop-cleaner/internal/cli/tag"
+	"desktop-cleaner/internal/cli/trash"
 	"desktop-cleaner/internal/cli/workspace"
 	"desktop-cleaner/internal/db"
 	"desktop-cleaner/internal/deskfs"
@@ -57,7 +61,17 @@ func generatePalette(params *cli.CmdParams) []*cobra.Command {
 	versionUtil := cli.NewDesktopCleanerCMD(cli_util.NewVersion(params)).Root
 	upgradeUtil := cli.NewDesktopCleanerCMD(cli_util.NewUpgrade(params)).Root
 	organize := cli.NewDesktopCleanerCMD(fs.NewOrganize(params)).Root
+	undo := cli.NewDesktopCleanerCMD(fs.NewUndo(params)).Root
+	archive := cli.NewDesktopCleanerCMD(fs.NewArchive(params)).Root
 	workspace := cli.NewDesktopCleanerCMD(workspace.NewWorkspace(params)).Root
+	trash := cli.NewDesktopCleanerCMD(trash.NewTrash(params)).Root
+	database := cli.NewDesktopCleanerCMD(database.NewDatabase(params)).Root
+	history := cli.NewDesktopCleanerCMD(history.NewHistory(params)).Root
+	backup := cli.NewDesktopCleanerCMD(cli_util.NewBackup(params)).Root
+	restore := cli.NewDesktopCleanerCMD(cli_util.NewRestore(params)).Root
+	clear := cli.NewDesktopCleanerCMD(cli_util.NewClear(params)).Root
+	graph := cli.NewDesktopCleanerCMD(fs.NewGraph(params)).Root
+	tag := cli.NewDesktopCleanerCMD(tag.NewTag(params)).Root
 
 	// Add commands here
 	return []*cobra.Command{
@@ -66,6 +80,16 @@ func generatePalette(params *cli.CmdParams) []*cobra.Command {
 		versionUtil,
 		upgradeUtil,
 		organize,
+		undo,
+		archive,
 		workspace,
+		trash,
+		database,
+		history,
+		backup,
+		restore,
+		clear,
+		graph,
+		tag,
 	}
 }
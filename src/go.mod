@@ -18,6 +18,8 @@ require (
 	github.com/spf13/cobra v1.8.0
 	github.com/spf13/viper v1.19.0
 	github.com/stretchr/testify v1.9.0
+	github.com/tursodatabase/go-libsql v0.0.0-20241011135853-3effbb6dea5c
+	golang.org/x/sys v0.23.0
 	golang.org/x/term v0.22.0
 )
 
@@ -28,7 +30,6 @@ require (
 	github.com/libsql/sqlite-antlr4-parser v0.0.0-20240721121621-c0bdc870f11c // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
-	github.com/tursodatabase/go-libsql v0.0.0-20241011135853-3effbb6dea5c // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
@@ -70,7 +71,6 @@ require (
 	go.uber.org/multierr v1.9.0 // indirect
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
 	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sys v0.23.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
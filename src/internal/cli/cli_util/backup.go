@@ -1,3 +1,161 @@
 package cli_util
 
-// Tool to backup the databases, workspaces by id, all data, or the entire central database
\ No newline at end of file
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/db"
+	"desktop-cleaner/internal/deskfs"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Tool to backup the databases, workspaces by id, all data, or the entire central database
+
+type BackupCMD struct {
+	Backup *cobra.Command
+}
+
+func NewBackup(params *cli.CmdParams) *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the central and workspace databases",
+		Long: `Write consistent snapshots of the databases into a new timestamped backup directory, with a manifest of their checksums. The databases can be in use while they are backed up.
+
+	Scopes: all (the central database and every workspace), central (the central database only) or workspace (the workspace with --id, or the active workspace). After a backup, only the newest --keep backups are kept.
+
+	Example:
+
+	$ desktop-cleaner backup --scope workspace --id 1 --keep 10`,
+		Run: func(cmd *cobra.Command, args []string) {
+			scopeFlag, _ := cmd.Flags().GetString("scope")
+			id, _ := cmd.Flags().GetInt("id")
+			dir, _ := cmd.Flags().GetString("dir")
+			keep, _ := cmd.Flags().GetInt("keep")
+
+			scope, err := deskfs.ParseBackupScope(scopeFlag)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --scope: %v", err)
+			}
+			if scope == deskfs.BackupWorkspace {
+				id = params.WorkspaceID(id)
+			}
+
+			params.Term.ToggleSpinner(true, "Backing up databases...")
+			backup, err := params.DeskFS.WorkspaceManager.Backup(dir, scope, id)
+			params.Term.ToggleSpinner(false, "")
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error backing up: %v", err)
+			}
+			for _, warning := range backup.Warnings {
+				params.Term.OutputWarning(warning)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Backed up %d databases to %s", len(backup.Manifest.Entries), backup.Dir))
+
+			removed, err := deskfs.RotateBackups(dir, keep)
+			if err != nil {
+				params.Term.OutputWarning(fmt.Sprintf("Error rotating backups: %v", err))
+			}
+			for _, path := range removed {
+				params.Term.OutputInfo(fmt.Sprintf("Removed old backup %s", path))
+			}
+		},
+	}
+	backupCmd.PersistentFlags().String("dir", deskfs.DefaultBackupDir, "Directory holding the backups")
+	backupCmd.Flags().String("scope", string(deskfs.BackupAll), "What to back up: all, central or workspace")
+	backupCmd.Flags().Int("id", 0, "ID of the workspace to back up with --scope workspace, defaults to the active workspace")
+	backupCmd.Flags().Int("keep", 5, "Number of backups to keep, 0 to keep all")
+
+	// Subcommand: list
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the backups",
+		Long:  `List the backups of the backup directory, oldest first.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, _ := cmd.Flags().GetString("dir")
+
+			backups, err := deskfs.ListBackups(dir)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing backups: %v", err)
+			}
+			if len(backups) == 0 {
+				params.Term.OutputInfo("No backups found in %s", dir)
+				return
+			}
+			for _, backup := range backups {
+				params.Term.OutputInfo(fmt.Sprintf("%s  %s  scope: %s, databases: %d", backup.Dir,
+					backup.Manifest.CreatedAt.Format(time.DateTime), backup.Manifest.Scope, len(backup.Manifest.Entries)))
+			}
+		},
+	}
+
+	backupCmd.AddCommand(listCmd)
+	return backupCmd
+}
+
+func NewRestore(params *cli.CmdParams) *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:   "restore <backup>",
+		Short: "Restore databases from a backup",
+		Long: `Restore the databases of a backup directory created by ` + "`backup`" + `. Every snapshot is checked against the checksums of the manifest and for integrity before any database is replaced. Workspaces are restored to their root directory as recorded in the backup.
+
+	Use --central to only restore the central database, or --id to only restore a workspace.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			centralOnly, _ := cmd.Flags().GetBool("central")
+			id, _ := cmd.Flags().GetInt("id")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			if centralOnly && id > 0 {
+				params.Term.OutputErrorAndExit("Error: --central and --id cannot be combined")
+			}
+
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			backup, err := deskfs.ReadBackup(dir)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+
+			opts := deskfs.RestoreOptions{CentralOnly: centralOnly, WorkspaceID: id}
+			entries, err := backup.Select(opts)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+
+			params.Term.OutputInfo(fmt.Sprintf("Backup from %s:", backup.Manifest.CreatedAt.Format(time.DateTime)))
+			for _, entry := range entries {
+				if entry.Kind == deskfs.BackupEntryCentral {
+					params.Term.OutputInfo("  central database")
+					opts.CentralPath, err = db.CentralDBPath()
+					if err != nil {
+						params.Term.OutputErrorAndExit("Error: %v", err)
+					}
+				} else {
+					params.Term.OutputInfo(fmt.Sprintf("  workspace %d at %s", entry.WorkspaceID, entry.RootPath))
+				}
+			}
+			if !yes && !params.Term.ConfirmYesNo("Replace these databases with the backup?") {
+				params.Term.OutputInfo("Restore cancelled")
+				return
+			}
+
+			warnings, err := params.DeskFS.WorkspaceManager.RestoreBackup(backup, opts)
+			for _, warning := range warnings {
+				params.Term.OutputWarning(warning)
+			}
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error restoring backup: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Restored %d databases from %s", len(entries), dir))
+		},
+	}
+	restoreCmd.Flags().Bool("central", false, "Only restore the central database")
+	restoreCmd.Flags().Int("id", 0, "Only restore the workspace with this ID")
+	restoreCmd.Flags().BoolP("yes", "y", false, "Restore without asking for confirmation")
+
+	return restoreCmd
+}
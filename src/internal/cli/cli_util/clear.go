@@ -1,3 +1,79 @@
 package cli_util
 
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/deskfs"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
 // Tool to clear cache, workspace data by id, workspaces by id, all data, the entire central database, or all data and the central database.
+
+type ClearCMD struct {
+	Clear *cobra.Command
+}
+
+func NewClear(params *cli.CmdParams) *cobra.Command {
+	clearCmd := &cobra.Command{
+		Use:   "clear <scope>",
+		Short: "Clear cached and stored data",
+		Long: `Delete stored data by scope. Everything that would be deleted is listed first and must be confirmed, unless --yes is given.
+
+	Scopes:
+
+	cache      the contents of the cache directory, including the undo journals
+	data       the index, text cache and history of a workspace, which stays registered; its user tags are kept
+	workspace  a workspace: its registration and its database, including its user tags
+	all-data   the index, text cache and history of every workspace; user tags are kept
+	central    the central database, forgetting every workspace
+	all        every workspace, the cache and the central database
+
+	The data and workspace scopes act on the workspace with --id, or the active workspace. Config files in a workspace .desktop_cleaner directory are never deleted.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+			yes, _ := cmd.Flags().GetBool("yes")
+			dryRun, _ := cmd.Flags().GetBool("dryrun")
+
+			scope, err := deskfs.ParseClearScope(args[0])
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			if scope == deskfs.ClearData || scope == deskfs.ClearWorkspace {
+				id = params.WorkspaceID(id)
+			}
+
+			plan, err := params.DeskFS.PlanClear(scope, id)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			if len(plan.Items) == 0 {
+				params.Term.OutputInfo("Nothing to clear")
+				return
+			}
+
+			params.Term.OutputInfo("The following will be deleted:")
+			for _, item := range plan.Items {
+				params.Term.OutputInfo(fmt.Sprintf("  %s  (%s)", item.Path, item.Description))
+			}
+			if dryRun {
+				return
+			}
+			if !yes && !params.Term.ConfirmYesNo("Delete these permanently?") {
+				params.Term.OutputInfo("Clear cancelled")
+				return
+			}
+
+			if err := plan.Execute(); err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Cleared %s", scope))
+		},
+	}
+	clearCmd.Flags().Int("id", 0, "ID of the workspace for the data and workspace scopes, defaults to the active workspace")
+	clearCmd.Flags().BoolP("yes", "y", false, "Clear without asking for confirmation")
+	clearCmd.Flags().BoolP("dryrun", "n", false, "Only list what would be deleted")
+
+	return clearCmd
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/db"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type DatabaseCMD struct {
+	Database *cobra.Command
+}
+
+func NewDatabase(params *cli.CmdParams) *cobra.Command {
+	databaseCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the desktop-cleaner databases",
+		Long:  `Manage the central database and the databases of all workspaces.`,
+	}
+
+	// Subcommand: migrate
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations",
+		Long:  `Apply the pending schema migrations to the central database and to the database of every workspace. Use --status to list the migrations without applying them.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			status, _ := cmd.Flags().GetBool("status")
+
+			workspaces, err := params.DeskFS.WorkspaceManager.ListWorkspaces()
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing workspaces: %v", err)
+			}
+
+			if status {
+				statuses, err := params.CentralDB.MigrationStatus()
+				if err != nil {
+					params.Term.OutputErrorAndExit("Error reading central database migrations: %v", err)
+				}
+				printStatus(params, "Central database", statuses)
+
+				for _, ws := range workspaces {
+					statuses, err := db.WorkspaceMigrationStatus(ws.RootPath)
+					if err != nil {
+						params.Term.OutputWarning(fmt.Sprintf("Workspace %d (%s): %v", ws.ID, ws.RootPath, err))
+						continue
+					}
+					printStatus(params, fmt.Sprintf("Workspace %d (%s)", ws.ID, ws.RootPath), statuses)
+				}
+				return
+			}
+
+			// The central database is migrated when it is opened
+			params.Term.OutputSuccess("Central database is up to date")
+
+			failed := 0
+			for _, ws := range workspaces {
+				workspaceDB, err := params.CentralDB.OpenWorkspaceStore(ws.RootPath)
+				if err != nil {
+					params.Term.OutputWarning(fmt.Sprintf("Workspace %d (%s): %v", ws.ID, ws.RootPath, err))
+					failed++
+					continue
+				}
+				workspaceDB.Close()
+				params.Term.OutputSuccess(fmt.Sprintf("Workspace %d (%s) is up to date", ws.ID, ws.RootPath))
+			}
+
+			if failed > 0 {
+				params.Term.OutputErrorAndExit("Failed to migrate %d workspaces", failed)
+			}
+		},
+	}
+	migrateCmd.Flags().Bool("status", false, "List applied and pending migrations without applying them")
+
+	databaseCmd.AddCommand(migrateCmd)
+	return databaseCmd
+}
+
+func printStatus(params *cli.CmdParams, title string, statuses []db.MigrationStatus) {
+	params.Term.OutputSuccess(title + ":")
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			params.Term.OutputWarning(fmt.Sprintf("  %s  pending", status.Name))
+			continue
+		}
+		params.Term.OutputInfo(fmt.Sprintf("  %s  applied %s", status.Name, status.AppliedAt.Format(time.DateTime)))
+	}
+}
@@ -0,0 +1,105 @@
+package fs
+
+import (
+	"desktop-cleaner/internal/cli"
+	deskfs "desktop-cleaner/internal/deskfs"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+type ArchiveCMD struct {
+	Archive *cobra.Command
+}
+
+var archiveParams = &deskfs.ArchiveParams{}
+
+func NewArchive(params *cli.CmdParams) *cobra.Command {
+	var olderThan, largerThan, format, originals string
+
+	archiveCmd := &cobra.Command{
+		Use:     "archive",
+		Aliases: []string{"ar"},
+		Short:   "Archive old files into compressed bundles",
+		Long: `Collect the files matching an age and/or size predicate into a dated tar.gz or zip archive under the target folder. The archive is verified before the original files are moved to the trash (or removed, or kept).
+
+	Example:
+
+	$ desktop-cleaner archive --older-than 180d --target Archive --format zip`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			if olderThan != "" {
+				if archiveParams.OlderThan, err = deskfs.ParseAge(olderThan); err != nil {
+					params.Term.OutputErrorAndExit("Error parsing --older-than: %v", err)
+				}
+			}
+			if largerThan != "" {
+				if archiveParams.LargerThan, err = deskfs.ParseSize(largerThan); err != nil {
+					params.Term.OutputErrorAndExit("Error parsing --larger-than: %v", err)
+				}
+			}
+			if archiveParams.Format, err = deskfs.ParseArchiveFormat(format); err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --format: %v", err)
+			}
+			if archiveParams.Originals, err = deskfs.ParseOriginalsMode(originals); err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --originals: %v", err)
+			}
+			if archiveParams.OlderThan == 0 && archiveParams.LargerThan == 0 {
+				params.Term.OutputErrorAndExit("Error: --older-than or --larger-than is required")
+			}
+
+			archiveFiles(params)
+		},
+	}
+
+	archiveCmd.Flags().StringVar(&olderThan, "older-than", "", "Archive files last modified before this age, e.g. 90d")
+	archiveCmd.Flags().StringVar(&largerThan, "larger-than", "", "Archive files larger than this size, e.g. 100MB")
+	archiveCmd.Flags().StringSliceVarP(&archiveParams.Extensions, "ext", "e", nil, "Only archive files with these extensions")
+	archiveCmd.Flags().StringVarP(&format, "format", "f", string(deskfs.ArchiveTarGz), "Archive format: tar.gz or zip")
+	archiveCmd.Flags().StringVar(&originals, "originals", string(deskfs.OriginalsTrash), "What to do with archived files: trash, remove or keep")
+	archiveCmd.Flags().StringVar(&archiveParams.Name, "name", "archive", "Prefix of the archive file name")
+	archiveCmd.Flags().StringVarP(&archiveParams.SourceDir, "srcDir", "d", "", "Directory to archive files from")
+	archiveCmd.Flags().StringVarP(&archiveParams.TargetDir, "target", "t", "Archive", "Folder to write archives to, relative to the source directory")
+	archiveCmd.Flags().BoolVarP(&archiveParams.Recursive, "recursive", "r", false, "Recursively archive files")
+	archiveCmd.Flags().BoolVarP(&archiveParams.DryRun, "dryrun", "n", false, "Dry run to list the files that would be archived")
+
+	return archiveCmd
+}
+
+func archiveFiles(params *cli.CmdParams) {
+	if archiveParams.SourceDir == "" {
+		var err error
+		archiveParams.SourceDir, err = os.Getwd()
+		if err != nil {
+			params.Term.OutputErrorAndExit("Error getting current working directory: %v", err)
+		}
+	}
+
+	// Use the config of the workspace containing the source directory, which may not contain the current directory
+	if err := params.DeskFS.ActivateWorkspace(archiveParams.SourceDir); err != nil {
+		params.Term.OutputWarning(fmt.Sprintf("Ignoring workspace config: %v", err))
+	}
+
+	if !filepath.IsAbs(archiveParams.TargetDir) {
+		archiveParams.TargetDir = filepath.Join(archiveParams.SourceDir, archiveParams.TargetDir)
+	}
+
+	params.Term.ToggleSpinner(true, "Archiving files...")
+
+	archivePath, count, err := params.DeskFS.ArchiveOldFiles(params.DeskFS.InstanceConfig, archiveParams)
+	params.Term.ToggleSpinner(false, "")
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error archiving files: %v", err)
+	}
+
+	switch {
+	case count == 0:
+		params.Term.OutputInfo("No files matched, nothing to archive")
+	case archiveParams.DryRun:
+		params.Term.OutputInfo(fmt.Sprintf("Dry run: %d files would be archived", count))
+	default:
+		params.Term.OutputSuccess(fmt.Sprintf("Archived %d files into %s", count, archivePath))
+	}
+}
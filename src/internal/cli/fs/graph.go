@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"desktop-cleaner/internal/cli"
+	deskfs "desktop-cleaner/internal/deskfs"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type GraphCMD struct {
+	Graph *cobra.Command
+}
+
+func NewGraph(params *cli.CmdParams) *cobra.Command {
+	graphCmd := &cobra.Command{
+		Use:   "graph [dir]",
+		Short: "Export the relationship graph of a directory",
+		Long: `Export the relationships between the directories and files of a directory as a graph: "contains" and "parent" edges between directories and their contents, undirected "` + deskfs.TemporalRelationship + `" edges between nodes modified within the configured window of each other, and undirected edges between related files of a directory (` + strings.Join(deskfs.ContentRelationshipTypes, ", ") + `).
+
+	The directory defaults to the root of the active workspace, or the current directory. Graphs are written in Graphviz DOT, GraphML or JSON to stdout, or to the file given with --output.
+
+	Example:
+
+	$ desktop-cleaner graph ~/Desktop --type ` + deskfs.TemporalRelationship + ` --depth 2 | dot -Tsvg > clutter.svg`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			formatFlag, _ := cmd.Flags().GetString("format")
+			types, _ := cmd.Flags().GetStringSlice("type")
+			depth, _ := cmd.Flags().GetInt("depth")
+			output, _ := cmd.Flags().GetString("output")
+
+			format, err := deskfs.ParseGraphFormat(formatFlag)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --format: %v", err)
+			}
+			if depth < 0 {
+				params.Term.OutputErrorAndExit("Error: --depth cannot be negative")
+			}
+
+			dir := params.DeskFS.WorkspaceRoot
+			if len(args) > 0 {
+				dir = args[0]
+				// Use the config of the workspace containing the directory, which may not contain the current directory
+				if err := params.DeskFS.ActivateWorkspace(dir); err != nil {
+					params.Term.OutputWarning(fmt.Sprintf("Ignoring workspace config: %v", err))
+				}
+			}
+			if dir == "" {
+				dir = params.DeskFS.Cwd
+			}
+
+			graph, err := params.DeskFS.BuildGraph(dir, deskfs.GraphOptions{Types: types, MaxDepth: depth})
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error building graph: %v", err)
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					params.Term.OutputErrorAndExit("Error creating %s: %v", output, err)
+				}
+				defer file.Close()
+				w = file
+			}
+			if err := graph.Write(w, format); err != nil {
+				params.Term.OutputErrorAndExit("Error writing graph: %v", err)
+			}
+			if output != "" {
+				params.Term.OutputSuccess(fmt.Sprintf("Wrote %d nodes and %d edges to %s", len(graph.Nodes), len(graph.Edges), output))
+			}
+		},
+	}
+	graphCmd.Flags().StringP("format", "f", string(deskfs.GraphDOT), "Output format: dot, graphml or json")
+	graphCmd.Flags().StringSliceP("type", "t", nil, "Only export relationships of these types: contains, parent, "+deskfs.TemporalRelationship+", "+strings.Join(deskfs.ContentRelationshipTypes, ", "))
+	graphCmd.Flags().IntP("depth", "d", 0, "Maximum depth of the nodes below the directory, 0 for no limit")
+	graphCmd.Flags().StringP("output", "o", "", "File to write the graph to, defaults to stdout")
+
+	return graphCmd
+}
@@ -3,7 +3,9 @@ package fs
 import (
 	"desktop-cleaner/internal/cli"
 	deskfs "desktop-cleaner/internal/deskfs"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -38,6 +40,14 @@ func NewOrganize(params *cli.CmdParams) *cobra.Command {
 	organizeCmd.Flags().BoolVarP(&fileParams.CopyFiles, "copy", "c", false, "Enable move as Copy operation, required when moving files across partitions. If not enabled, will default to copy when move is not possible.")
 	organizeCmd.Flags().StringVarP(&fileParams.SourceDir, "srcDir", "d", "", "Destination directory to organize files from")
 	organizeCmd.Flags().StringVarP(&fileParams.TargetDir, "target", "t", "", "Target directory to organize files into")
+	organizeCmd.Flags().BoolVar(&fileParams.PruneEmpty, "prune-empty", false, "Remove directories emptied by the run")
+	organizeCmd.Flags().BoolVar(&fileParams.InspectArchives, "inspect-archives", false, "Route archives into a subfolder named after the category of their content")
+	organizeCmd.Flags().BoolVar(&fileParams.ExtractArchives, "extract", false, "Extract archives into a sibling folder and organize the extracted files")
+	organizeCmd.Flags().Int64Var(&fileParams.ExtractMaxSize, "extract-max-size", deskfs.DefaultExtractMaxSize, "Maximum uncompressed size in bytes of an extracted archive")
+	organizeCmd.Flags().IntVar(&fileParams.ExtractMaxEntries, "extract-max-entries", deskfs.DefaultExtractMaxEntries, "Maximum number of entries of an extracted archive")
+	organizeCmd.Flags().BoolVar(&fileParams.Incremental, "incremental", false, "Rescan only what changed since the last scan of the source workspace")
+	organizeCmd.Flags().BoolVar(&fileParams.KeepGroups, "keep-groups", false, "Keep related files together in the folder of the largest of them, e.g. photo.xmp with photo.jpg")
+	organizeCmd.Flags().StringSliceVar(&fileParams.GroupTypes, "group-types", nil, "Relationships forming the groups kept together: "+strings.Join(deskfs.ContentRelationshipTypes, ", ")+"; defaults to all")
 
 	return organizeCmd
 }
@@ -52,6 +62,17 @@ func organizeFiles(params *cli.CmdParams) error {
 		}
 	}
 
+	groupTypes, err := deskfs.ParseGroupTypes(fileParams.GroupTypes)
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error parsing --group-types: %v", err)
+	}
+	fileParams.GroupTypes = groupTypes
+
+	// Use the config of the workspace containing the source directory, which may not contain the current directory
+	if err := params.DeskFS.ActivateWorkspace(fileParams.SourceDir); err != nil {
+		params.Term.OutputWarning(fmt.Sprintf("Ignoring workspace config: %v", err))
+	}
+
 	if fileParams.TargetDir == "" {
 		fileParams.TargetDir = fileParams.SourceDir
 	}
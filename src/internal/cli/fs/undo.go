@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"desktop-cleaner/internal/cli"
+	deskfs "desktop-cleaner/internal/deskfs"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type UndoCMD struct {
+	Undo *cobra.Command
+}
+
+func NewUndo(params *cli.CmdParams) *cobra.Command {
+	undoCmd := &cobra.Command{
+		Use:   "undo [run-id]",
+		Short: "Undo an organize run",
+		Long: `Undo an organize run using its journal. Moved files are moved back, copies are removed, created directories are removed if still empty and pruned directories are recreated.
+
+	If no run ID is passed, the most recent run that has not been undone is reverted. Use --list to show the recorded runs.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			list, _ := cmd.Flags().GetBool("list")
+			if list {
+				listRuns(params)
+				return
+			}
+
+			var runID string
+			if len(args) > 0 {
+				runID = args[0]
+			}
+			undo(params, runID)
+		},
+	}
+	undoCmd.Flags().BoolP("list", "l", false, "List recorded runs")
+
+	return undoCmd
+}
+
+func listRuns(params *cli.CmdParams) {
+	journals, err := deskfs.ListJournals(params.DeskFS.InstanceConfig.CacheDir)
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error listing runs: %v", err)
+	}
+	if len(journals) == 0 {
+		params.Term.OutputInfo("No runs recorded")
+		return
+	}
+
+	params.Term.OutputSuccess("Runs:")
+	for _, journal := range journals {
+		status := "active"
+		if journal.UndoneAt != nil {
+			status = "undone"
+		}
+		params.Term.OutputInfo(fmt.Sprintf("Run: %s, Started: %s, Source: %s, Operations: %d, Status: %s",
+			journal.RunID, journal.StartedAt.Format(time.DateTime), journal.SourceDir, len(journal.Entries), status))
+	}
+}
+
+func undo(params *cli.CmdParams, runID string) {
+	journal, err := deskfs.FindJournal(params.DeskFS.InstanceConfig.CacheDir, runID)
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error finding run: %v", err)
+	}
+
+	params.Term.ToggleSpinner(true, fmt.Sprintf("Undoing run %s ...", journal.RunID))
+
+	warnings, err := params.DeskFS.UndoRun(journal)
+	params.Term.ToggleSpinner(false, "")
+	for _, warning := range warnings {
+		params.Term.OutputWarning(warning)
+	}
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error undoing run %s: %v", journal.RunID, err)
+	}
+
+	params.Term.OutputSuccess(fmt.Sprintf("Run %s undone", journal.RunID))
+}
@@ -0,0 +1,141 @@
+package history
+
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/db"
+	"desktop-cleaner/internal/deskfs"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type HistoryCMD struct {
+	History *cobra.Command
+}
+
+func NewHistory(params *cli.CmdParams) *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:     "history",
+		Aliases: []string{"hist"},
+		Short:   "Show the history of a workspace",
+		Long: `List the operations recorded in the history of a workspace: organize and archive runs, undos, trash operations, tag and config changes.
+
+	Filter by --type and by date with --since and --until, which accept a date (2006-01-02) or an age (e.g. 7d, 12h). Without --id, the active workspace is used.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+			eventType, _ := cmd.Flags().GetString("type")
+			since, _ := cmd.Flags().GetString("since")
+			until, _ := cmd.Flags().GetString("until")
+			limit, _ := cmd.Flags().GetInt("limit")
+
+			filter := db.HistoryFilter{Type: eventType, Limit: limit}
+			var err error
+			if filter.Since, err = parseTime(since); err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --since: %v", err)
+			}
+			if filter.Until, err = parseTime(until); err != nil {
+				params.Term.OutputErrorAndExit("Error parsing --until: %v", err)
+			}
+
+			store := openStore(params, id)
+			defer store.Close()
+
+			events, err := store.ListHistory(filter)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing history: %v", err)
+			}
+			if len(events) == 0 {
+				params.Term.OutputInfo("No history recorded")
+				return
+			}
+
+			for _, event := range events {
+				payload, err := deskfs.ParseHistoryPayload(event)
+				if err != nil {
+					params.Term.OutputWarning(err.Error())
+					continue
+				}
+				params.Term.OutputInfo(fmt.Sprintf("ID: %d, Type: %s, Time: %s, Run: %s, User: %s, %s",
+					event.ID, event.Type, event.CreatedAt.Format(time.DateTime), orNone(event.RunID), payload.User, orNone(payload.Summary())))
+			}
+		},
+	}
+	historyCmd.PersistentFlags().Int("id", 0, "ID of the workspace")
+	historyCmd.Flags().String("type", "", "Only show events of this type: organize, archive, undo, trash, tag or config")
+	historyCmd.Flags().String("since", "", "Only show events since this date or age")
+	historyCmd.Flags().String("until", "", "Only show events before this date or age")
+	historyCmd.Flags().Int("limit", 50, "Maximum number of events to show, 0 for all")
+
+	// Subcommand: show
+	showCmd := &cobra.Command{
+		Use:   "show <event-id>",
+		Short: "Show the details of a history event",
+		Long:  `Show the details of a history event, including the command line and the result of every file operation.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+
+			eventID, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: invalid event ID %s", args[0])
+			}
+
+			store := openStore(params, id)
+			defer store.Close()
+
+			event, err := store.GetHistoryEvent(eventID)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error finding event %d: %v", eventID, err)
+			}
+
+			payload, err := deskfs.ParseHistoryPayload(event)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			details, err := json.MarshalIndent(payload, "", "  ")
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error formatting event %d: %v", eventID, err)
+			}
+
+			params.Term.OutputSuccess(fmt.Sprintf("Event %d: %s at %s", event.ID, event.Type, event.CreatedAt.Format(time.DateTime)))
+			fmt.Println(string(details))
+		},
+	}
+
+	historyCmd.AddCommand(showCmd)
+	return historyCmd
+}
+
+// openStore opens the store of the workspace with the given ID, or of the active workspace.
+func openStore(params *cli.CmdParams, id int) db.WorkspaceStore {
+	store, _, err := params.DeskFS.WorkspaceManager.OpenWorkspaceDB(params.WorkspaceID(id))
+	if err != nil {
+		params.Term.OutputErrorAndExit("Error opening workspace: %v", err)
+	}
+	return store
+}
+
+// parseTime parses a date, or an age relative to now.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return date, nil
+	}
+	age, err := deskfs.ParseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (2006-01-02) or an age: %w", err)
+	}
+	return time.Now().Add(-age), nil
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -22,6 +22,8 @@ THE SOFTWARE.
 package cli
 
 import (
+	"fmt"
+
 	"github.com/ZanzyTHEbar/go-basetools/logger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -61,6 +63,9 @@ func NewRoot(params *CmdParams) *cobra.Command {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	params.DeskFS.InitConfig(cfgFile)
+	if err := params.DeskFS.ActivateWorkspace(params.DeskFS.Cwd); err != nil {
+		params.Term.OutputWarning(fmt.Sprintf("Ignoring workspace config: %v", err))
+	}
 
 	logger.InitLogger(&params.DeskFS.InstanceConfig.Config)
 
@@ -0,0 +1,145 @@
+package tag
+
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/deskfs"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type TagCMD struct {
+	Tag *cobra.Command
+}
+
+func NewTag(params *cli.CmdParams) *cobra.Command {
+	tagCmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Manage user tags",
+		Long: `Tag files and directories, and find them by their tags. Tags are stored in the workspace database and follow files when they are moved, including by organize.
+
+	With "xattr = true" in the [user_tags] section of the config, tags are also written to the user.xdg.tags extended attribute of the files, shared with file managers, and tags edited there are read back when the workspace is indexed.
+
+	Example:
+
+	$ desktop-cleaner tag add ~/Desktop/report.pdf work q3
+	$ desktop-cleaner tag find "work AND NOT archived"`,
+	}
+
+	// Subcommand: add
+	addCmd := &cobra.Command{
+		Use:   "add <path> <tag>...",
+		Short: "Add tags to a file or directory",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := params.DeskFS.AddUserTags(args[0], args[1:])
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error tagging %s: %v", args[0], err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("%s: %s", file.Path, strings.Join(file.Tags, ", ")))
+		},
+	}
+
+	// Subcommand: remove
+	removeCmd := &cobra.Command{
+		Use:   "remove <path> [tag]...",
+		Short: "Remove tags from a file or directory",
+		Long:  `Remove tags from a file or directory. Use --all to remove every tag.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			all, _ := cmd.Flags().GetBool("all")
+			if len(args) == 1 && !all {
+				params.Term.OutputErrorAndExit("Error: give the tags to remove, or --all")
+			}
+			if len(args) > 1 && all {
+				params.Term.OutputErrorAndExit("Error: --all cannot be combined with tags")
+			}
+
+			file, err := params.DeskFS.RemoveUserTags(args[0], args[1:])
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error untagging %s: %v", args[0], err)
+			}
+			if len(file.Tags) == 0 {
+				params.Term.OutputSuccess(fmt.Sprintf("%s has no tags", file.Path))
+				return
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("%s: %s", file.Path, strings.Join(file.Tags, ", ")))
+		},
+	}
+	removeCmd.Flags().Bool("all", false, "Remove every tag")
+
+	// Subcommand: list
+	listCmd := &cobra.Command{
+		Use:   "list [path]",
+		Short: "List the tags of a file, or of the tagged files of a directory",
+		Long:  `List the tags of a file or, for a directory, of the directory and the tagged files below it. The path defaults to the root of the active workspace, or the current directory.`,
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := defaultDir(params)
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			files, err := params.DeskFS.UserTags(path)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing tags: %v", err)
+			}
+			if len(files) == 0 {
+				params.Term.OutputInfo("No tags")
+				return
+			}
+			for _, file := range files {
+				params.Term.OutputInfo(fmt.Sprintf("%s: %s", file.Path, strings.Join(file.Tags, ", ")))
+			}
+		},
+	}
+
+	// Subcommand: find
+	findCmd := &cobra.Command{
+		Use:   "find <tag-expr>",
+		Short: "Find files by their tags",
+		Long: `Find the files of a workspace whose tags match an expression of tags combined with AND, OR, NOT and parentheses, e.g. "work AND NOT archived" or "(invoice OR receipt) AND 2024". NOT binds tighter than AND, which binds tighter than OR.
+
+	Use --generated to match the tags generated when indexing the workspace as well, e.g. "work AND image".`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, _ := cmd.Flags().GetString("dir")
+			generated, _ := cmd.Flags().GetBool("generated")
+			if dir == "" {
+				dir = defaultDir(params)
+			}
+
+			// Unquoted expressions arrive as several arguments
+			expr, err := deskfs.ParseTagExpr(strings.Join(args, " "))
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error parsing tag expression: %v", err)
+			}
+
+			files, err := params.DeskFS.FindUserTagged(dir, expr, generated)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error finding tagged files: %v", err)
+			}
+			if len(files) == 0 {
+				params.Term.OutputInfo(fmt.Sprintf("No files match %s", expr))
+				return
+			}
+			for _, file := range files {
+				params.Term.OutputInfo(fmt.Sprintf("%s: %s", file.Path, strings.Join(file.Tags, ", ")))
+			}
+		},
+	}
+	findCmd.Flags().StringP("dir", "d", "", "Directory inside the workspace to search, defaults to the active workspace")
+	findCmd.Flags().BoolP("generated", "g", false, "Also match the tags generated by the indexer")
+
+	// Add subcommands to the tag command
+	tagCmd.AddCommand(addCmd, removeCmd, listCmd, findCmd)
+	return tagCmd
+}
+
+func defaultDir(params *cli.CmdParams) string {
+	if params.DeskFS.WorkspaceRoot != "" {
+		return params.DeskFS.WorkspaceRoot
+	}
+	return params.DeskFS.Cwd
+}
@@ -0,0 +1,169 @@
+package trash
+
+import (
+	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/deskfs"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type TrashCMD struct {
+	Trash *cobra.Command
+}
+
+func NewTrash(params *cli.CmdParams) *cobra.Command {
+	trashCmd := &cobra.Command{
+		Use:     "trash",
+		Aliases: []string{"tr"},
+		Short:   "Manage trashed files",
+		Long:    `List, restore and permanently delete files that were moved to the trash.`,
+	}
+
+	// Subcommand: list
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List trashed files",
+		Long:  `List trashed files with their ID, original path, size and deletion date.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := deskfs.ListTrash()
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing trash: %v", err)
+			}
+			if len(entries) == 0 {
+				params.Term.OutputInfo("Trash is empty")
+				return
+			}
+			params.Term.OutputSuccess("Trashed files:")
+			for _, entry := range entries {
+				params.Term.OutputInfo(fmt.Sprintf("ID: %s, Original Path: %s, Size: %s, Deleted: %s",
+					entry.ID(), entry.OriginalPath, deskfs.FormatSize(entry.Size), entry.DeletionDate.Format(time.DateTime)))
+			}
+		},
+	}
+
+	// Subcommand: restore
+	restoreCmd := &cobra.Command{
+		Use:   "restore <id|glob>",
+		Short: "Restore trashed files",
+		Long:  `Restore trashed files to their original location. The argument is matched against the trash ID, and as a glob against the ID, the name and the original path.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			conflict, _ := cmd.Flags().GetString("conflict")
+
+			entries, err := deskfs.ListTrash()
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing trash: %v", err)
+			}
+
+			matches := matchEntries(entries, args[0])
+			if len(matches) == 0 {
+				params.Term.OutputErrorAndExit("Error: no trashed files match %s", args[0])
+			}
+
+			payload := deskfs.NewHistoryPayload("")
+
+			for _, entry := range matches {
+				restored, err := params.DeskFS.RestoreTrashEntry(entry, deskfs.ConflictResolutionType(conflict))
+				if err != nil {
+					payload.AddResult("restore", entry.FilesPath(), entry.OriginalPath, err)
+					params.DeskFS.RecordHistory(entry.OriginalPath, deskfs.EventTrash, payload)
+					params.Term.OutputErrorAndExit("Error restoring %s: %v", entry.ID(), err)
+				}
+				if restored == "" {
+					payload.AddResult("skip", entry.FilesPath(), entry.OriginalPath, nil)
+					params.Term.OutputWarning(fmt.Sprintf("Skipped %s: %s already exists", entry.ID(), entry.OriginalPath))
+					continue
+				}
+				payload.AddResult("restore", entry.FilesPath(), restored, nil)
+				params.Term.OutputSuccess(fmt.Sprintf("Restored %s to %s", entry.ID(), restored))
+			}
+			params.DeskFS.RecordHistory(matches[0].OriginalPath, deskfs.EventTrash, payload)
+		},
+	}
+	restoreCmd.Flags().String("conflict", string(deskfs.RenameSuffix), "Conflict resolution when the original path exists: overwrite, skip or rename")
+
+	// Subcommand: empty
+	emptyCmd := &cobra.Command{
+		Use:   "empty",
+		Short: "Permanently delete trashed files",
+		Long:  `Permanently delete the files trashed by desktop-cleaner. Use --older-than (e.g. 30d, 2w, 12h) to only delete files trashed before that age, and --all to also delete the files trashed by other applications.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			olderThan, _ := cmd.Flags().GetString("older-than")
+			yes, _ := cmd.Flags().GetBool("yes")
+			all, _ := cmd.Flags().GetBool("all")
+
+			var age time.Duration
+			if olderThan != "" {
+				var err error
+				age, err = deskfs.ParseAge(olderThan)
+				if err != nil {
+					params.Term.OutputErrorAndExit("Error parsing --older-than: %v", err)
+				}
+			}
+
+			if !yes {
+				scope := "files trashed by desktop-cleaner"
+				if all {
+					scope = "trashed files, including those trashed by other applications"
+				}
+				prompt := fmt.Sprintf("Permanently delete all %s?", scope)
+				if olderThan != "" {
+					prompt = fmt.Sprintf("Permanently delete %s older than %s?", scope, olderThan)
+				}
+				if !params.Term.ConfirmYesNo(prompt) {
+					return
+				}
+			}
+
+			purged, err := deskfs.EmptyTrash(age, all)
+			payload := deskfs.NewHistoryPayload("")
+			for _, entry := range purged {
+				payload.AddResult("purge", entry.OriginalPath, "", nil)
+			}
+			if err != nil {
+				payload.Error = err.Error()
+			}
+			params.DeskFS.RecordHistory(params.DeskFS.Cwd, deskfs.EventTrash, payload)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error emptying trash: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Permanently deleted %d trashed files", len(purged)))
+		},
+	}
+	emptyCmd.Flags().String("older-than", "", "Only delete files trashed longer ago than this age")
+	emptyCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	emptyCmd.Flags().Bool("all", false, "Also delete files trashed by other applications")
+
+	// Add subcommands to the trash command
+	trashCmd.AddCommand(listCmd, restoreCmd, emptyCmd)
+	return trashCmd
+}
+
+// matchEntries returns the entry whose ID equals pattern, or else the entries whose ID, name or original
+// path match it as a glob.
+func matchEntries(entries []*deskfs.TrashEntry, pattern string) []*deskfs.TrashEntry {
+	for _, entry := range entries {
+		if entry.ID() == pattern {
+			return []*deskfs.TrashEntry{entry}
+		}
+	}
+
+	var matches []*deskfs.TrashEntry
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(pattern, entry.ID()); ok {
+			matches = append(matches, entry)
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, entry.Name); ok {
+			matches = append(matches, entry)
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, entry.OriginalPath); ok {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
@@ -12,7 +12,21 @@ type CmdParams struct {
 	Term      *terminal.Terminal
 	DeskFS    *deskfs.DesktopFS
 	Palette   []*cobra.Command
-	CentralDB *db.CentralDBProvider
+	CentralDB db.CentralStore
+}
+
+// WorkspaceID returns id when set, or the ID of the active workspace: the workspace containing the current
+// directory or, outside of any workspace, the pinned workspace. It exits when there is none.
+func (params *CmdParams) WorkspaceID(id int) int {
+	if id > 0 {
+		return id
+	}
+	if params.DeskFS.WorkspaceID > 0 {
+		return params.DeskFS.WorkspaceID
+	}
+
+	params.Term.OutputErrorAndExit("Error: not inside a workspace and no workspace pinned, pass --id or run `workspace use <id>`")
+	return 0
 }
 
 type DesktopCleanerCMD struct {
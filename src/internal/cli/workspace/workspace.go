@@ -2,8 +2,13 @@ package workspace
 
 import (
 	"desktop-cleaner/internal/cli"
+	"desktop-cleaner/internal/db"
+	"desktop-cleaner/internal/deskfs"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -17,7 +22,9 @@ func NewWorkspace(params *cli.CmdParams) *cobra.Command {
 		Use:     "workspace",
 		Aliases: []string{"ws"},
 		Short:   "Manage workspaces",
-		Long:    `Manage workspaces including creating, updating, and deleting workspaces.`,
+		Long: `Manage workspaces including creating, updating, and deleting workspaces.
+
+	Commands act on the active workspace unless --id is given: the workspace containing the current directory or, outside of any workspace, the workspace pinned with ` + "`workspace use`" + `. The config stored with the active workspace is applied on top of the config file.`,
 	}
 
 	// Subcommand: create
@@ -52,23 +59,28 @@ func NewWorkspace(params *cli.CmdParams) *cobra.Command {
 	updateCmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update an existing workspace",
-		Long:  `Update the configuration for an existing workspace by ID.`,
+		Long:  `Update the configuration for an existing workspace by ID, or the active workspace. The configuration is TOML with the same file_types, rules, cache_dir and trash settings as the config file.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			id, _ := cmd.Flags().GetInt("id")
 			config, _ := cmd.Flags().GetString("config")
+			id = params.WorkspaceID(id)
 
-			if id <= 0 {
-				params.Term.OutputErrorAndExit("Error: valid workspace ID is required")
+			if _, err := deskfs.ParseWorkspaceConfig(config); err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
 			}
 
 			err := params.DeskFS.WorkspaceManager.UpdateWorkspace(id, config)
 			if err != nil {
 				params.Term.OutputErrorAndExit("Error updating workspace: %v", err)
 			}
+
+			payload := deskfs.NewHistoryPayload("")
+			payload.Details = map[string]string{"config": config}
+			params.DeskFS.RecordWorkspaceHistory(id, deskfs.EventConfig, payload)
 			params.Term.OutputSuccess(fmt.Sprintf("Workspace with ID %d updated successfully", id))
 		},
 	}
-	updateCmd.Flags().Int("id", 0, "ID of the workspace to update (required)")
+	updateCmd.Flags().Int("id", 0, "ID of the workspace to update, defaults to the active workspace")
 	updateCmd.Flags().String("config", "", "New configuration data for the workspace")
 
 	listCmd := &cobra.Command{
@@ -91,24 +103,269 @@ func NewWorkspace(params *cli.CmdParams) *cobra.Command {
 	deleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Delete a workspace",
-		Long:  `Delete an existing workspace by its ID.`,
+		Long:  `Delete an existing workspace by its ID, or the active workspace: its registration and its database. The workspace to delete must be confirmed, unless --yes is given.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			id, _ := cmd.Flags().GetInt("id")
+			yes, _ := cmd.Flags().GetBool("yes")
+			id = params.WorkspaceID(id)
 
-			if id <= 0 {
-				params.Term.OutputErrorAndExit("Error: valid workspace ID is required")
+			ws, err := params.DeskFS.WorkspaceManager.GetWorkspace(id)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error getting workspace: %v", err)
+			}
+			if !yes && !params.Term.ConfirmYesNo(fmt.Sprintf("Delete workspace %d at %s and its database?", id, ws.RootPath)) {
+				params.Term.OutputInfo("Delete cancelled")
+				return
 			}
 
-			err := params.DeskFS.WorkspaceManager.DeleteWorkspace(id)
+			err = params.DeskFS.WorkspaceManager.DeleteWorkspace(id)
 			if err != nil {
 				params.Term.OutputErrorAndExit("Error deleting workspace: %v", err)
 			}
 			params.Term.OutputSuccess(fmt.Sprintf("Workspace with ID %d deleted successfully", id))
 		},
 	}
-	deleteCmd.Flags().Int("id", 0, "ID of the workspace to delete (required)")
+	deleteCmd.Flags().Int("id", 0, "ID of the workspace to delete, defaults to the active workspace")
+	deleteCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+
+	// Subcommand: index
+	indexCmd := &cobra.Command{
+		Use:   "index",
+		Short: "Index the files of a workspace",
+		Long: `Scan a workspace and store every file with its size, modification time, hash, MIME type, tags and metadata in the workspace database. Records of files that no longer exist are removed. Without --id, the active workspace is indexed.
+
+Rescans are incremental: directories whose modification time has not changed are not re-read, files are only re-hashed when their size or modification time changed, and renamed files are recognized by their inode. Use --full to re-read everything.
+
+With --text, the plain text of text, Markdown, HTML, PDF and Office files is extracted and cached in the workspace database by the hash of their content, so that unchanged contents are only read once.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+			full, _ := cmd.Flags().GetBool("full")
+			text, _ := cmd.Flags().GetBool("text")
+			id = params.WorkspaceID(id)
+
+			workspaceDB, rootPath, err := params.DeskFS.WorkspaceManager.OpenWorkspaceDB(id)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error opening workspace: %v", err)
+			}
+			defer workspaceDB.Close()
+
+			params.Term.ToggleSpinner(true, fmt.Sprintf("Indexing %s", rootPath))
+			stats, err := params.DeskFS.IndexWorkspace(rootPath, workspaceDB, full)
+			params.Term.ToggleSpinner(false, "")
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error indexing workspace: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Indexed %d files: %d hashed, %d renamed, %d removed, %d directories unchanged",
+				stats.Indexed, stats.Hashed, stats.Renamed, stats.Removed, stats.SkippedDirs))
+
+			if !text {
+				return
+			}
+			params.Term.ToggleSpinner(true, "Extracting text")
+			textStats, err := params.DeskFS.ExtractWorkspaceText(workspaceDB)
+			params.Term.ToggleSpinner(false, "")
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error extracting text: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Extracted the text of %d files: %d already cached, %d unsupported, %d failed",
+				textStats.Extracted, textStats.Cached, textStats.Unsupported, textStats.Failed))
+			if textStats.Failed > 0 {
+				params.Term.OutputWarning("Some files could not be read, see the log for details")
+			}
+		},
+	}
+	indexCmd.Flags().Int("id", 0, "ID of the workspace to index")
+	indexCmd.Flags().Bool("full", false, "Re-read every directory and re-hash every file")
+	indexCmd.Flags().Bool("text", false, "Extract and cache the text of documents")
+
+	// Subcommand: files
+	filesCmd := &cobra.Command{
+		Use:   "files",
+		Short: "List the indexed files of a workspace",
+		Long:  `List the files stored in the workspace database by the last index run, without scanning the disk.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+			id = params.WorkspaceID(id)
+
+			workspaceDB, _, err := params.DeskFS.WorkspaceManager.OpenWorkspaceDB(id)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error opening workspace: %v", err)
+			}
+			defer workspaceDB.Close()
+
+			records, err := workspaceDB.ListFiles()
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error listing indexed files: %v", err)
+			}
+			if len(records) == 0 {
+				params.Term.OutputInfo("No indexed files, run `workspace index` first")
+				return
+			}
+			for _, record := range records {
+				params.Term.OutputInfo(fmt.Sprintf("%s  %s  %s  %s", record.Path, deskfs.FormatSize(record.Size), record.MimeType, strings.Join(record.Tags, ",")))
+			}
+		},
+	}
+	filesCmd.Flags().Int("id", 0, "ID of the workspace")
+
+	// Subcommand: show
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the active workspace",
+		Long:  `Show the ID, root path and configuration of the active workspace, or of the workspace with the given ID, and how it was resolved.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+
+			resolvedFrom := "--id"
+			if id <= 0 {
+				id = params.WorkspaceID(id)
+				resolvedFrom = "pinned"
+				if cwdID, _, err := params.DeskFS.WorkspaceManager.FindWorkspaceForPath(params.DeskFS.Cwd); err == nil && cwdID == id {
+					resolvedFrom = "current directory"
+				}
+			}
+
+			workspace, err := params.DeskFS.WorkspaceManager.GetWorkspace(id)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			pinnedID, err := params.DeskFS.WorkspaceManager.PinnedWorkspace()
+			if err != nil {
+				params.Term.OutputWarning(err.Error())
+			}
+
+			params.Term.OutputSuccess(fmt.Sprintf("Workspace %d", workspace.ID))
+			params.Term.OutputInfo(fmt.Sprintf("Root Path: %s", workspace.RootPath))
+			params.Term.OutputInfo(fmt.Sprintf("Resolved From: %s", resolvedFrom))
+			params.Term.OutputInfo(fmt.Sprintf("Pinned: %t", pinnedID == workspace.ID))
+
+			if workspaceDB, _, err := params.DeskFS.WorkspaceManager.OpenWorkspaceDB(id); err != nil {
+				params.Term.OutputWarning(fmt.Sprintf("Error opening workspace: %v", err))
+			} else {
+				defer workspaceDB.Close()
+				if records, err := workspaceDB.ListFiles(); err == nil {
+					params.Term.OutputInfo(fmt.Sprintf("Indexed Files: %d", len(records)))
+				}
+				if events, err := workspaceDB.ListHistory(db.HistoryFilter{Limit: 1}); err == nil && len(events) > 0 {
+					params.Term.OutputInfo(fmt.Sprintf("Last Event: %s at %s", events[0].Type, events[0].CreatedAt.Format(time.DateTime)))
+				}
+			}
+
+			if strings.TrimSpace(workspace.Config) == "" {
+				params.Term.OutputInfo("Config: none, using the config file")
+				return
+			}
+			if _, err := deskfs.ParseWorkspaceConfig(workspace.Config); err != nil {
+				params.Term.OutputWarning(fmt.Sprintf("Config is invalid and ignored: %v", err))
+			}
+			params.Term.OutputInfo("Config:")
+			fmt.Println(workspace.Config)
+		},
+	}
+	showCmd.Flags().Int("id", 0, "ID of the workspace to show, defaults to the active workspace")
+
+	// Subcommand: use
+	useCmd := &cobra.Command{
+		Use:   "use [id]",
+		Short: "Pin the active workspace",
+		Long:  `Pin a workspace, by ID or the workspace containing the current directory, as the active workspace when running commands outside of any workspace. Use --clear to unpin it.`,
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			unpin, _ := cmd.Flags().GetBool("clear")
+
+			if unpin {
+				if err := params.DeskFS.WorkspaceManager.UnpinWorkspace(); err != nil {
+					params.Term.OutputErrorAndExit("Error: %v", err)
+				}
+				params.Term.OutputSuccess("Workspace unpinned")
+				return
+			}
+
+			var id int
+			if len(args) == 1 {
+				var err error
+				if id, err = strconv.Atoi(args[0]); err != nil || id <= 0 {
+					params.Term.OutputErrorAndExit("Error: invalid workspace ID %s", args[0])
+				}
+			} else {
+				var err error
+				if id, _, err = params.DeskFS.WorkspaceManager.FindWorkspaceForPath(params.DeskFS.Cwd); err != nil {
+					params.Term.OutputErrorAndExit("Error: workspace ID is required: %v", err)
+				}
+			}
+
+			if err := params.DeskFS.WorkspaceManager.PinWorkspace(id); err != nil {
+				params.Term.OutputErrorAndExit("Error: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Workspace with ID %d pinned", id))
+		},
+	}
+	useCmd.Flags().Bool("clear", false, "Unpin the pinned workspace")
+
+	// Subcommand: export
+	exportCmd := &cobra.Command{
+		Use:   "export [id]",
+		Short: "Export a workspace as a portable bundle",
+		Long: `Export a workspace, by ID or the active workspace, as a tar.gz bundle containing its configuration, its file index with tags, its history, its user tags and its .desktop-cleaner-ignore files. Import the bundle on another machine with ` + "`workspace import`" + `.
+
+	Example:
+
+	$ desktop-cleaner workspace export 1 -o ws.tar.gz`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+
+			var id int
+			if len(args) == 1 {
+				var err error
+				if id, err = strconv.Atoi(args[0]); err != nil || id <= 0 {
+					params.Term.OutputErrorAndExit("Error: invalid workspace ID %s", args[0])
+				}
+			}
+			id = params.WorkspaceID(id)
+
+			if output == "" {
+				output = fmt.Sprintf("workspace-%d.tar.gz", id)
+			}
+
+			manifest, err := params.DeskFS.WorkspaceManager.ExportWorkspace(id, output)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error exporting workspace: %v", err)
+			}
+			params.Term.OutputSuccess(fmt.Sprintf("Workspace with ID %d exported to %s: %s", id, output, manifest.Summary()))
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "Path of the bundle, defaults to workspace-<id>.tar.gz")
+
+	// Subcommand: import
+	importCmd := &cobra.Command{
+		Use:   "import <bundle>",
+		Short: "Import a workspace from a bundle",
+		Long:  `Register the workspace of a bundle created by ` + "`workspace export`" + ` at a new root path. The paths stored in its index, history and user tags are rewritten to the new root path, and its ignore files are restored unless they already exist. IF root-path is not provided, the current working directory is used.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			rootPath, _ := cmd.Flags().GetString("root-path")
+			if rootPath == "" {
+				rootPath = params.DeskFS.Cwd
+			}
+
+			result, err := params.DeskFS.WorkspaceManager.ImportWorkspace(args[0], rootPath)
+			if err != nil {
+				params.Term.OutputErrorAndExit("Error importing workspace: %v", err)
+			}
+			for _, warning := range result.Warnings {
+				params.Term.OutputWarning(warning)
+			}
+
+			payload := deskfs.NewHistoryPayload("")
+			payload.Details = map[string]string{"imported_from": result.Manifest.RootPath, "bundle": args[0]}
+			params.DeskFS.RecordWorkspaceHistory(result.WorkspaceID, deskfs.EventConfig, payload)
+			params.Term.OutputSuccess(fmt.Sprintf("Workspace imported at %s with ID %d: %s", result.RootPath, result.WorkspaceID, result.Manifest.Summary()))
+		},
+	}
+	importCmd.Flags().String("root-path", "", "Root path for the imported workspace")
 
 	// Add subcommands to the workspace command
-	workspaceCmd.AddCommand(createCmd, updateCmd, deleteCmd, listCmd)
+	workspaceCmd.AddCommand(createCmd, updateCmd, deleteCmd, listCmd, indexCmd, filesCmd, showCmd, useCmd, exportCmd, importCmd)
 	return workspaceCmd
 }
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errBackupUnsupported is returned by stores that have no database file to snapshot.
+var errBackupUnsupported = errors.New("backups are not supported by the in-memory store")
+
+// Backup writes a consistent snapshot of the central database to destPath, safe while the database is in use.
+func (c *CentralDBProvider) Backup(destPath string) error {
+	return snapshot(c.db, destPath)
+}
+
+// Backup writes a consistent snapshot of the workspace database to destPath, safe while the database is in use.
+func (w *WorkspaceDB) Backup(destPath string) error {
+	return snapshot(w.db, destPath)
+}
+
+// snapshot copies a live database with VACUUM INTO, which reads it in a single transaction rather than
+// copying a file that may be in the middle of a write.
+func snapshot(db *sql.DB, destPath string) error {
+	// VACUUM INTO refuses to write to an existing file
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("snapshot %s already exists", destPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("could not create snapshot directory: %v", err)
+	}
+
+	if _, err := db.Exec("VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
+
+// CheckIntegrity runs the SQLite integrity check on the database file at path.
+func CheckIntegrity(path string) error {
+	// ConnectToDB creates missing databases
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	conn, err := ConnectToDB(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check of %s failed: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RestoreDatabase replaces the database at destPath with the snapshot at srcPath. The snapshot is copied
+// next to destPath and checked before atomically replacing it. The database must not be open.
+func RestoreDatabase(srcPath, destPath string) error {
+	tmpPath := destPath + ".restore"
+	if err := copyFile(srcPath, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+	if err := CheckIntegrity(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %w", destPath, err)
+	}
+
+	// A journal left over from the replaced database would be applied to the restored one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(destPath + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", destPath+suffix, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	if _, err := io.Copy(dest, src); err != nil {
+		return err
+	}
+	return dest.Sync()
+}
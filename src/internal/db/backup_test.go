@@ -0,0 +1,56 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupAndRestoreDatabase(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "backup", "workspace.db")
+
+	workspaceDB, err := NewWorkspaceDB(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, workspaceDB.UpsertFiles([]FileRecord{{Path: "/tmp/a.txt"}}))
+
+	assert.NoError(t, workspaceDB.Backup(snapshotPath))
+	assert.Error(t, workspaceDB.Backup(snapshotPath), "Expected existing snapshots to be kept")
+	assert.NoError(t, CheckIntegrity(snapshotPath))
+
+	// Changes after the snapshot are undone by the restore
+	assert.NoError(t, workspaceDB.UpsertFiles([]FileRecord{{Path: "/tmp/b.txt"}}))
+	assert.NoError(t, workspaceDB.Close())
+
+	assert.NoError(t, RestoreDatabase(snapshotPath, filepath.Join(dir, "workspace.db")))
+	assert.NoFileExists(t, filepath.Join(dir, "workspace.db.restore"))
+
+	workspaceDB, err = NewWorkspaceDB(dir)
+	assert.NoError(t, err)
+	defer workspaceDB.Close()
+	records, err := workspaceDB.ListFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "/tmp/a.txt", records[0].Path)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.Error(t, CheckIntegrity(filepath.Join(dir, "missing.db")))
+	assert.NoFileExists(t, filepath.Join(dir, "missing.db"))
+
+	corrupted := filepath.Join(dir, "corrupted.db")
+	assert.NoError(t, os.WriteFile(corrupted, []byte("not a database"), 0644))
+	assert.Error(t, CheckIntegrity(corrupted))
+
+	// A corrupted snapshot never replaces a database
+	target := filepath.Join(dir, "target.db")
+	assert.NoError(t, os.WriteFile(target, nil, 0644))
+	assert.Error(t, RestoreDatabase(corrupted, target))
+	assert.FileExists(t, target)
+	assert.NoFileExists(t, target+".restore")
+}
@@ -17,11 +17,11 @@ type CentralDBProvider struct {
 
 const centralDBFileName = "central.db"
 
-// NewCentralDBProvider opens or initializes the central database at the binary location.
-func NewCentralDBProvider() (*CentralDBProvider, error) {
+// CentralDBPath returns the path of the central database, creating its directory if needed.
+func CentralDBPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("could not get user home directory: %v", err)
+		return "", fmt.Errorf("could not get user home directory: %v", err)
 	}
 
 	// Construct config path
@@ -29,10 +29,18 @@ func NewCentralDBProvider() (*CentralDBProvider, error) {
 
 	// Ensure the config directory exists
 	if err := os.MkdirAll(configPath, 0755); err != nil {
-		return nil, fmt.Errorf("could not create config directory: %v", err)
+		return "", fmt.Errorf("could not create config directory: %v", err)
 	}
 
-	dbPath := filepath.Join(configPath, centralDBFileName)
+	return filepath.Join(configPath, centralDBFileName), nil
+}
+
+// NewCentralDBProvider opens or initializes the central database at the binary location.
+func NewCentralDBProvider() (*CentralDBProvider, error) {
+	dbPath, err := CentralDBPath()
+	if err != nil {
+		return nil, err
+	}
 
 	slog.Info("Central database path:", "path", dbPath)
 
@@ -48,14 +56,14 @@ func NewCentralDBProvider() (*CentralDBProvider, error) {
 	return provider, nil
 }
 
-// init sets up the central database tables.
+// init brings the central database schema up to date.
 func (c *CentralDBProvider) init() error {
-	_, err := c.db.Exec(`CREATE TABLE IF NOT EXISTS workspaces (
-		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
-		root_path TEXT,
-		config TEXT
-	)`)
-	return err
+	return migrate(c.db, centralMigrations)
+}
+
+// MigrationStatus reports the migrations of the central database.
+func (c *CentralDBProvider) MigrationStatus() ([]MigrationStatus, error) {
+	return migrationStatus(c.db, centralMigrations)
 }
 
 // AddWorkspace adds a new workspace to the central database and returns its ID.
@@ -145,6 +153,28 @@ func (c *CentralDBProvider) WorkspaceExists(workspaceID int) (bool, error) {
 	return exists, err
 }
 
+// GetSetting returns the value of a setting, or sql.ErrNoRows when it is not set.
+func (c *CentralDBProvider) GetSetting(key string) (string, error) {
+	var value string
+	err := c.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	return value, err
+}
+
+func (c *CentralDBProvider) SetSetting(key, value string) error {
+	_, err := c.db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (c *CentralDBProvider) DeleteSetting(key string) error {
+	_, err := c.db.Exec("DELETE FROM settings WHERE key = ?", key)
+	return err
+}
+
+// OpenWorkspaceStore opens, or initializes, the database of the workspace whose data lives at workspacePath.
+func (c *CentralDBProvider) OpenWorkspaceStore(workspacePath string) (WorkspaceStore, error) {
+	return NewWorkspaceDB(workspacePath)
+}
+
 // Close closes the central database connection.
 func (c *CentralDBProvider) Close() error {
 	return c.db.Close()
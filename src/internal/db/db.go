@@ -1,11 +1,72 @@
 package db
 
+import "time"
+
 type Workspace struct {
 	ID       int
 	RootPath string
 	Config   string
 }
 
+// FileRecord is the indexed state of a file within a workspace.
+type FileRecord struct {
+	ID         int64
+	Path       string
+	Size       int64
+	ModifiedAt time.Time
+	Hash       string
+	MimeType   string
+	Tags       []string
+	Metadata   []byte // JSON encoded metadata of the file
+	Inode      uint64 // Inode and device identify the file across renames, zero when unavailable
+	Device     uint64
+	IndexedAt  time.Time
+}
+
+// HistoryEvent is an entry of the workspace history, recording an operation and its results.
+type HistoryEvent struct {
+	ID        int64
+	Type      string
+	RunID     string
+	CreatedAt time.Time
+	Payload   []byte // JSON encoded details of the event
+}
+
+// HistoryFilter selects history events. Zero fields match everything.
+type HistoryFilter struct {
+	Type  string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// DirRecord is the scanned state of a directory, used to skip unchanged directories on rescans.
+type DirRecord struct {
+	Path       string
+	ModifiedAt time.Time
+	ScannedAt  time.Time
+}
+
+// TaggedFile is a file tagged by the user. Its inode and device identify it across moves, so that
+// its tags follow it; its path is the last one it was seen at.
+type TaggedFile struct {
+	ID     int64
+	Path   string
+	Inode  uint64 // Zero when unavailable, the file is then only known by its path
+	Device uint64
+	Tags   []string // Sorted
+	Xattr  string   // The tags last mirrored into its extended attributes, comma-separated; empty when never mirrored
+}
+
+// CachedText is the plain text extracted from a file content, identified by the hash of the content.
+type CachedText struct {
+	Hash        string
+	MimeType    string // MIME type the text was extracted as
+	Text        string
+	Truncated   bool // Only the start of the content, or of its text, was kept
+	ExtractedAt time.Time
+}
+
 // Example usage:
 //func main() {
 //	// Initialize central database
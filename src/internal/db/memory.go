@@ -0,0 +1,440 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCentralStore is an in-memory CentralStore, used in tests to avoid touching the central database.
+type MemoryCentralStore struct {
+	mu         sync.Mutex
+	nextID     int
+	workspaces map[int]Workspace
+	stores     map[string]*MemoryWorkspaceStore
+	settings   map[string]string
+}
+
+// NewMemoryCentralStore returns an empty in-memory central store.
+func NewMemoryCentralStore() *MemoryCentralStore {
+	return &MemoryCentralStore{
+		nextID:     1,
+		workspaces: make(map[int]Workspace),
+		stores:     make(map[string]*MemoryWorkspaceStore),
+		settings:   make(map[string]string),
+	}
+}
+
+func (m *MemoryCentralStore) AddWorkspace(rootPath, config string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	m.workspaces[id] = Workspace{ID: id, RootPath: rootPath, Config: config}
+	return id, nil
+}
+
+func (m *MemoryCentralStore) UpdateWorkspaceConfig(workspaceID int, config string) (bool, error) {
+	return true, m.SetWorkspaceConfig(workspaceID, config)
+}
+
+func (m *MemoryCentralStore) GetWorkspacePath(workspaceID int) (string, error) {
+	workspace, err := m.get(workspaceID)
+	return workspace.RootPath, err
+}
+
+func (m *MemoryCentralStore) GetWorkspaceID(rootPath string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, workspace := range m.workspaces {
+		if workspace.RootPath == rootPath {
+			return id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (m *MemoryCentralStore) GetWorkspaceConfig(workspaceID int) (string, error) {
+	workspace, err := m.get(workspaceID)
+	return workspace.Config, err
+}
+
+func (m *MemoryCentralStore) SetWorkspaceConfig(workspaceID int, config string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Like an UPDATE, setting the config of an unknown workspace is not an error
+	if workspace, ok := m.workspaces[workspaceID]; ok {
+		workspace.Config = config
+		m.workspaces[workspaceID] = workspace
+	}
+	return nil
+}
+
+func (m *MemoryCentralStore) DeleteWorkspace(workspaceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.workspaces, workspaceID)
+	return nil
+}
+
+func (m *MemoryCentralStore) ListWorkspaces() ([]Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workspaces := make([]Workspace, 0, len(m.workspaces))
+	for _, workspace := range m.workspaces {
+		workspaces = append(workspaces, workspace)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].ID < workspaces[j].ID })
+	return workspaces, nil
+}
+
+func (m *MemoryCentralStore) WorkspaceExists(workspaceID int) (bool, error) {
+	_, err := m.get(workspaceID)
+	return err == nil, nil
+}
+
+func (m *MemoryCentralStore) MigrationStatus() ([]MigrationStatus, error) {
+	return nil, nil
+}
+
+func (m *MemoryCentralStore) GetSetting(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.settings[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return value, nil
+}
+
+func (m *MemoryCentralStore) SetSetting(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings[key] = value
+	return nil
+}
+
+func (m *MemoryCentralStore) DeleteSetting(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.settings, key)
+	return nil
+}
+
+// OpenWorkspaceStore returns the in-memory store of a workspace, which persists across opens.
+func (m *MemoryCentralStore) OpenWorkspaceStore(workspacePath string) (WorkspaceStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, ok := m.stores[workspacePath]
+	if !ok {
+		store = NewMemoryWorkspaceStore()
+		m.stores[workspacePath] = store
+	}
+	return store, nil
+}
+
+func (m *MemoryCentralStore) Backup(destPath string) error {
+	return errBackupUnsupported
+}
+
+func (m *MemoryCentralStore) Close() error {
+	return nil
+}
+
+func (m *MemoryCentralStore) get(workspaceID int) (Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workspace, ok := m.workspaces[workspaceID]
+	if !ok {
+		return Workspace{}, sql.ErrNoRows
+	}
+	return workspace, nil
+}
+
+// MemoryWorkspaceStore is an in-memory WorkspaceStore.
+type MemoryWorkspaceStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	files   map[string]FileRecord
+	dirs    map[string]DirRecord
+	history []HistoryEvent
+	tagged  map[int64]TaggedFile
+	texts   map[string]CachedText
+}
+
+// NewMemoryWorkspaceStore returns an empty in-memory workspace store.
+func NewMemoryWorkspaceStore() *MemoryWorkspaceStore {
+	return &MemoryWorkspaceStore{
+		nextID: 1,
+		files:  make(map[string]FileRecord),
+		dirs:   make(map[string]DirRecord),
+		tagged: make(map[int64]TaggedFile),
+		texts:  make(map[string]CachedText),
+	}
+}
+
+func (m *MemoryWorkspaceStore) UpsertFiles(records []FileRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range records {
+		if existing, ok := m.files[record.Path]; ok {
+			record.ID = existing.ID
+		} else {
+			record.ID = m.nextID
+			m.nextID++
+		}
+		if record.Tags == nil {
+			record.Tags = []string{}
+		}
+		m.files[record.Path] = record
+	}
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) GetFile(path string) (FileRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.files[path]
+	if !ok {
+		return FileRecord{}, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+func (m *MemoryWorkspaceStore) ListFiles() ([]FileRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]FileRecord, 0, len(m.files))
+	for _, record := range m.files {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	return records, nil
+}
+
+func (m *MemoryWorkspaceStore) DeleteFiles(paths []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, path := range paths {
+		delete(m.files, path)
+	}
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) ListDirs() ([]DirRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dirs := make([]DirRecord, 0, len(m.dirs))
+	for _, dir := range m.dirs {
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+func (m *MemoryWorkspaceStore) UpsertDirs(dirs []DirRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, dir := range dirs {
+		m.dirs[dir.Path] = dir
+	}
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) DeleteDirs(paths []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, path := range paths {
+		delete(m.dirs, path)
+	}
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) AddHistoryEvent(event HistoryEvent) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.ID = int64(len(m.history) + 1)
+	m.history = append(m.history, event)
+	return event.ID, nil
+}
+
+func (m *MemoryWorkspaceStore) ListHistory(filter HistoryFilter) ([]HistoryEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []HistoryEvent
+	for i := len(m.history) - 1; i >= 0; i-- {
+		event := m.history[i]
+		if filter.Type != "" && event.Type != filter.Type {
+			continue
+		}
+		if !filter.Since.IsZero() && event.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.After(events[j].CreatedAt) })
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+func (m *MemoryWorkspaceStore) GetHistoryEvent(id int64) (HistoryEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.history)) {
+		return HistoryEvent{}, sql.ErrNoRows
+	}
+	return m.history[id-1], nil
+}
+
+func (m *MemoryWorkspaceStore) GetCachedText(hash string) (CachedText, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	text, ok := m.texts[hash]
+	if !ok {
+		return CachedText{}, sql.ErrNoRows
+	}
+	return text, nil
+}
+
+func (m *MemoryWorkspaceStore) SaveCachedTexts(texts []CachedText) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, text := range texts {
+		m.texts[text.Hash] = text
+	}
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) CountCachedTexts() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.texts), nil
+}
+
+func (m *MemoryWorkspaceStore) PruneTextCache() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashes := make(map[string]bool, len(m.files))
+	for _, record := range m.files {
+		hashes[record.Hash] = true
+	}
+	pruned := 0
+	for hash := range m.texts {
+		if !hashes[hash] {
+			delete(m.texts, hash)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (m *MemoryWorkspaceStore) FindTaggedFile(path string, inode, device uint64) (TaggedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inode != 0 {
+		for _, file := range m.tagged {
+			if file.Inode == inode && file.Device == device {
+				return copyTaggedFile(file), nil
+			}
+		}
+	}
+	for _, file := range m.tagged {
+		if file.Path == path {
+			return copyTaggedFile(file), nil
+		}
+	}
+	return TaggedFile{}, sql.ErrNoRows
+}
+
+func (m *MemoryWorkspaceStore) SaveTaggedFile(file TaggedFile) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, existing := range m.tagged {
+		if existing.Path == file.Path && id != file.ID {
+			delete(m.tagged, id)
+		}
+	}
+	if len(file.Tags) == 0 {
+		delete(m.tagged, file.ID)
+		return file.ID, nil
+	}
+
+	if file.ID == 0 {
+		file.ID = m.nextID
+		m.nextID++
+	}
+	file = copyTaggedFile(file)
+	sort.Strings(file.Tags)
+	m.tagged[file.ID] = file
+	return file.ID, nil
+}
+
+func (m *MemoryWorkspaceStore) ListTaggedFiles() ([]TaggedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make([]TaggedFile, 0, len(m.tagged))
+	for _, file := range m.tagged {
+		files = append(files, copyTaggedFile(file))
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func copyTaggedFile(file TaggedFile) TaggedFile {
+	file.Tags = append([]string{}, file.Tags...)
+	return file
+}
+
+func (m *MemoryWorkspaceStore) ClearData() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files = make(map[string]FileRecord)
+	m.dirs = make(map[string]DirRecord)
+	m.texts = make(map[string]CachedText)
+	m.history = nil
+	return nil
+}
+
+func (m *MemoryWorkspaceStore) Backup(destPath string) error {
+	return errBackupUnsupported
+}
+
+func (m *MemoryWorkspaceStore) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateLegacyWorkspaceDB(t *testing.T) {
+	dir := t.TempDir()
+
+	// A workspace database created before migrations existed
+	legacy, err := ConnectToDB(filepath.Join(dir, "workspace.db"))
+	assert.NoError(t, err)
+	_, err = legacy.Exec(`CREATE TABLE files (id INTEGER PRIMARY KEY AUTOINCREMENT, workspace_id INTEGER, path TEXT, metadata BLOB)`)
+	assert.NoError(t, err)
+	_, err = legacy.Exec(`INSERT INTO files (workspace_id, path, metadata) VALUES (1, '/tmp/a.txt', '{}')`)
+	assert.NoError(t, err)
+	assert.NoError(t, legacy.Close())
+
+	statuses, err := WorkspaceMigrationStatus(dir)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.Nil(t, status.AppliedAt, "Expected %s to be pending", status.Name)
+	}
+
+	// Listing the status leaves the database untouched
+	legacy, err = ConnectToDB(filepath.Join(dir, "workspace.db"))
+	assert.NoError(t, err)
+	var tables int
+	assert.NoError(t, legacy.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_version'`).Scan(&tables))
+	assert.Zero(t, tables, "Expected no schema_version table to be created")
+	assert.NoError(t, legacy.Close())
+
+	workspaceDB, err := NewWorkspaceDB(dir)
+	assert.NoError(t, err)
+
+	records, err := workspaceDB.ListFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "/tmp/a.txt", records[0].Path)
+	}
+
+	var columns int
+	err = workspaceDB.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('files') WHERE name = 'workspace_id'`).Scan(&columns)
+	assert.NoError(t, err)
+	assert.Zero(t, columns, "Expected workspace_id to be dropped")
+	assert.NoError(t, workspaceDB.Close())
+
+	// Reopening applies nothing twice
+	workspaceDB, err = NewWorkspaceDB(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, workspaceDB.Close())
+
+	statuses, err = WorkspaceMigrationStatus(dir)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "Expected %s to be applied", status.Name)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("-- comment\nCREATE TABLE a (x INTEGER);\n\nCREATE TABLE b (y INTEGER);\n")
+	assert.Equal(t, []string{"CREATE TABLE a (x INTEGER)", "CREATE TABLE b (y INTEGER)"}, statements)
+}
@@ -0,0 +1,6 @@
+-- Workspaces registered on this machine
+CREATE TABLE IF NOT EXISTS workspaces (
+	id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+	root_path TEXT,
+	config TEXT
+);
@@ -0,0 +1,5 @@
+-- Machine-wide settings, such as the workspace pinned with `workspace use`
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Schema of workspaces created before migrations existed
+CREATE TABLE IF NOT EXISTS files (id INTEGER PRIMARY KEY AUTOINCREMENT, workspace_id INTEGER, path TEXT, metadata BLOB);
+CREATE TABLE IF NOT EXISTS history (id INTEGER PRIMARY KEY AUTOINCREMENT, event_type TEXT, event_json TEXT);
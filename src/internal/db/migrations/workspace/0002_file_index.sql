@@ -0,0 +1,23 @@
+-- Rebuild files as the file index: drop the unused workspace_id column (each workspace has its own
+-- database) and key records by path. Index data is recomputed by the next scan, so only the
+-- path and metadata of existing rows are kept.
+CREATE TABLE files_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	path TEXT NOT NULL UNIQUE,
+	size INTEGER NOT NULL DEFAULT 0,
+	mtime INTEGER NOT NULL DEFAULT 0,
+	hash TEXT NOT NULL DEFAULT '',
+	mime TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '[]',
+	metadata BLOB,
+	inode INTEGER NOT NULL DEFAULT 0,
+	device INTEGER NOT NULL DEFAULT 0,
+	indexed_at INTEGER NOT NULL DEFAULT 0
+);
+INSERT OR IGNORE INTO files_new (id, path, metadata) SELECT id, path, metadata FROM files WHERE path IS NOT NULL;
+DROP TABLE files;
+ALTER TABLE files_new RENAME TO files;
+
+-- Directory listings are only valid together with the file records they were scanned with
+DROP TABLE IF EXISTS dirs;
+CREATE TABLE dirs (path TEXT PRIMARY KEY, mtime INTEGER NOT NULL, scanned_at INTEGER NOT NULL);
@@ -0,0 +1,5 @@
+-- Typed history events: the run an event belongs to and when it happened
+ALTER TABLE history ADD COLUMN run_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE history ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_history_created_at ON history (created_at);
+CREATE INDEX IF NOT EXISTS idx_history_event_type ON history (event_type);
@@ -0,0 +1,17 @@
+-- Tags added by the user. A tagged file is identified by its inode and device, so that its tags
+-- follow it across moves, and its last known path.
+CREATE TABLE tagged_files (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	path TEXT NOT NULL UNIQUE,
+	inode INTEGER NOT NULL DEFAULT 0,
+	device INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_tagged_files_identity ON tagged_files (device, inode);
+
+CREATE TABLE user_tags (
+	file_id INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	created_at INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (file_id, tag)
+);
+CREATE INDEX idx_user_tags_tag ON user_tags (tag);
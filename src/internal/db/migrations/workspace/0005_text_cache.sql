@@ -0,0 +1,9 @@
+-- Plain text extracted from file contents, keyed by the SHA-256 of the content so that it is shared by
+-- copies and survives renames. Entries whose content is no longer indexed are pruned after extraction.
+CREATE TABLE text_cache (
+	hash TEXT PRIMARY KEY,
+	mime TEXT NOT NULL DEFAULT '',
+	text TEXT NOT NULL DEFAULT '',
+	truncated INTEGER NOT NULL DEFAULT 0,
+	extracted_at INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,3 @@
+-- The tags last mirrored into the extended attributes of a tagged file, comma-separated, so that a scan
+-- can tell an attribute cleared by the user from one that was never written.
+ALTER TABLE tagged_files ADD COLUMN xattr TEXT NOT NULL DEFAULT '';
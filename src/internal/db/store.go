@@ -0,0 +1,65 @@
+package db
+
+// CentralStore tracks the workspaces registered on this machine.
+type CentralStore interface {
+	AddWorkspace(rootPath, config string) (int, error)
+	UpdateWorkspaceConfig(workspaceID int, config string) (bool, error)
+	GetWorkspacePath(workspaceID int) (string, error)
+	GetWorkspaceID(rootPath string) (int, error)
+	GetWorkspaceConfig(workspaceID int) (string, error)
+	SetWorkspaceConfig(workspaceID int, config string) error
+	DeleteWorkspace(workspaceID int) error
+	ListWorkspaces() ([]Workspace, error)
+	WorkspaceExists(workspaceID int) (bool, error)
+	MigrationStatus() ([]MigrationStatus, error)
+	// GetSetting returns the value of a setting, or sql.ErrNoRows when it is not set.
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+	DeleteSetting(key string) error
+	// OpenWorkspaceStore opens, or initializes, the store of the workspace whose data lives at workspacePath.
+	OpenWorkspaceStore(workspacePath string) (WorkspaceStore, error)
+	// Backup writes a consistent snapshot of the database to destPath.
+	Backup(destPath string) error
+	Close() error
+}
+
+// WorkspaceStore holds the file index of a single workspace.
+type WorkspaceStore interface {
+	UpsertFiles(records []FileRecord) error
+	GetFile(path string) (FileRecord, error)
+	ListFiles() ([]FileRecord, error)
+	DeleteFiles(paths []string) error
+	ListDirs() ([]DirRecord, error)
+	UpsertDirs(dirs []DirRecord) error
+	DeleteDirs(paths []string) error
+	AddHistoryEvent(event HistoryEvent) (int64, error)
+	// ListHistory returns the events matching the filter, newest first.
+	ListHistory(filter HistoryFilter) ([]HistoryEvent, error)
+	GetHistoryEvent(id int64) (HistoryEvent, error)
+	// FindTaggedFile returns the tagged file with the given identity, or else at path, or sql.ErrNoRows.
+	FindTaggedFile(path string, inode, device uint64) (TaggedFile, error)
+	// SaveTaggedFile records the path, identity and tags of a tagged file, and returns its ID. A file
+	// without tags is removed.
+	SaveTaggedFile(file TaggedFile) (int64, error)
+	// ListTaggedFiles returns every tagged file ordered by path.
+	ListTaggedFiles() ([]TaggedFile, error)
+	// GetCachedText returns the text extracted from the content with the given hash, or sql.ErrNoRows.
+	GetCachedText(hash string) (CachedText, error)
+	SaveCachedTexts(texts []CachedText) error
+	CountCachedTexts() (int, error)
+	// PruneTextCache removes the texts of contents no file of the index has anymore, and returns their number.
+	PruneTextCache() (int, error)
+	// ClearData removes the file index, the directory scan state, the text cache and the history of the
+	// workspace. User tags are kept.
+	ClearData() error
+	// Backup writes a consistent snapshot of the database to destPath.
+	Backup(destPath string) error
+	Close() error
+}
+
+var (
+	_ CentralStore   = (*CentralDBProvider)(nil)
+	_ WorkspaceStore = (*WorkspaceDB)(nil)
+	_ CentralStore   = (*MemoryCentralStore)(nil)
+	_ WorkspaceStore = (*MemoryWorkspaceStore)(nil)
+)
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FindTaggedFile returns the tagged file with the given identity, or else at path, or sql.ErrNoRows.
+func (w *WorkspaceDB) FindTaggedFile(path string, inode, device uint64) (TaggedFile, error) {
+	var file TaggedFile
+	var fileInode, fileDevice int64
+	err := sql.ErrNoRows
+	if inode != 0 {
+		err = w.db.QueryRow("SELECT id, path, inode, device, xattr FROM tagged_files WHERE inode = ? AND device = ?",
+			int64(inode), int64(device)).Scan(&file.ID, &file.Path, &fileInode, &fileDevice, &file.Xattr)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		err = w.db.QueryRow("SELECT id, path, inode, device, xattr FROM tagged_files WHERE path = ?",
+			path).Scan(&file.ID, &file.Path, &fileInode, &fileDevice, &file.Xattr)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TaggedFile{}, err
+		}
+		return TaggedFile{}, fmt.Errorf("failed to query tagged file %s: %w", path, err)
+	}
+	file.Inode, file.Device = uint64(fileInode), uint64(fileDevice)
+
+	rows, err := w.db.Query("SELECT tag FROM user_tags WHERE file_id = ? ORDER BY tag", file.ID)
+	if err != nil {
+		return TaggedFile{}, fmt.Errorf("failed to query tags of %s: %w", file.Path, err)
+	}
+	defer rows.Close()
+
+	file.Tags = []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return TaggedFile{}, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		file.Tags = append(file.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return TaggedFile{}, fmt.Errorf("row iteration error: %w", err)
+	}
+	return file, nil
+}
+
+// SaveTaggedFile records the path, identity and tags of a tagged file, and returns its ID. A file
+// without tags is removed. Another tagged file recorded at the same path is stale and removed too.
+func (w *WorkspaceDB) SaveTaggedFile(file TaggedFile) (int64, error) {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteTaggedFiles(tx, "path = ? AND id != ?", file.Path, file.ID); err != nil {
+		return 0, err
+	}
+	if len(file.Tags) == 0 {
+		if err := deleteTaggedFiles(tx, "id = ?", file.ID); err != nil {
+			return 0, err
+		}
+		return file.ID, tx.Commit()
+	}
+
+	if file.ID == 0 {
+		result, err := tx.Exec("INSERT INTO tagged_files (path, inode, device, xattr) VALUES (?, ?, ?, ?)",
+			file.Path, int64(file.Inode), int64(file.Device), file.Xattr)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert tagged file %s: %w", file.Path, err)
+		}
+		if file.ID, err = result.LastInsertId(); err != nil {
+			return 0, err
+		}
+	} else {
+		_, err := tx.Exec("UPDATE tagged_files SET path = ?, inode = ?, device = ?, xattr = ? WHERE id = ?",
+			file.Path, int64(file.Inode), int64(file.Device), file.Xattr, file.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update tagged file %s: %w", file.Path, err)
+		}
+	}
+
+	// Keep the creation time of the tags the file already had
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(file.Tags)), ", ")
+	args := []interface{}{file.ID}
+	for _, tag := range file.Tags {
+		args = append(args, tag)
+	}
+	if _, err := tx.Exec("DELETE FROM user_tags WHERE file_id = ? AND tag NOT IN ("+placeholders+")", args...); err != nil {
+		return 0, fmt.Errorf("failed to remove tags of %s: %w", file.Path, err)
+	}
+	now := time.Now().UnixNano()
+	for _, tag := range file.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO user_tags (file_id, tag, created_at) VALUES (?, ?, ?)", file.ID, tag, now); err != nil {
+			return 0, fmt.Errorf("failed to tag %s: %w", file.Path, err)
+		}
+	}
+	return file.ID, tx.Commit()
+}
+
+func deleteTaggedFiles(tx *sql.Tx, where string, args ...interface{}) error {
+	if _, err := tx.Exec("DELETE FROM user_tags WHERE file_id IN (SELECT id FROM tagged_files WHERE "+where+")", args...); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM tagged_files WHERE "+where, args...); err != nil {
+		return fmt.Errorf("failed to delete tagged files: %w", err)
+	}
+	return nil
+}
+
+// ListTaggedFiles returns every tagged file ordered by path.
+func (w *WorkspaceDB) ListTaggedFiles() ([]TaggedFile, error) {
+	rows, err := w.db.Query(`SELECT f.id, f.path, f.inode, f.device, f.xattr, t.tag
+		FROM tagged_files f JOIN user_tags t ON t.file_id = f.id
+		ORDER BY f.path, t.tag`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tagged files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []TaggedFile
+	for rows.Next() {
+		var file TaggedFile
+		var inode, device int64
+		var xattr, tag string
+		if err := rows.Scan(&file.ID, &file.Path, &inode, &device, &xattr, &tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tagged file: %w", err)
+		}
+		if len(files) == 0 || files[len(files)-1].ID != file.ID {
+			file.Inode, file.Device, file.Xattr = uint64(inode), uint64(device), xattr
+			files = append(files, file)
+		}
+		files[len(files)-1].Tags = append(files[len(files)-1].Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaggedFiles(t *testing.T) {
+	workspaceDB, err := NewWorkspaceDB(t.TempDir())
+	assert.NoError(t, err)
+	defer workspaceDB.Close()
+
+	for name, store := range map[string]WorkspaceStore{"sql": workspaceDB, "memory": NewMemoryWorkspaceStore()} {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.FindTaggedFile("/ws/report.pdf", 42, 1)
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+
+			id, err := store.SaveTaggedFile(TaggedFile{Path: "/ws/report.pdf", Inode: 42, Device: 1, Tags: []string{"work", "draft"}})
+			assert.NoError(t, err)
+
+			// Found by identity once moved, and by path when the identity is unknown
+			file, err := store.FindTaggedFile("/ws/Documents/report.pdf", 42, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, TaggedFile{ID: id, Path: "/ws/report.pdf", Inode: 42, Device: 1, Tags: []string{"draft", "work"}}, file)
+			file, err = store.FindTaggedFile("/ws/report.pdf", 0, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, id, file.ID)
+
+			file.Path = "/ws/Documents/report.pdf"
+			file.Tags = []string{"work"}
+			file.Xattr = "work"
+			_, err = store.SaveTaggedFile(file)
+			assert.NoError(t, err)
+
+			// A file replacing another at its path takes over the path
+			_, err = store.SaveTaggedFile(TaggedFile{Path: "/ws/notes.txt", Inode: 7, Device: 1, Tags: []string{"personal"}})
+			assert.NoError(t, err)
+			_, err = store.SaveTaggedFile(TaggedFile{Path: "/ws/notes.txt", Inode: 8, Device: 1, Tags: []string{"work"}})
+			assert.NoError(t, err)
+
+			files, err := store.ListTaggedFiles()
+			assert.NoError(t, err)
+			if assert.Len(t, files, 2) {
+				assert.Equal(t, "/ws/Documents/report.pdf", files[0].Path)
+				assert.Equal(t, []string{"work"}, files[0].Tags)
+				assert.Equal(t, "work", files[0].Xattr)
+				assert.Equal(t, uint64(8), files[1].Inode)
+			}
+
+			// Removing every tag forgets the file
+			file.Tags = nil
+			_, err = store.SaveTaggedFile(file)
+			assert.NoError(t, err)
+			assert.NoError(t, store.ClearData())
+			files, err = store.ListTaggedFiles()
+			assert.NoError(t, err)
+			assert.Len(t, files, 1)
+		})
+	}
+}
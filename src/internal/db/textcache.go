@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetCachedText returns the text extracted from the content with the given hash, or sql.ErrNoRows.
+func (w *WorkspaceDB) GetCachedText(hash string) (CachedText, error) {
+	text := CachedText{Hash: hash}
+	var truncated bool
+	var extractedAt int64
+	err := w.db.QueryRow("SELECT mime, text, truncated, extracted_at FROM text_cache WHERE hash = ?", hash).
+		Scan(&text.MimeType, &text.Text, &truncated, &extractedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CachedText{}, err
+		}
+		return CachedText{}, fmt.Errorf("failed to query cached text of %s: %w", hash, err)
+	}
+	text.Truncated = truncated
+	text.ExtractedAt = time.Unix(0, extractedAt)
+	return text, nil
+}
+
+// SaveCachedTexts records extracted texts, replacing those of the same contents.
+func (w *WorkspaceDB) SaveCachedTexts(texts []CachedText) error {
+	if len(texts) == 0 {
+		return nil
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO text_cache (hash, mime, text, truncated, extracted_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET
+			mime = excluded.mime,
+			text = excluded.text,
+			truncated = excluded.truncated,
+			extracted_at = excluded.extracted_at`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, text := range texts {
+		if _, err := stmt.Exec(text.Hash, text.MimeType, text.Text, text.Truncated, text.ExtractedAt.UnixNano()); err != nil {
+			return fmt.Errorf("failed to cache text of %s: %w", text.Hash, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// CountCachedTexts returns the number of cached texts.
+func (w *WorkspaceDB) CountCachedTexts() (int, error) {
+	var count int
+	if err := w.db.QueryRow("SELECT COUNT(*) FROM text_cache").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count cached texts: %w", err)
+	}
+	return count, nil
+}
+
+// PruneTextCache removes the texts of contents no file of the index has anymore, and returns their number.
+func (w *WorkspaceDB) PruneTextCache() (int, error) {
+	result, err := w.db.Exec("DELETE FROM text_cache WHERE hash NOT IN (SELECT hash FROM files)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune text cache: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextCache(t *testing.T) {
+	workspaceDB, err := NewWorkspaceDB(t.TempDir())
+	assert.NoError(t, err)
+	defer workspaceDB.Close()
+
+	for name, store := range map[string]WorkspaceStore{"sql": workspaceDB, "memory": NewMemoryWorkspaceStore()} {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.GetCachedText("abc")
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+
+			extractedAt := time.Unix(1700000000, 0)
+			assert.NoError(t, store.SaveCachedTexts([]CachedText{
+				{Hash: "abc", MimeType: "text/plain", Text: "first", ExtractedAt: extractedAt},
+				{Hash: "def", MimeType: "application/pdf", Text: "report", ExtractedAt: extractedAt},
+			}))
+			assert.NoError(t, store.SaveCachedTexts([]CachedText{{Hash: "abc", MimeType: "text/plain", Text: "second", Truncated: true, ExtractedAt: extractedAt}}))
+
+			text, err := store.GetCachedText("abc")
+			assert.NoError(t, err)
+			assert.Equal(t, "second", text.Text)
+			assert.True(t, text.Truncated)
+			assert.True(t, extractedAt.Equal(text.ExtractedAt))
+			count, err := store.CountCachedTexts()
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			// Only the texts of indexed contents are kept
+			assert.NoError(t, store.UpsertFiles([]FileRecord{{Path: "/ws/notes.txt", Hash: "abc"}}))
+			pruned, err := store.PruneTextCache()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, pruned)
+			_, err = store.GetCachedText("def")
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+
+			assert.NoError(t, store.ClearData())
+			_, err = store.GetCachedText("abc")
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+		})
+	}
+}
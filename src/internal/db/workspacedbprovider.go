@@ -2,8 +2,11 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 )
 
 // WorkspaceDB handles data storage for a specific workspace.
@@ -21,24 +24,316 @@ func NewWorkspaceDB(rootPath string) (*WorkspaceDB, error) {
 
 	provider := &WorkspaceDB{db: db}
 	if err := provider.init(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate workspace database: %w", err)
 	}
 	return provider, nil
 }
 
-// init sets up tables for the workspace database.
+// init brings the workspace database schema up to date.
 func (w *WorkspaceDB) init() error {
-	createTables := []string{
-		`CREATE TABLE IF NOT EXISTS files (id INTEGER PRIMARY KEY AUTOINCREMENT, workspace_id INTEGER, path TEXT, metadata BLOB)`,
-		//`CREATE TABLE IF NOT EXISTS vectors (file_id INTEGER, vector BLOB)`,
-		`CREATE TABLE IF NOT EXISTS history (id INTEGER PRIMARY KEY AUTOINCREMENT, event_type TEXT, event_json TEXT)`,
-	}
-	for _, query := range createTables {
-		if _, err := w.db.Exec(query); err != nil {
-			return err
+	return migrate(w.db, workspaceMigrations)
+}
+
+// WorkspaceMigrationStatus reports the migrations of the workspace database at rootPath without applying them.
+func WorkspaceMigrationStatus(rootPath string) ([]MigrationStatus, error) {
+	dbPath := filepath.Join(rootPath, "workspace.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("workspace database not found: %w", err)
+	}
+
+	db, err := ConnectToDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return migrationStatus(db, workspaceMigrations)
+}
+
+// UpsertFiles inserts or updates the index records of the given files in a single transaction.
+func (w *WorkspaceDB) UpsertFiles(records []FileRecord) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO files (path, size, mtime, hash, mime, tags, metadata, inode, device, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET
+			size = excluded.size,
+			mtime = excluded.mtime,
+			hash = excluded.hash,
+			mime = excluded.mime,
+			tags = excluded.tags,
+			metadata = excluded.metadata,
+			inode = excluded.inode,
+			device = excluded.device,
+			indexed_at = excluded.indexed_at`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare file upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		tags, err := json.Marshal(record.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tags of %s: %w", record.Path, err)
+		}
+		if record.Tags == nil {
+			tags = []byte("[]")
+		}
+
+		_, err = stmt.Exec(record.Path, record.Size, record.ModifiedAt.UnixNano(), record.Hash, record.MimeType,
+			string(tags), record.Metadata, int64(record.Inode), int64(record.Device), record.IndexedAt.UnixNano())
+		if err != nil {
+			return fmt.Errorf("failed to index %s: %w", record.Path, err)
 		}
 	}
-	return nil
+
+	return tx.Commit()
+}
+
+// GetFile returns the index record of a file, or sql.ErrNoRows if it is not indexed.
+func (w *WorkspaceDB) GetFile(path string) (FileRecord, error) {
+	row := w.db.QueryRow(`SELECT `+fileColumns+` FROM files WHERE path = ?`, path)
+	return scanFileRecord(row)
+}
+
+// ListFiles returns every indexed file ordered by path.
+func (w *WorkspaceDB) ListFiles() ([]FileRecord, error) {
+	rows, err := w.db.Query(`SELECT ` + fileColumns + ` FROM files ORDER BY path`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var records []FileRecord
+	for rows.Next() {
+		record, err := scanFileRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return records, nil
+}
+
+// DeleteFiles removes the index records of the given paths.
+func (w *WorkspaceDB) DeleteFiles(paths []string) error {
+	return w.deleteByPath("files", paths)
+}
+
+// ListDirs returns the scanned state of every directory of the workspace.
+func (w *WorkspaceDB) ListDirs() ([]DirRecord, error) {
+	rows, err := w.db.Query("SELECT path, mtime, scanned_at FROM dirs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query directories: %w", err)
+	}
+	defer rows.Close()
+
+	var dirs []DirRecord
+	for rows.Next() {
+		var dir DirRecord
+		var mtime, scannedAt int64
+		if err := rows.Scan(&dir.Path, &mtime, &scannedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan directory: %w", err)
+		}
+		dir.ModifiedAt = time.Unix(0, mtime)
+		dir.ScannedAt = time.Unix(0, scannedAt)
+		dirs = append(dirs, dir)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return dirs, nil
+}
+
+// UpsertDirs stores the scanned state of the given directories.
+func (w *WorkspaceDB) UpsertDirs(dirs []DirRecord) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO dirs (path, mtime, scanned_at) VALUES (?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET mtime = excluded.mtime, scanned_at = excluded.scanned_at`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare directory upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, dir := range dirs {
+		if _, err := stmt.Exec(dir.Path, dir.ModifiedAt.UnixNano(), dir.ScannedAt.UnixNano()); err != nil {
+			return fmt.Errorf("failed to store directory %s: %w", dir.Path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteDirs removes the scanned state of the given directories.
+func (w *WorkspaceDB) DeleteDirs(paths []string) error {
+	return w.deleteByPath("dirs", paths)
+}
+
+// workspaceDataTables are the tables holding the data of a workspace, emptied by ClearData
+var workspaceDataTables = []string{"files", "dirs", "text_cache", "history"}
+
+// ClearData removes the file index, the directory scan state, the text cache and the history of the workspace.
+func (w *WorkspaceDB) ClearData() error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range workspaceDataTables {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (w *WorkspaceDB) deleteByPath(table string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(fmt.Sprintf("DELETE FROM %s WHERE path = ?", table))
+	if err != nil {
+		return fmt.Errorf("failed to prepare delete from %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	for _, path := range paths {
+		if _, err := stmt.Exec(path); err != nil {
+			return fmt.Errorf("failed to delete %s from %s: %w", path, table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddHistoryEvent records an event in the workspace history and returns its ID.
+func (w *WorkspaceDB) AddHistoryEvent(event HistoryEvent) (int64, error) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	result, err := w.db.Exec("INSERT INTO history (event_type, run_id, created_at, event_json) VALUES (?, ?, ?, ?)",
+		event.Type, event.RunID, event.CreatedAt.UnixNano(), string(event.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert history event: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// ListHistory returns the events matching the filter, newest first.
+func (w *WorkspaceDB) ListHistory(filter HistoryFilter) ([]HistoryEvent, error) {
+	query := "SELECT " + historyColumns + " FROM history WHERE 1 = 1"
+	var args []any
+	if filter.Type != "" {
+		query += " AND event_type = ?"
+		args = append(args, filter.Type)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.Until.UnixNano())
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := w.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	var events []HistoryEvent
+	for rows.Next() {
+		event, err := scanHistoryEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return events, nil
+}
+
+// GetHistoryEvent returns a single history event, or sql.ErrNoRows if it does not exist.
+func (w *WorkspaceDB) GetHistoryEvent(id int64) (HistoryEvent, error) {
+	row := w.db.QueryRow("SELECT "+historyColumns+" FROM history WHERE id = ?", id)
+	return scanHistoryEvent(row)
+}
+
+const historyColumns = "id, event_type, run_id, created_at, event_json"
+
+func scanHistoryEvent(row rowScanner) (HistoryEvent, error) {
+	var (
+		event     HistoryEvent
+		eventType sql.NullString
+		payload   sql.NullString
+		createdAt int64
+	)
+	if err := row.Scan(&event.ID, &eventType, &event.RunID, &createdAt, &payload); err != nil {
+		return HistoryEvent{}, err
+	}
+	event.Type = eventType.String
+	event.CreatedAt = time.Unix(0, createdAt)
+	event.Payload = []byte(payload.String)
+	return event, nil
+}
+
+const fileColumns = "id, path, size, mtime, hash, mime, tags, metadata, inode, device, indexed_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFileRecord(row rowScanner) (FileRecord, error) {
+	var (
+		record           FileRecord
+		mtime, indexedAt int64
+		inode, device    int64
+		tags             string
+		metadata         []byte
+	)
+	if err := row.Scan(&record.ID, &record.Path, &record.Size, &mtime, &record.Hash, &record.MimeType, &tags, &metadata, &inode, &device, &indexedAt); err != nil {
+		return FileRecord{}, err
+	}
+
+	record.ModifiedAt = time.Unix(0, mtime)
+	record.IndexedAt = time.Unix(0, indexedAt)
+	record.Metadata = metadata
+	record.Inode = uint64(inode)
+	record.Device = uint64(device)
+	if err := json.Unmarshal([]byte(tags), &record.Tags); err != nil {
+		return FileRecord{}, fmt.Errorf("failed to unmarshal tags of %s: %w", record.Path, err)
+	}
+	return record, nil
 }
 
 // Close closes the workspace-specific database connection.
@@ -46,13 +341,13 @@ func (w *WorkspaceDB) Close() error {
 	return w.db.Close()
 }
 
-// Utility function to load a workspace database by ID.
-func LoadWorkspaceDBProvider(central *CentralDBProvider, workspaceID int) (*WorkspaceDB, error) {
+// Utility function to load a workspace store by ID.
+func LoadWorkspaceDBProvider(central CentralStore, workspaceID int) (WorkspaceStore, error) {
 	rootPath, err := central.GetWorkspacePath(workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("could not find workspace with ID %d: %v", workspaceID, err)
 	}
-	return NewWorkspaceDB(rootPath)
+	return central.OpenWorkspaceStore(rootPath)
 }
 
 /* // Example function: AddFileMetadata adds file metadata in a workspace-specific database.
@@ -93,12 +388,6 @@ func (w *WorkspaceDB) StoreVector(fileID int, vector []float64) error {
 	}
 
 	return nil
-}
-
-// Function to add a historical event to the workspace database.
-func (w *WorkspaceDB) AddHistoryEvent(eventType string, eventJSON string) error {
-	_, err := w.db.Exec("INSERT INTO history (event_type, event_json) VALUES (?, ?)", eventType, eventJSON)
-	return err
 } */
 
 /* // serializeMetadata serializes metadata for storage.
@@ -0,0 +1,475 @@
+package deskfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveZip   ArchiveFormat = "zip"
+)
+
+// OriginalsMode controls what happens to files once they have been archived and verified.
+type OriginalsMode string
+
+const (
+	OriginalsTrash  OriginalsMode = "trash"
+	OriginalsRemove OriginalsMode = "remove"
+	OriginalsKeep   OriginalsMode = "keep"
+)
+
+// ArchiveParams configures an archive run outside of the organize rules.
+type ArchiveParams struct {
+	SourceDir  string
+	TargetDir  string // Folder receiving the archives
+	Name       string // Prefix of the archive file names
+	OlderThan  time.Duration
+	LargerThan int64
+	Extensions []string
+	Format     ArchiveFormat
+	Originals  OriginalsMode
+	Recursive  bool
+	DryRun     bool
+}
+
+// archivedFile is a file written to an archive, with the checksum used to verify it.
+type archivedFile struct {
+	node *FileNode
+	name string // Entry name inside the archive
+	hash [sha256.Size]byte
+}
+
+// ParseArchiveFormat validates an archive format name.
+func ParseArchiveFormat(value string) (ArchiveFormat, error) {
+	switch format := ArchiveFormat(strings.TrimPrefix(strings.ToLower(value), ".")); format {
+	case ArchiveTarGz, ArchiveZip:
+		return format, nil
+	case "tgz":
+		return ArchiveTarGz, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q, expected tar.gz or zip", value)
+	}
+}
+
+// ParseOriginalsMode validates what to do with archived originals.
+func ParseOriginalsMode(value string) (OriginalsMode, error) {
+	switch mode := OriginalsMode(strings.ToLower(value)); mode {
+	case OriginalsTrash, OriginalsRemove, OriginalsKeep:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported originals mode %q, expected trash, remove or keep", value)
+	}
+}
+
+// ArchiveOldFiles collects the files of SourceDir matching the age, size and extension predicates
+// into a dated archive under TargetDir.
+func (dfs *DesktopFS) ArchiveOldFiles(cfg *DeskFSConfig, params *ArchiveParams) (string, int, error) {
+	dfs.journal = nil
+	archivePath, count, err := dfs.archiveOldFiles(cfg, params)
+	dfs.recordRun(EventArchive, params.SourceDir, err)
+	return archivePath, count, err
+}
+
+func (dfs *DesktopFS) archiveOldFiles(cfg *DeskFSConfig, params *ArchiveParams) (string, int, error) {
+	maxDepth, err := CalculateMaxDepth(params.SourceDir)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to calculate max depth: %w", err)
+	}
+
+	if params.Format == "" {
+		params.Format = ArchiveTarGz
+	}
+	if params.Originals == "" {
+		params.Originals = OriginalsTrash
+	}
+
+	dfs.DirectoryTree = nil
+	if err := dfs.buildTreeAndCache(params.SourceDir, params.Recursive, maxDepth); err != nil {
+		return "", 0, fmt.Errorf("failed to build directory tree: %w", err)
+	}
+
+	rule := &Rule{
+		Action:     RuleArchive,
+		Target:     params.TargetDir,
+		Extensions: params.Extensions,
+		olderThan:  params.OlderThan,
+		largerThan: params.LargerThan,
+	}
+
+	var files []*FileNode
+	now := time.Now()
+	collectFiles(dfs.DirectoryTree.Root, params.Recursive, func(fileNode *FileNode) {
+		// Never archive the archives written to a target inside the source directory
+		if isSameOrAncestor(params.TargetDir, fileNode.Path) {
+			return
+		}
+		if rule.Matches(fileNode, now) {
+			files = append(files, fileNode)
+		}
+	})
+
+	if len(files) == 0 {
+		return "", 0, nil
+	}
+
+	if params.DryRun {
+		for _, fileNode := range files {
+			slog.Info(fmt.Sprintf("Dry run: archiving %s\n", fileNode.Path))
+		}
+		return "", len(files), nil
+	}
+
+	dfs.journal = NewJournal(cfg.CacheDir, &FilePathParams{SourceDir: params.SourceDir, TargetDir: params.TargetDir})
+	defer dfs.saveJournal()
+
+	archivePath, err := dfs.archiveFiles(files, params.SourceDir, params.TargetDir, params.Name, params.Format, params.Originals)
+	if err != nil {
+		return "", 0, err
+	}
+	return archivePath, len(files), nil
+}
+
+// archiveFiles writes files into a new archive in targetDir, verifies it, then disposes of the originals.
+func (dfs *DesktopFS) archiveFiles(files []*FileNode, baseDir, targetDir, name string, format ArchiveFormat, originals OriginalsMode) (string, error) {
+	if name == "" {
+		name = "archive"
+	}
+
+	if err := dfs.journal.mkdirAll(targetDir); err != nil {
+		return "", fmt.Errorf("failed to create archive directory %s: %w", targetDir, err)
+	}
+
+	archivePath := filepath.Join(targetDir, fmt.Sprintf("%s-%s.%s", name, time.Now().Format(time.DateOnly), format))
+	if _, err := os.Stat(archivePath); err == nil {
+		archivePath = generateUniqueArchiveName(archivePath, format)
+	}
+
+	entries := make([]*archivedFile, 0, len(files))
+	for _, fileNode := range files {
+		entryName, err := filepath.Rel(baseDir, fileNode.Path)
+		if err != nil || strings.HasPrefix(entryName, "..") {
+			entryName = filepath.Base(fileNode.Path)
+		}
+		entries = append(entries, &archivedFile{node: fileNode, name: filepath.ToSlash(entryName)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	// Write to a temporary file so an interrupted run never leaves a truncated archive behind
+	partialPath := archivePath + ".partial"
+	if err := writeArchive(partialPath, format, entries); err != nil {
+		os.Remove(partialPath)
+		return "", fmt.Errorf("failed to write archive %s: %w", archivePath, err)
+	}
+
+	if err := verifyArchive(partialPath, format, entries); err != nil {
+		os.Remove(partialPath)
+		return "", fmt.Errorf("archive verification failed for %s: %w", archivePath, err)
+	}
+
+	if err := os.Rename(partialPath, archivePath); err != nil {
+		os.Remove(partialPath)
+		return "", fmt.Errorf("failed to finalize archive %s: %w", archivePath, err)
+	}
+	dfs.journal.Record(JournalArchive, archivePath, "", 0)
+	slog.Info(fmt.Sprintf("Archived %d files into %s\n", len(entries), archivePath))
+
+	for _, entry := range entries {
+		switch originals {
+		case OriginalsTrash:
+			trashEntry, err := dfs.TrashPath(entry.node.Path)
+			if err != nil {
+				return archivePath, fmt.Errorf("failed to trash archived file %s: %w", entry.node.Path, err)
+			}
+			dfs.journal.Record(JournalTrash, entry.node.Path, trashEntry.FilesPath(), 0)
+		case OriginalsRemove:
+			if err := os.Remove(entry.node.Path); err != nil {
+				return archivePath, fmt.Errorf("failed to remove archived file %s: %w", entry.node.Path, err)
+			}
+			dfs.journal.recordRemove(entry.node.Path, archivePath, entry.name)
+		}
+	}
+
+	return archivePath, nil
+}
+
+func writeArchive(path string, format ArchiveFormat, entries []*archivedFile) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch format {
+	case ArchiveZip:
+		err = writeZip(file, entries)
+	default:
+		err = writeTarGz(file, entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func writeTarGz(w io.Writer, entries []*archivedFile) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	for _, entry := range entries {
+		err := withFile(entry.node.Path, func(src *os.File, info os.FileInfo) error {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = entry.name
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			return copyAndHash(tw, src, &entry.hash)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", entry.node.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+func writeZip(w io.Writer, entries []*archivedFile) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		err := withFile(entry.node.Path, func(src *os.File, info os.FileInfo) error {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = entry.name
+			header.Method = zip.Deflate
+			dst, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			return copyAndHash(dst, src, &entry.hash)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", entry.node.Path, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// verifyArchive re-reads the archive and checks every entry against the checksum computed while writing.
+func verifyArchive(path string, format ArchiveFormat, entries []*archivedFile) error {
+	expected := make(map[string][sha256.Size]byte, len(entries))
+	for _, entry := range entries {
+		expected[entry.name] = entry.hash
+	}
+
+	seen := 0
+	check := func(name string, r io.Reader) error {
+		want, ok := expected[name]
+		if !ok {
+			return fmt.Errorf("unexpected entry %s", name)
+		}
+		var got [sha256.Size]byte
+		if err := copyAndHash(io.Discard, r, &got); err != nil {
+			return fmt.Errorf("failed to read entry %s: %w", name, err)
+		}
+		if !bytes.Equal(got[:], want[:]) {
+			return fmt.Errorf("checksum mismatch for entry %s", name)
+		}
+		seen++
+		return nil
+	}
+
+	switch format {
+	case ArchiveZip:
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, zf := range zr.File {
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = check(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+
+		tr := tar.NewReader(gzr)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := check(header.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+
+	if seen != len(entries) {
+		return fmt.Errorf("archive contains %d of %d entries", seen, len(entries))
+	}
+	return nil
+}
+
+// restoreArchivedFile extracts the named entry of an archive written by archiveFiles to dst, restoring
+// its permissions and modification time.
+func restoreArchivedFile(archivePath, name, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	found := false
+	restore := func(mode os.FileMode, modTime time.Time, r io.Reader) error {
+		found = true
+		file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, r)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+			return err
+		}
+		return os.Chtimes(dst, modTime, modTime)
+	}
+
+	switch archiveKind(archivePath) {
+	case "zip":
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, zf := range zr.File {
+			if zf.Name != name {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = restore(zf.Mode(), zf.Modified, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			break
+		}
+	default:
+		err := walkTar(archivePath, func(header *tar.Header, r io.Reader) error {
+			if found || header.Name != name {
+				return nil
+			}
+			return restore(header.FileInfo().Mode(), header.ModTime, r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("entry %s not found", name)
+	}
+	return nil
+}
+
+// withFile opens a regular file and passes it with its FileInfo to fn.
+func withFile(path string, fn func(*os.File, os.FileInfo) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+	return fn(file, info)
+}
+
+// copyAndHash copies src to dst while computing the SHA-256 of the copied content.
+func copyAndHash(dst io.Writer, src io.Reader, sum *[sha256.Size]byte) error {
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, hasher), src); err != nil {
+		return err
+	}
+	copy(sum[:], hasher.Sum(nil))
+	return nil
+}
+
+// generateUniqueArchiveName works like generateUniqueFilename for multi-part extensions such as .tar.gz.
+func generateUniqueArchiveName(path string, format ArchiveFormat) string {
+	suffix := "." + string(format)
+	base := strings.TrimSuffix(path, suffix)
+	for i := 1; ; i++ {
+		newPath := fmt.Sprintf("%s_%d%s", base, i, suffix)
+		if _, err := os.Stat(newPath); os.IsNotExist(err) {
+			return newPath
+		}
+	}
+}
+
+// collectFiles calls fn for every file of the tree, descending into children when recursive.
+func collectFiles(node *DirectoryNode, recursive bool, fn func(*FileNode)) {
+	for _, fileNode := range node.Files {
+		fn(fileNode)
+	}
+	if !recursive {
+		return
+	}
+	for _, child := range node.Children {
+		collectFiles(child, recursive, fn)
+	}
+}
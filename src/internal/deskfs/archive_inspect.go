@@ -0,0 +1,377 @@
+package deskfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default limits protecting --extract against archive bombs.
+const (
+	DefaultExtractMaxSize    int64 = 1 << 30
+	DefaultExtractMaxEntries       = 10000
+)
+
+var errExtractLimit = errors.New("archive exceeds extraction limits")
+
+// ArchiveEntryInfo describes a single entry of an archive.
+type ArchiveEntryInfo struct {
+	Name string
+	Size int64
+}
+
+// archiveKind returns the kind of archive a file name denotes: "zip", "tar", "tar.gz", "gz" or "".
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".gz"):
+		return "gz"
+	default:
+		return ""
+	}
+}
+
+// archiveStem strips the archive extension from a file name.
+func archiveStem(name string) string {
+	lower := strings.ToLower(name)
+	for _, suffix := range []string{".tar.gz", ".tgz", ".tar", ".zip", ".gz"} {
+		if strings.HasSuffix(lower, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// ListArchiveEntries lists the regular files of an archive without extracting them.
+func ListArchiveEntries(path string) ([]ArchiveEntryInfo, error) {
+	var entries []ArchiveEntryInfo
+
+	switch archiveKind(path) {
+	case "zip":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		for _, zf := range zr.File {
+			if zf.FileInfo().Mode().IsRegular() {
+				entries = append(entries, ArchiveEntryInfo{Name: zf.Name, Size: int64(zf.UncompressedSize64)})
+			}
+		}
+	case "tar", "tar.gz":
+		err := walkTar(path, func(header *tar.Header, _ io.Reader) error {
+			if header.Typeflag == tar.TypeReg {
+				entries = append(entries, ArchiveEntryInfo{Name: header.Name, Size: header.Size})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "gz":
+		name, err := gzipEntryName(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ArchiveEntryInfo{Name: name})
+	default:
+		return nil, fmt.Errorf("%s is not a supported archive", path)
+	}
+
+	return entries, nil
+}
+
+// walkTar calls fn for every header of a tar or tar.gz archive.
+func walkTar(path string, fn func(*tar.Header, io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if archiveKind(path) == "tar.gz" {
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// gzipEntryName returns the original file name stored in a gzip header, or the name without .gz.
+func gzipEntryName(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer gzr.Close()
+
+	if gzr.Name != "" {
+		return filepath.Base(gzr.Name), nil
+	}
+	return archiveStem(filepath.Base(path)), nil
+}
+
+// dominantArchiveCategory categorizes an archive by the FileTypeTree folder holding most of its content,
+// weighted by uncompressed size (or by entry count when sizes are unknown).
+func (dfs *DesktopFS) dominantArchiveCategory(ctx context.Context, path string, cfg *DeskFSConfig) (string, bool) {
+	entries, err := ListArchiveEntries(path)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not inspect archive %s: %v\n", path, err))
+		return "", false
+	}
+
+	weights := make(map[string]int64)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name))
+		category, found := dfs.findFolderForExtension(ctx, cfg.FileTypeTree.Root, ext)
+		if !found {
+			continue
+		}
+		weight := entry.Size
+		if weight <= 0 {
+			weight = 1
+		}
+		weights[category] += weight
+	}
+
+	var dominant string
+	var best int64
+	for category, weight := range weights {
+		if weight > best || (weight == best && category < dominant) {
+			dominant, best = category, weight
+		}
+	}
+	return dominant, dominant != ""
+}
+
+// extractArchives extracts every archive found in the source directory into a sibling folder
+// named after the archive, so their contents are organized by the same run.
+func (dfs *DesktopFS) extractArchives(params *FilePathParams) error {
+	dfs.extractedDirs = nil
+
+	var archives []string
+	err := filepath.WalkDir(params.SourceDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == params.SourceDir {
+				return nil
+			}
+			// Archives already organized into a target inside the source directory are left alone
+			if !params.Recursive || isSameOrAncestor(params.TargetDir, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && archiveKind(d.Name()) != "" {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, archivePath := range archives {
+		dest := filepath.Join(filepath.Dir(archivePath), archiveStem(filepath.Base(archivePath)))
+		if _, err := os.Lstat(dest); err == nil {
+			dest = generateUniqueFilename(dest)
+		}
+
+		if params.DryRun {
+			slog.Info(fmt.Sprintf("Dry run: extracting %s to %s\n", archivePath, dest))
+			continue
+		}
+
+		// Archives over the limits, corrupt or unsafe are left as they are, organized like other files.
+		// The extraction is journaled separately so only complete extractions end up in the run's journal.
+		extraction := &Journal{}
+		if err := extractArchive(archivePath, dest, params.ExtractMaxSize, params.ExtractMaxEntries, extraction); err != nil {
+			os.RemoveAll(dest)
+			slog.Warn(fmt.Sprintf("Skipping extraction of %s: %v\n", archivePath, err))
+			continue
+		}
+
+		dfs.journal.append(extraction.Entries)
+		dfs.extractedDirs = append(dfs.extractedDirs, dest)
+		slog.Info(fmt.Sprintf("Extracted %s to %s\n", archivePath, dest))
+	}
+
+	return nil
+}
+
+// isExtracted reports whether path lies within a folder extracted by the current run.
+func (dfs *DesktopFS) isExtracted(path string) bool {
+	for _, dir := range dfs.extractedDirs {
+		if isSameOrAncestor(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArchive safely extracts an archive into dest. Entries escaping dest, links and special
+// files are rejected, and the total size and entry count are bounded. The directories and files it
+// creates are recorded in journal, which may be nil.
+func extractArchive(path, dest string, maxSize int64, maxEntries int, journal *Journal) error {
+	if maxSize <= 0 {
+		maxSize = DefaultExtractMaxSize
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultExtractMaxEntries
+	}
+
+	var written int64
+	count := 0
+
+	writeEntry := func(name string, mode os.FileMode, r io.Reader) error {
+		count++
+		if count > maxEntries {
+			return fmt.Errorf("%w: more than %d entries", errExtractLimit, maxEntries)
+		}
+
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return err
+		}
+		if err := journal.mkdirAll(filepath.Dir(target)); err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		journal.Record(JournalExtract, path, target, 0)
+
+		// Never trust declared sizes: read one byte past the remaining budget to detect overflow
+		n, err := io.Copy(file, io.LimitReader(r, maxSize-written+1))
+		written += n
+		if err != nil {
+			return err
+		}
+		if written > maxSize {
+			return fmt.Errorf("%w: more than %s uncompressed", errExtractLimit, FormatSize(maxSize))
+		}
+		return nil
+	}
+
+	if err := journal.mkdirAll(dest); err != nil {
+		return err
+	}
+
+	switch archiveKind(path) {
+	case "zip":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, zf := range zr.File {
+			mode := zf.FileInfo().Mode()
+			if mode.IsDir() {
+				continue
+			}
+			if !mode.IsRegular() {
+				slog.Warn(fmt.Sprintf("Skipping non-regular entry %s in %s\n", zf.Name, path))
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = writeEntry(zf.Name, mode, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "tar", "tar.gz":
+		return walkTar(path, func(header *tar.Header, r io.Reader) error {
+			switch header.Typeflag {
+			case tar.TypeDir:
+				return nil
+			case tar.TypeReg:
+				return writeEntry(header.Name, header.FileInfo().Mode(), r)
+			default:
+				slog.Warn(fmt.Sprintf("Skipping non-regular entry %s in %s\n", header.Name, path))
+				return nil
+			}
+		})
+	case "gz":
+		name, err := gzipEntryName(path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		return writeEntry(name, 0644, gzr)
+	default:
+		return fmt.Errorf("%s is not a supported archive", path)
+	}
+}
+
+// safeJoin joins an archive entry name to dest, rejecting names that would escape it (zip-slip).
+func safeJoin(dest, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("refusing absolute archive entry %q", name)
+	}
+
+	target := filepath.Join(dest, name)
+	if !isSameOrAncestor(dest, target) || target == filepath.Clean(dest) {
+		return "", fmt.Errorf("refusing archive entry %q escaping the extraction directory", name)
+	}
+	return target, nil
+}
@@ -0,0 +1,314 @@
+package deskfs
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveOldFiles(t *testing.T) {
+	isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"old/setup.exe":  "installer",
+		"old/readme.txt": "readme",
+		"fresh.txt":      "fresh",
+	})
+	defer cleanup()
+
+	old := time.Now().Add(-200 * 24 * time.Hour)
+	for _, name := range []string{"old/setup.exe", "old/readme.txt"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+	}
+
+	dfs := &DesktopFS{}
+	cfg := &DeskFSConfig{CacheDir: t.TempDir()}
+
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			params := &ArchiveParams{
+				SourceDir: dir,
+				TargetDir: filepath.Join(dir, "Archive", string(format)),
+				OlderThan: 90 * 24 * time.Hour,
+				Format:    format,
+				Originals: OriginalsKeep,
+				Recursive: true,
+			}
+
+			archivePath, count, err := dfs.ArchiveOldFiles(cfg, params)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.FileExists(t, archivePath)
+			assert.NoFileExists(t, archivePath+".partial")
+		})
+	}
+
+	zr, err := zip.OpenReader(filepath.Join(dir, "Archive", "zip", "archive-"+time.Now().Format(time.DateOnly)+".zip"))
+	assert.NoError(t, err)
+	defer zr.Close()
+
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	assert.ElementsMatch(t, []string{"old/setup.exe", "old/readme.txt"}, names)
+}
+
+func TestArchiveOldFilesTrashesOriginals(t *testing.T) {
+	isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"big.iso": "0123456789",
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	cfg := &DeskFSConfig{CacheDir: t.TempDir()}
+
+	archivePath, count, err := dfs.ArchiveOldFiles(cfg, &ArchiveParams{
+		SourceDir:  dir,
+		TargetDir:  filepath.Join(dir, "Archive"),
+		LargerThan: 5,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.FileExists(t, archivePath)
+	assert.NoFileExists(t, filepath.Join(dir, "big.iso"))
+
+	journal, err := FindJournal(cfg.CacheDir, "")
+	assert.NoError(t, err)
+	_, err = journal.Undo()
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dir, "big.iso"))
+	assert.NoFileExists(t, archivePath)
+}
+
+func TestArchiveOldFilesRemovesOriginals(t *testing.T) {
+	isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"old/big.iso":   "0123456789",
+		"old/setup.exe": "installer!",
+	})
+	defer cleanup()
+
+	old := time.Now().Add(-200 * 24 * time.Hour).Truncate(time.Second)
+	for _, name := range []string{"old/big.iso", "old/setup.exe"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+	}
+
+	dfs := &DesktopFS{}
+	cfg := &DeskFSConfig{CacheDir: t.TempDir()}
+
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath, count, err := dfs.ArchiveOldFiles(cfg, &ArchiveParams{
+				SourceDir:  dir,
+				TargetDir:  filepath.Join(dir, "Archive"),
+				LargerThan: 5,
+				Format:     format,
+				Originals:  OriginalsRemove,
+				Recursive:  true,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.NoFileExists(t, filepath.Join(dir, "old/big.iso"))
+
+			// Undo extracts the removed originals back from the archive before deleting it
+			journal, err := FindJournal(cfg.CacheDir, "")
+			assert.NoError(t, err)
+			warnings, err := journal.Undo()
+			assert.NoError(t, err)
+			assert.Empty(t, warnings)
+
+			content, err := os.ReadFile(filepath.Join(dir, "old/big.iso"))
+			assert.NoError(t, err)
+			assert.Equal(t, "0123456789", string(content))
+			info, err := os.Stat(filepath.Join(dir, "old/setup.exe"))
+			assert.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(old), "Expected the modification time to be restored")
+			assert.NoFileExists(t, archivePath)
+		})
+	}
+}
+
+func TestUndoKeepsArchiveOfUnrestoredOriginals(t *testing.T) {
+	isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"big.iso": "0123456789",
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	cfg := &DeskFSConfig{CacheDir: t.TempDir()}
+
+	archivePath, _, err := dfs.ArchiveOldFiles(cfg, &ArchiveParams{
+		SourceDir:  dir,
+		TargetDir:  filepath.Join(dir, "Archive"),
+		LargerThan: 5,
+		Originals:  OriginalsRemove,
+	})
+	assert.NoError(t, err)
+
+	// A new file at the original path cannot be overwritten, so the archive is the only copy left
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "big.iso"), []byte("new"), 0644))
+
+	journal, err := FindJournal(cfg.CacheDir, "")
+	assert.NoError(t, err)
+	warnings, err := journal.Undo()
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 2)
+	assert.FileExists(t, archivePath)
+}
+
+// writeTestZip creates a zip archive at path with the given entries.
+func writeTestZip(t *testing.T, path string, entries map[string]string) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+}
+
+func TestExtractArchiveRejectsZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "evil.zip")
+	writeTestZip(t, archivePath, map[string]string{"../../escaped.txt": "pwned"})
+
+	err := extractArchive(archivePath, filepath.Join(dir, "evil"), 0, 0, nil)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "..", "escaped.txt"))
+}
+
+func TestExtractArchiveEnforcesLimits(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "bomb.zip")
+	writeTestZip(t, archivePath, map[string]string{"big.txt": "0123456789"})
+
+	err := extractArchive(archivePath, filepath.Join(dir, "bomb"), 5, 0, nil)
+	assert.ErrorIs(t, err, errExtractLimit)
+}
+
+func TestOrganizeArchives(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"target/.desktop_cleaner.toml": `file_types = { "Compressed" = [".zip"], "Pics" = [".jpg"], "Docs" = [".pdf"] }`,
+	})
+	defer cleanup()
+
+	source := filepath.Join(dir, "source")
+	assert.NoError(t, os.MkdirAll(source, 0755))
+	writeTestZip(t, filepath.Join(source, "photos.zip"), map[string]string{
+		"a.jpg":     "0123456789",
+		"b.jpg":     "0123456789",
+		"notes.pdf": "01",
+	})
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "target/.desktop_cleaner.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	params := &FilePathParams{
+		SourceDir:          source,
+		TargetDir:          filepath.Join(dir, "target"),
+		InspectArchives:    true,
+		ExtractArchives:    true,
+		PruneEmpty:         true,
+		ConflictResolution: RenameSuffix,
+	}
+
+	err := dfs.EnhancedOrganize(dfs.InstanceConfig, params)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dir, "target/Compressed/Pics/photos.zip"))
+	assert.FileExists(t, filepath.Join(dir, "target/Pics/a.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "target/Docs/notes.pdf"))
+	assert.NoDirExists(t, filepath.Join(source, "photos"))
+}
+
+func TestOrganizeSkipsArchivesFailingExtraction(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"target/.desktop_cleaner.toml": `file_types = { "Compressed" = [".zip"], "Pics" = [".jpg"] }`,
+		"source/broken.zip":            "not a zip",
+	})
+	defer cleanup()
+
+	source := filepath.Join(dir, "source")
+	writeTestZip(t, filepath.Join(source, "evil.zip"), map[string]string{"../../escaped.jpg": "pwned"})
+	writeTestZip(t, filepath.Join(source, "photos.zip"), map[string]string{"a.jpg": "0123456789"})
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "target/.desktop_cleaner.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	params := &FilePathParams{
+		SourceDir:          source,
+		TargetDir:          filepath.Join(dir, "target"),
+		ExtractArchives:    true,
+		ConflictResolution: RenameSuffix,
+	}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	// The valid archive is extracted, the others are organized as they are
+	assert.FileExists(t, filepath.Join(dir, "target/Pics/a.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "target/Compressed/broken.zip"))
+	assert.FileExists(t, filepath.Join(dir, "target/Compressed/evil.zip"))
+	assert.NoDirExists(t, filepath.Join(source, "broken"))
+	assert.NoDirExists(t, filepath.Join(source, "evil"))
+	assert.NoFileExists(t, filepath.Join(dir, "escaped.jpg"))
+}
+
+func TestOrganizeExtractedArchivesUndo(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/target/.desktop_cleaner.toml": `file_types = { "Compressed" = [".zip"], "Pics" = [".jpg"] }`,
+	})
+	defer cleanup()
+
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(source, "target")
+	assert.NoError(t, os.MkdirAll(filepath.Join(target, "Compressed"), 0755))
+	writeTestZip(t, filepath.Join(target, "Compressed", "organized.zip"), map[string]string{"old.jpg": "0123456789"})
+	writeTestZip(t, filepath.Join(source, "photos.zip"), map[string]string{"a.jpg": "0123456789"})
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(target, ".desktop_cleaner.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	params := &FilePathParams{
+		SourceDir:          source,
+		TargetDir:          target,
+		Recursive:          true,
+		ExtractArchives:    true,
+		ConflictResolution: RenameSuffix,
+	}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	// Archives inside the target directory are never extracted
+	assert.NoDirExists(t, filepath.Join(target, "Compressed", "organized"))
+	assert.FileExists(t, filepath.Join(target, "Pics", "a.jpg"))
+
+	// A file added to the extracted folder after the run survives the undo
+	assert.NoError(t, os.WriteFile(filepath.Join(source, "photos", "mine.txt"), []byte("mine"), 0644))
+
+	journal, err := FindJournal(dfs.InstanceConfig.CacheDir, "")
+	assert.NoError(t, err)
+	_, err = journal.Undo()
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(source, "photos.zip"))
+	assert.FileExists(t, filepath.Join(source, "photos", "mine.txt"))
+	assert.NoFileExists(t, filepath.Join(source, "photos", "a.jpg"))
+	assert.NoFileExists(t, filepath.Join(target, "Pics", "a.jpg"))
+}
@@ -0,0 +1,385 @@
+package deskfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// AudioData is the metadata tagged in an audio file.
+type AudioData struct {
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+	Track       int // Track number, 0 when not tagged
+	Year        int // Release year, 0 when not tagged
+}
+
+// audioContainers maps the extensions of audio files to the format of their tags
+var audioContainers = map[string]string{
+	".mp3":  "id3",
+	".flac": "flac",
+	".ogg":  "ogg", ".oga": "ogg", ".opus": "ogg",
+}
+
+const maxAudioTagSize = 4 << 20 // Largest tag read from an audio file, cover art included
+
+var errNoAudioTags = errors.New("no audio tags")
+
+// ReadAudioTags reads the ID3 tags of MP3 files and the Vorbis comments of FLAC, Ogg Vorbis and Opus
+// files. Files of other types, or without tags, return nil without error.
+func ReadAudioTags(path string) (*AudioData, error) {
+	container, ok := audioContainers[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var audio *AudioData
+	switch container {
+	case "id3":
+		audio, err = readID3v2(bufio.NewReader(file))
+		if errors.Is(err, errNoAudioTags) {
+			audio, err = readID3v1(file)
+		}
+	case "flac":
+		audio, err = readFLACComments(bufio.NewReader(file))
+	case "ogg":
+		audio, err = readOggComments(bufio.NewReader(file))
+	}
+	if errors.Is(err, errNoAudioTags) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio tags of %s: %w", path, err)
+	}
+	return audio, nil
+}
+
+// syncsafe decodes the 28 bit integers of ID3v2, stored 7 bits per byte
+func syncsafe(b []byte) int {
+	value := 0
+	for _, c := range b {
+		value = value<<7 | int(c&0x7F)
+	}
+	return value
+}
+
+// ID3v2 text frames, by ID3v2.2 and ID3v2.3+ frame ID
+var id3Frames = map[string]string{
+	"TT2": "title", "TIT2": "title",
+	"TP1": "artist", "TPE1": "artist",
+	"TP2": "albumartist", "TPE2": "albumartist",
+	"TAL": "album", "TALB": "album",
+	"TRK": "track", "TRCK": "track",
+	"TYE": "year", "TYER": "year", "TDRC": "year",
+}
+
+// readID3v2 reads the text frames of the ID3v2 tag at the start of r.
+func readID3v2(r io.Reader) (*AudioData, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return nil, errNoAudioTags
+	}
+	version, flags := header[3], header[5]
+	if version < 2 || version > 4 {
+		return nil, errNoAudioTags
+	}
+	size := syncsafe(header[6:10])
+	if size > maxAudioTagSize {
+		return nil, fmt.Errorf("ID3 tag too large")
+	}
+	tag := make([]byte, size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, fmt.Errorf("truncated ID3 tag: %w", err)
+	}
+	// Unsynchronisation inserts a zero after every 0xFF of the tag
+	if flags&0x80 != 0 && version < 4 {
+		tag = bytes.ReplaceAll(tag, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && version > 2 && len(tag) >= 4 {
+		extended := int(binary.BigEndian.Uint32(tag)) + 4
+		if version == 4 {
+			extended = syncsafe(tag[:4])
+		}
+		if extended > len(tag) {
+			return nil, fmt.Errorf("invalid ID3 extended header")
+		}
+		tag = tag[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	fields := make(map[string]string)
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+			frameFlags = binary.BigEndian.Uint16(tag[8:10])
+		case 4:
+			frameSize = syncsafe(tag[4:8])
+			frameFlags = binary.BigEndian.Uint16(tag[8:10])
+		}
+		if frameSize < 0 || headerSize+frameSize > len(tag) {
+			break
+		}
+		frame := tag[headerSize : headerSize+frameSize]
+		tag = tag[headerSize+frameSize:]
+
+		field, ok := id3Frames[id]
+		if !ok || frameFlags&id3UnsupportedFlags(version) != 0 {
+			continue
+		}
+		// ID3v2.4 frames may carry their data length before their content
+		if version == 4 && frameFlags&0x0001 != 0 && len(frame) >= 4 {
+			frame = frame[4:]
+		}
+		if _, seen := fields[field]; !seen {
+			fields[field] = decodeID3Text(frame)
+		}
+	}
+	return audioFromFields(fields)
+}
+
+// id3UnsupportedFlags returns the frame flags of compressed or encrypted frames, which are skipped
+func id3UnsupportedFlags(version byte) uint16 {
+	switch version {
+	case 3:
+		return 0x0080 | 0x0040
+	case 4:
+		return 0x0008 | 0x0004 | 0x0002
+	}
+	return 0
+}
+
+// decodeID3Text decodes a text frame, whose first byte is its encoding, keeping its first value.
+func decodeID3Text(frame []byte) string {
+	if len(frame) < 2 {
+		return ""
+	}
+	encoding, data := frame[0], frame[1:]
+
+	var text string
+	switch encoding {
+	case 0: // ISO-8859-1
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case 1, 2: // UTF-16 with a byte order mark, UTF-16BE
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if (data[0] == 0xFF && data[1] == 0xFE) || (data[0] == 0xFE && data[1] == 0xFF) {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			units = append(units, order.Uint16(data[i:]))
+		}
+		text = string(utf16.Decode(units))
+	default: // UTF-8
+		text = string(data)
+	}
+
+	// Multiple values are separated by null characters
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
+
+// readID3v1 reads the ID3v1 tag in the last 128 bytes of an MP3 file.
+func readID3v1(file *os.File) (*AudioData, error) {
+	info, err := file.Stat()
+	if err != nil || info.Size() < 128 {
+		return nil, errNoAudioTags
+	}
+	tag := make([]byte, 128)
+	if _, err := file.ReadAt(tag, info.Size()-128); err != nil || string(tag[:3]) != "TAG" {
+		return nil, errNoAudioTags
+	}
+
+	text := func(b []byte) string {
+		return strings.TrimSpace(strings.TrimRight(decodeID3Text(append([]byte{0}, b...)), "\x00"))
+	}
+	fields := map[string]string{
+		"title":  text(tag[3:33]),
+		"artist": text(tag[33:63]),
+		"album":  text(tag[63:93]),
+		"year":   text(tag[93:97]),
+	}
+	// ID3v1.1 stores the track number at the end of the comment
+	if tag[125] == 0 && tag[126] != 0 {
+		fields["track"] = strconv.Itoa(int(tag[126]))
+	}
+	return audioFromFields(fields)
+}
+
+// readFLACComments reads the Vorbis comments of the metadata blocks of a FLAC file.
+func readFLACComments(r io.Reader) (*AudioData, error) {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil || string(marker) != "fLaC" {
+		return nil, errNoAudioTags
+	}
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, errNoAudioTags
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if blockType == 4 {
+			if length > maxAudioTagSize {
+				return nil, fmt.Errorf("FLAC comment block too large")
+			}
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("truncated FLAC comment block: %w", err)
+			}
+			return parseVorbisComments(block)
+		}
+		if last {
+			return nil, errNoAudioTags
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+			return nil, errNoAudioTags
+		}
+	}
+}
+
+// readOggComments reads the comment header of an Ogg Vorbis or Opus stream, its second packet.
+func readOggComments(r io.Reader) (*AudioData, error) {
+	var packets [][]byte
+	var packet []byte
+	header := make([]byte, 27)
+	for len(packets) < 2 {
+		if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "OggS" {
+			return nil, errNoAudioTags
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, errNoAudioTags
+		}
+		for _, size := range segments {
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, errNoAudioTags
+			}
+			packet = append(packet, segment...)
+			if len(packet) > maxAudioTagSize {
+				return nil, fmt.Errorf("Ogg comment header too large")
+			}
+			// A segment shorter than 255 bytes ends its packet
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		return parseVorbisComments(comments[7:])
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		return parseVorbisComments(comments[8:])
+	}
+	return nil, errNoAudioTags
+}
+
+// parseVorbisComments parses a Vorbis comment structure: a vendor string and KEY=value comments.
+func parseVorbisComments(block []byte) (*AudioData, error) {
+	r := bytes.NewReader(block)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(r.Len()) {
+			return "", fmt.Errorf("invalid comment length")
+		}
+		value := make([]byte, length)
+		_, err := io.ReadFull(r, value)
+		return string(value), err
+	}
+
+	if _, err := readString(); err != nil { // Vendor
+		return nil, errNoAudioTags
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, errNoAudioTags
+	}
+
+	fields := make(map[string]string)
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			break
+		}
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		field := strings.ToLower(key)
+		switch field {
+		case "tracknumber":
+			field = "track"
+		case "date":
+			field = "year"
+		}
+		if _, seen := fields[field]; !seen {
+			fields[field] = strings.TrimSpace(value)
+		}
+	}
+	return audioFromFields(fields)
+}
+
+// audioFromFields builds the audio data of the tagged fields, or returns errNoAudioTags when none are set.
+func audioFromFields(fields map[string]string) (*AudioData, error) {
+	audio := &AudioData{
+		Artist:      fields["artist"],
+		AlbumArtist: fields["albumartist"],
+		Album:       fields["album"],
+		Title:       fields["title"],
+	}
+	// Track numbers may include the number of tracks, e.g. "3/12"
+	if track, _, _ := strings.Cut(fields["track"], "/"); track != "" {
+		audio.Track, _ = strconv.Atoi(strings.TrimSpace(track))
+	}
+	// Dates may be full dates, e.g. "2019-05-03"
+	if year := fields["year"]; len(year) >= 4 {
+		audio.Year, _ = strconv.Atoi(year[:4])
+	}
+
+	if *audio == (AudioData{}) {
+		return nil, errNoAudioTags
+	}
+	return audio, nil
+}
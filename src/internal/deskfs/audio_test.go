@@ -0,0 +1,197 @@
+package deskfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func syncsafeBytes(size int) []byte {
+	return []byte{byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+}
+
+// buildID3v2 returns an MP3 whose ID3v2 tag of the given version holds the text frames, in UTF-16 for
+// ID3v2.3 and UTF-8 for ID3v2.4.
+func buildID3v2(version byte, frames map[string]string) []byte {
+	var tag bytes.Buffer
+	for id, text := range frames {
+		var payload []byte
+		if version == 3 {
+			payload = []byte{1, 0xFF, 0xFE}
+			for _, unit := range utf16.Encode([]rune(text)) {
+				payload = binary.LittleEndian.AppendUint16(payload, unit)
+			}
+		} else {
+			payload = append([]byte{3}, text...)
+		}
+
+		tag.WriteString(id)
+		if version == 3 {
+			binary.Write(&tag, binary.BigEndian, uint32(len(payload)))
+		} else {
+			tag.Write(syncsafeBytes(len(payload)))
+		}
+		tag.Write([]byte{0, 0})
+		tag.Write(payload)
+	}
+	tag.Write(make([]byte, 16)) // Padding
+
+	header := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafeBytes(tag.Len())...)
+	return append(append(header, tag.Bytes()...), 0xFF, 0xFB, 0x90, 0x00)
+}
+
+// buildID3v1 returns an MP3 with only an ID3v1.1 tag
+func buildID3v1(title, artist, album, year string, track byte) []byte {
+	field := func(value string, size int) []byte {
+		return append([]byte(value), make([]byte, size-len(value))...)
+	}
+	tag := append([]byte("TAG"), field(title, 30)...)
+	tag = append(tag, field(artist, 30)...)
+	tag = append(tag, field(album, 30)...)
+	tag = append(tag, field(year, 4)...)
+	tag = append(tag, make([]byte, 28)...)
+	tag = append(tag, 0, track, 0xFF)
+	return append(make([]byte, 64), tag...)
+}
+
+// vorbisComments encodes a Vorbis comment structure
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	writeString := func(value string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.WriteString(value)
+	}
+	writeString("test vendor")
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		writeString(comment)
+	}
+	return b.Bytes()
+}
+
+// buildFLAC returns a FLAC file whose comment block follows its stream info
+func buildFLAC(comments ...string) []byte {
+	block := vorbisComments(comments...)
+	data := append([]byte("fLaC"), 0x00, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	data = append(data, 0x84, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+	return append(data, block...)
+}
+
+// buildOgg returns an Ogg Vorbis stream with one packet per page, the comment header being the second
+func buildOgg(comments ...string) []byte {
+	var b bytes.Buffer
+	for _, packet := range [][]byte{[]byte("\x01vorbis" + string(make([]byte, 23))), append([]byte("\x03vorbis"), vorbisComments(comments...)...)} {
+		var segments []byte
+		for rest := len(packet); ; rest -= 255 {
+			if rest < 255 {
+				segments = append(segments, byte(rest))
+				break
+			}
+			segments = append(segments, 255)
+		}
+		b.WriteString("OggS")
+		b.Write(make([]byte, 22))
+		b.WriteByte(byte(len(segments)))
+		b.Write(segments)
+		b.Write(packet)
+	}
+	return b.Bytes()
+}
+
+func TestReadAudioTags(t *testing.T) {
+	dir := t.TempDir()
+	expected := &AudioData{Artist: "Sigur Rós", Album: "Ágætis byrjun", Title: "Svefn-g-englar", Track: 2, Year: 1999}
+	frames := map[string]string{"TPE1": "Sigur Rós", "TALB": "Ágætis byrjun", "TIT2": "Svefn-g-englar", "TRCK": "2/10"}
+	v23, v24 := map[string]string{"TYER": "1999"}, map[string]string{"TDRC": "1999-06-12"}
+	for id, text := range frames {
+		v23[id], v24[id] = text, text
+	}
+	comments := []string{"ARTIST=Sigur Rós", "album=Ágætis byrjun", "TITLE=Svefn-g-englar", "TRACKNUMBER=2", "DATE=1999-06-12"}
+	// A long comment spans several Ogg segments
+	longComments := append(comments, "LYRICS="+string(bytes.Repeat([]byte("a"), 600)))
+
+	files := map[string][]byte{
+		"v23.mp3":   buildID3v2(3, v23),
+		"v24.mp3":   buildID3v2(4, v24),
+		"v1.mp3":    buildID3v1("Svefn-g-englar", "Sigur Ros", "Agaetis byrjun", "1999", 2),
+		"song.flac": buildFLAC(comments...),
+		"song.ogg":  buildOgg(longComments...),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+
+		audio, err := ReadAudioTags(path)
+		assert.NoError(t, err, name)
+		if name == "v1.mp3" {
+			assert.Equal(t, &AudioData{Artist: "Sigur Ros", Album: "Agaetis byrjun", Title: "Svefn-g-englar", Track: 2, Year: 1999}, audio, name)
+			continue
+		}
+		assert.Equal(t, expected, audio, name)
+	}
+
+	// Audio files without tags, and other files, have none
+	for name, content := range map[string][]byte{"plain.mp3": {0xFF, 0xFB, 0x90, 0x00}, "plain.flac": buildFLAC(), "notes.txt": []byte("text")} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+		audio, err := ReadAudioTags(path)
+		assert.NoError(t, err, name)
+		assert.Nil(t, audio, name)
+	}
+}
+
+func TestOrganizeMusicByTags(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/track02.mp3":  string(buildID3v2(4, map[string]string{"TPE1": "AC/DC", "TALB": "Back in Black", "TIT2": "Shoot to Thrill", "TRCK": "2"})),
+		"source/b.flac":       string(buildFLAC("ARTIST=Nina Simone", "ALBUM=Pastel Blues", "TITLE=Sinnerman?", "TRACKNUMBER=9")),
+		"source/untagged.mp3": "audio",
+		"config.toml": `file_types = { "Music" = [".mp3", ".flac"] }
+
+[[rules]]
+name = "music"
+destination = "Music/{{.Audio.Artist}}/{{.Audio.Album}}/{{.Audio.Track}} - {{.Audio.Title}}"
+extensions = [".mp3", ".flac"]
+`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	params := &FilePathParams{SourceDir: source, TargetDir: source, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(source, "Music", "AC-DC", "Back in Black", "02 - Shoot to Thrill.mp3"))
+	assert.FileExists(t, filepath.Join(source, "Music", "Nina Simone", "Pastel Blues", "09 - Sinnerman-.flac"))
+	assert.FileExists(t, filepath.Join(source, "Music", "Unknown Artist", "Unknown Album", "00 - untagged.mp3"))
+}
+
+func TestRuleDestination(t *testing.T) {
+	for _, rule := range []Rule{
+		{Name: "both", Target: "Music", Destination: "Music/{{.Name}}"},
+		{Name: "archive", Action: RuleArchive, Destination: "Music/{{.Name}}"},
+		{Name: "unknown", Destination: "Music/{{.Audio.Genre}}"},
+	} {
+		assert.Error(t, rule.compile(), rule.Name)
+	}
+
+	rule := Rule{Name: "escape", Destination: "../{{.Audio.Title}}"}
+	assert.NoError(t, rule.compile())
+	_, _, err := rule.DestinationFor(&FileNode{Name: "a.mp3", Metadata: Metadata{NodeType: "file", Audio: &AudioData{Title: ".."}}})
+	assert.Error(t, err)
+
+	rule = Rule{Name: "music", Destination: "Music/{{.Audio.AlbumArtist}}/{{.Audio.Year}}/{{.Audio.Title}}"}
+	assert.NoError(t, rule.compile())
+	target, name, err := rule.DestinationFor(&FileNode{Name: "a.MP3", Metadata: Metadata{NodeType: "file", Audio: &AudioData{Artist: "Guest", AlbumArtist: "Various: Artists", Title: "Intro*", Year: 2001}}})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("Music", "Various- Artists", "2001"), target)
+	assert.Equal(t, "Intro-.MP3", name)
+}
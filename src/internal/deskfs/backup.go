@@ -0,0 +1,405 @@
+package deskfs
+
+import (
+	"crypto/sha256"
+	"desktop-cleaner/internal/db"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BackupManifestVersion is the version of the backup manifest. Backups of a newer version are refused.
+const BackupManifestVersion = 1
+
+const (
+	backupManifestName  = "manifest.json"
+	backupCentralName   = "central.db"
+	backupWorkspacesDir = "workspaces"
+	backupTimeFormat    = "20060102-150405"
+)
+
+// DefaultBackupDir is the directory backups are written to and rotated in
+var DefaultBackupDir = filepath.Join(DefaultConfigPath, "backups")
+
+type BackupScope string
+
+const (
+	BackupAll       BackupScope = "all"       // The central database and every workspace database
+	BackupCentral   BackupScope = "central"   // The central database only
+	BackupWorkspace BackupScope = "workspace" // A single workspace database
+)
+
+func ParseBackupScope(value string) (BackupScope, error) {
+	switch scope := BackupScope(value); scope {
+	case BackupAll, BackupCentral, BackupWorkspace:
+		return scope, nil
+	}
+	return "", fmt.Errorf("invalid backup scope %q, expected all, central or workspace", value)
+}
+
+type BackupEntryKind string
+
+const (
+	BackupEntryCentral   BackupEntryKind = "central"
+	BackupEntryWorkspace BackupEntryKind = "workspace"
+)
+
+// BackupEntry is a database snapshot of a backup.
+type BackupEntry struct {
+	Kind        BackupEntryKind `json:"kind"`
+	WorkspaceID int             `json:"workspace_id,omitempty"`
+	RootPath    string          `json:"root_path,omitempty"` // Root directory of the workspace
+	File        string          `json:"file"`                // Path of the snapshot, relative to the backup directory
+	Size        int64           `json:"size"`
+	SHA256      string          `json:"sha256"`
+}
+
+// BackupManifest describes a backup and the checksums of its snapshots.
+type BackupManifest struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	CreatedBy string        `json:"created_by"`
+	Scope     BackupScope   `json:"scope"`
+	Entries   []BackupEntry `json:"entries"`
+}
+
+// Backup is a backup directory and its manifest.
+type Backup struct {
+	Dir      string
+	Manifest *BackupManifest
+	Warnings []string
+}
+
+// RestoreOptions selects the snapshots of a backup to restore. Zero options restore every snapshot.
+type RestoreOptions struct {
+	CentralOnly bool
+	WorkspaceID int
+	CentralPath string // Path of the central database to replace
+}
+
+// Backup snapshots the databases of scope into a new timestamped directory of backupRoot. With BackupAll,
+// workspaces whose database cannot be opened are skipped with a warning rather than failing the backup.
+func (wm *WorkspaceManager) Backup(backupRoot string, scope BackupScope, workspaceID int) (*Backup, error) {
+	now := time.Now()
+	dir, err := createBackupDir(backupRoot, now)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		Dir:      dir,
+		Manifest: &BackupManifest{Version: BackupManifestVersion, CreatedAt: now, CreatedBy: currentUserName(), Scope: scope},
+	}
+	if err := wm.backupInto(backup, scope, workspaceID); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(backup.Manifest, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, backupManifestName), data, 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	slog.Debug(fmt.Sprintf("Backup of %s written to %s\n", scope, dir))
+	return backup, nil
+}
+
+func (wm *WorkspaceManager) backupInto(backup *Backup, scope BackupScope, workspaceID int) error {
+	if scope == BackupAll || scope == BackupCentral {
+		if err := wm.centralDB.Backup(filepath.Join(backup.Dir, backupCentralName)); err != nil {
+			return fmt.Errorf("failed to back up the central database: %w", err)
+		}
+		if err := backup.addEntry(BackupEntry{Kind: BackupEntryCentral, File: backupCentralName}); err != nil {
+			return err
+		}
+	}
+
+	var workspaceIDs []int
+	switch scope {
+	case BackupWorkspace:
+		workspaceIDs = []int{workspaceID}
+	case BackupAll:
+		workspaces, err := wm.ListWorkspaces()
+		if err != nil {
+			return err
+		}
+		for _, workspace := range workspaces {
+			workspaceIDs = append(workspaceIDs, workspace.ID)
+		}
+	}
+
+	for _, id := range workspaceIDs {
+		err := wm.backupWorkspace(backup, id)
+		if err != nil && scope == BackupAll {
+			backup.Warnings = append(backup.Warnings, fmt.Sprintf("skipped workspace %d: %v", id, err))
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wm *WorkspaceManager) backupWorkspace(backup *Backup, workspaceID int) error {
+	workspacePath, err := wm.centralDB.GetWorkspacePath(workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to find workspace %d: %v", workspaceID, err)
+	}
+	// Opening the store would create a missing database, which is not worth backing up
+	if _, err := os.Stat(filepath.Join(workspacePath, "workspace.db")); err != nil {
+		return fmt.Errorf("workspace database not found: %v", err)
+	}
+
+	store, rootPath, err := wm.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	file := filepath.Join(backupWorkspacesDir, strconv.Itoa(workspaceID), "workspace.db")
+	if err := store.Backup(filepath.Join(backup.Dir, file)); err != nil {
+		return fmt.Errorf("failed to back up workspace %d: %w", workspaceID, err)
+	}
+	return backup.addEntry(BackupEntry{Kind: BackupEntryWorkspace, WorkspaceID: workspaceID, RootPath: rootPath, File: file})
+}
+
+// addEntry checksums the snapshot of an entry and adds it to the manifest.
+func (backup *Backup) addEntry(entry BackupEntry) error {
+	size, sum, err := checksumFile(filepath.Join(backup.Dir, entry.File))
+	if err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", entry.File, err)
+	}
+	entry.Size, entry.SHA256 = size, sum
+	backup.Manifest.Entries = append(backup.Manifest.Entries, entry)
+	return nil
+}
+
+// createBackupDir creates a directory named after the backup time, suffixed when it already exists.
+func createBackupDir(backupRoot string, now time.Time) (string, error) {
+	if err := os.MkdirAll(backupRoot, 0700); err != nil {
+		return "", fmt.Errorf("could not create backup directory: %v", err)
+	}
+
+	name := now.Format(backupTimeFormat)
+	for i := 1; ; i++ {
+		dir := filepath.Join(backupRoot, name)
+		if err := os.Mkdir(dir, 0700); err == nil {
+			return dir, nil
+		} else if !os.IsExist(err) {
+			return "", fmt.Errorf("could not create backup directory: %v", err)
+		}
+		name = fmt.Sprintf("%s-%d", now.Format(backupTimeFormat), i)
+	}
+}
+
+func checksumFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReadBackup reads the manifest of a backup directory.
+func ReadBackup(dir string) (*Backup, error) {
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a backup: %w", dir, err)
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode backup manifest: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > BackupManifestVersion {
+		return nil, fmt.Errorf("unsupported backup manifest version %d", manifest.Version)
+	}
+	return &Backup{Dir: dir, Manifest: &manifest}, nil
+}
+
+// ListBackups returns the backups of backupRoot, oldest first. Directories without a valid manifest are ignored.
+func ListBackups(backupRoot string) ([]*Backup, error) {
+	entries, err := os.ReadDir(backupRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var backups []*Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		backup, err := ReadBackup(filepath.Join(backupRoot, entry.Name()))
+		if err != nil {
+			slog.Debug(fmt.Sprintf("Skipping %s: %v\n", entry.Name(), err))
+			continue
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Manifest.CreatedAt.Before(backups[j].Manifest.CreatedAt)
+	})
+	return backups, nil
+}
+
+// RotateBackups removes the oldest backups of backupRoot, keeping the newest keep backups.
+// A keep of zero or less keeps every backup.
+func RotateBackups(backupRoot string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	backups, err := ListBackups(backupRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i := 0; i < len(backups)-keep; i++ {
+		if err := os.RemoveAll(backups[i].Dir); err != nil {
+			return removed, fmt.Errorf("failed to remove backup %s: %w", backups[i].Dir, err)
+		}
+		removed = append(removed, backups[i].Dir)
+	}
+	return removed, nil
+}
+
+// Select returns the entries of the backup matching the restore options.
+func (backup *Backup) Select(opts RestoreOptions) ([]BackupEntry, error) {
+	var entries []BackupEntry
+	for _, entry := range backup.Manifest.Entries {
+		switch {
+		case opts.CentralOnly && entry.Kind != BackupEntryCentral:
+		case opts.WorkspaceID > 0 && (entry.Kind != BackupEntryWorkspace || entry.WorkspaceID != opts.WorkspaceID):
+		default:
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("backup %s has nothing to restore for the selection", backup.Dir)
+	}
+	return entries, nil
+}
+
+// Verify checks the size, checksum and integrity of the snapshots of entries.
+func (backup *Backup) Verify(entries []BackupEntry) error {
+	for _, entry := range entries {
+		path, err := safeJoin(backup.Dir, entry.File)
+		if err != nil {
+			return err
+		}
+		size, sum, err := checksumFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", entry.File, err)
+		}
+		if size != entry.Size || sum != entry.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s, the backup is corrupted", entry.File)
+		}
+		if err := db.CheckIntegrity(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreBackup verifies the selected snapshots of a backup, then replaces the live databases with them.
+// Workspaces are restored to their root directory as recorded in the backup. Restoring the central
+// database closes the central store, which cannot be used afterwards.
+func (wm *WorkspaceManager) RestoreBackup(backup *Backup, opts RestoreOptions) ([]string, error) {
+	entries, err := backup.Select(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := backup.Verify(entries); err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	var central *BackupEntry
+	for i, entry := range entries {
+		if entry.Kind == BackupEntryCentral {
+			central = &entries[i]
+			continue
+		}
+
+		warning, err := wm.restoreWorkspace(backup, entry, !opts.CentralOnly && opts.WorkspaceID == 0 && backup.hasCentral())
+		if err != nil {
+			return warnings, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	// The central database is restored last, workspaces are looked up while it is still open
+	if central != nil {
+		if opts.CentralPath == "" {
+			return warnings, fmt.Errorf("path of the central database is required")
+		}
+		if err := wm.centralDB.Close(); err != nil {
+			return warnings, fmt.Errorf("failed to close the central database: %w", err)
+		}
+		if err := db.RestoreDatabase(filepath.Join(backup.Dir, central.File), opts.CentralPath); err != nil {
+			return warnings, fmt.Errorf("failed to restore the central database: %w", err)
+		}
+	}
+	return warnings, nil
+}
+
+// restoreWorkspace restores the database of a workspace, registering the workspace again when it was
+// deleted and the central database is not restored along with it.
+func (wm *WorkspaceManager) restoreWorkspace(backup *Backup, entry BackupEntry, centralRestored bool) (string, error) {
+	if info, err := os.Stat(entry.RootPath); err != nil || !info.IsDir() {
+		return fmt.Sprintf("skipped workspace %d: root directory %s not found", entry.WorkspaceID, entry.RootPath), nil
+	}
+
+	workspacePath := createWorkspacePath(entry.RootPath)
+	if err := os.MkdirAll(workspacePath, 0755); err != nil {
+		return "", fmt.Errorf("could not create workspace directory: %v", err)
+	}
+	if err := db.RestoreDatabase(filepath.Join(backup.Dir, entry.File), filepath.Join(workspacePath, "workspace.db")); err != nil {
+		return "", fmt.Errorf("failed to restore workspace %d: %w", entry.WorkspaceID, err)
+	}
+
+	if centralRestored {
+		return "", nil
+	}
+	if _, err := wm.centralDB.GetWorkspaceID(workspacePath); err == nil {
+		return "", nil
+	}
+	workspaceID, err := wm.centralDB.AddWorkspace(workspacePath, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to register workspace %s: %w", entry.RootPath, err)
+	}
+	return fmt.Sprintf("workspace %d at %s was no longer registered, registered as workspace %d without its config", entry.WorkspaceID, entry.RootPath, workspaceID), nil
+}
+
+func (backup *Backup) hasCentral() bool {
+	for _, entry := range backup.Manifest.Entries {
+		if entry.Kind == BackupEntryCentral {
+			return true
+		}
+	}
+	return false
+}
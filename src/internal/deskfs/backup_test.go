@@ -0,0 +1,91 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	backupRoot := t.TempDir()
+	rootPath := t.TempDir()
+
+	centralDB, err := db.NewCentralDBProvider()
+	assert.NoError(t, err)
+	defer centralDB.Close()
+	wm := NewWorkspaceManager(centralDB, assertlib.NewAssertHandler())
+
+	id, err := wm.CreateWorkspace(rootPath, "")
+	assert.NoError(t, err)
+	store, _, err := wm.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	assert.NoError(t, store.UpsertFiles([]db.FileRecord{{Path: filepath.Join(rootPath, "a.txt")}}))
+	assert.NoError(t, store.Close())
+
+	backup, err := wm.Backup(backupRoot, BackupAll, 0)
+	assert.NoError(t, err)
+	assert.Len(t, backup.Manifest.Entries, 2)
+	assert.FileExists(t, filepath.Join(backup.Dir, backupManifestName))
+
+	read, err := ReadBackup(backup.Dir)
+	assert.NoError(t, err)
+	entries, err := read.Select(RestoreOptions{WorkspaceID: id})
+	assert.NoError(t, err)
+	assert.NoError(t, read.Verify(entries))
+
+	// Restoring a deleted workspace registers it again
+	assert.NoError(t, wm.DeleteWorkspace(id))
+	warnings, err := wm.RestoreBackup(read, RestoreOptions{WorkspaceID: id})
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	restoredID, err := wm.FindWorkspaceID(rootPath)
+	assert.NoError(t, err)
+	store, _, err = wm.OpenWorkspaceDB(restoredID)
+	assert.NoError(t, err)
+	records, err := store.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.NoError(t, store.Close())
+
+	// A tampered snapshot is refused before anything is restored
+	snapshot := filepath.Join(backup.Dir, entries[0].File)
+	assert.NoError(t, os.WriteFile(snapshot, []byte("tampered"), 0644))
+	_, err = wm.RestoreBackup(read, RestoreOptions{WorkspaceID: id})
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestRotateBackups(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	backupRoot := t.TempDir()
+
+	centralDB, err := db.NewCentralDBProvider()
+	assert.NoError(t, err)
+	defer centralDB.Close()
+	wm := NewWorkspaceManager(centralDB, assertlib.NewAssertHandler())
+
+	var dirs []string
+	for i := 0; i < 3; i++ {
+		backup, err := wm.Backup(backupRoot, BackupCentral, 0)
+		assert.NoError(t, err)
+		dirs = append(dirs, backup.Dir)
+	}
+	// Directories without a manifest are not backups and are never removed
+	assert.NoError(t, os.Mkdir(filepath.Join(backupRoot, "other"), 0755))
+
+	removed, err := RotateBackups(backupRoot, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, dirs[:1], removed)
+	assert.NoDirExists(t, dirs[0])
+	assert.DirExists(t, dirs[2])
+	assert.DirExists(t, filepath.Join(backupRoot, "other"))
+
+	backups, err := ListBackups(backupRoot)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 2)
+}
@@ -0,0 +1,453 @@
+package deskfs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"desktop-cleaner/internal/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BundleFormatVersion is the version of the workspace bundle layout. Bundles of a newer version are refused.
+// Version 2 added the user tags.
+const BundleFormatVersion = 2
+
+const (
+	bundleManifestName = "manifest.json"
+	bundleConfigName   = "config.toml"
+	bundleFilesName    = "index/files.json"
+	bundleHistoryName  = "history.json"
+	bundleTagsName     = "tags.json"
+	bundleIgnoreDir    = "ignore/"
+	ignoreFileName     = ".desktop-cleaner-ignore"
+	// maxBundleEntrySize bounds the size of a single bundle entry read into memory on import
+	maxBundleEntrySize = 1 << 30
+)
+
+// BundleManifest describes a workspace bundle.
+type BundleManifest struct {
+	FormatVersion int       `json:"format_version"`
+	WorkspaceID   int       `json:"workspace_id"`
+	RootPath      string    `json:"root_path"` // Root directory of the exported workspace, rewritten on import
+	ExportedAt    time.Time `json:"exported_at"`
+	ExportedBy    string    `json:"exported_by"`
+	Files         int       `json:"files"`
+	HistoryEvents int       `json:"history_events"`
+	TaggedFiles   int       `json:"tagged_files"`
+	IgnoreFiles   []string  `json:"ignore_files,omitempty"` // Paths of the ignore files, relative to the root directory
+}
+
+// ImportResult is the outcome of importing a workspace bundle.
+type ImportResult struct {
+	WorkspaceID int
+	RootPath    string
+	Manifest    BundleManifest
+	Warnings    []string
+}
+
+// bundle is the content of a workspace bundle.
+type bundle struct {
+	manifest BundleManifest
+	config   string
+	files    []db.FileRecord
+	history  []db.HistoryEvent
+	tagged   []db.TaggedFile
+	ignore   map[string][]byte
+}
+
+// ExportWorkspace writes a portable tar.gz bundle of a workspace to outPath: its config, its file index
+// with tags, its history, its user tags and its ignore files. Directory scan state is machine specific and not exported.
+func (wm *WorkspaceManager) ExportWorkspace(workspaceID int, outPath string) (*BundleManifest, error) {
+	workspace, err := wm.GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	store, rootPath, err := wm.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	files, err := store.ListFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the file index: %w", err)
+	}
+	history, err := store.ListHistory(db.HistoryFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history: %w", err)
+	}
+	// Oldest first, so that imported events keep their order
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	tagged, err := store.ListTaggedFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the user tags: %w", err)
+	}
+
+	ignore, err := findIgnoreFiles(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundle{
+		manifest: BundleManifest{
+			FormatVersion: BundleFormatVersion,
+			WorkspaceID:   workspaceID,
+			RootPath:      rootPath,
+			ExportedAt:    time.Now(),
+			ExportedBy:    currentUserName(),
+			Files:         len(files),
+			HistoryEvents: len(history),
+			TaggedFiles:   len(tagged),
+		},
+		config:  workspace.Config,
+		files:   files,
+		history: history,
+		tagged:  tagged,
+		ignore:  ignore,
+	}
+	for name := range ignore {
+		b.manifest.IgnoreFiles = append(b.manifest.IgnoreFiles, name)
+	}
+	sort.Strings(b.manifest.IgnoreFiles)
+
+	// Write to a temporary file first, so that a failed export never leaves a truncated bundle behind
+	tmpPath := outPath + ".tmp"
+	if err := writeBundle(tmpPath, b); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	slog.Debug(fmt.Sprintf("Exported workspace %d to %s\n", workspaceID, outPath))
+	return &b.manifest, nil
+}
+
+// ImportWorkspace registers the workspace of a bundle at rootPath, rewriting the paths of its index,
+// history and user tags from the exported root directory to rootPath. Existing ignore files are never overwritten.
+func (wm *WorkspaceManager) ImportWorkspace(bundlePath, rootPath string) (*ImportResult, error) {
+	rootPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(rootPath); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("root path %s is not a directory", rootPath)
+	}
+	if id, err := wm.FindWorkspaceID(rootPath); err == nil {
+		return nil, fmt.Errorf("%s is already workspace %d", rootPath, id)
+	}
+
+	b, err := readBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseWorkspaceConfig(b.config); err != nil {
+		return nil, fmt.Errorf("bundle has an invalid config: %w", err)
+	}
+
+	workspaceID, err := wm.CreateWorkspace(rootPath, b.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{WorkspaceID: workspaceID, RootPath: rootPath, Manifest: b.manifest}
+	if err := wm.importData(workspaceID, b, rootPath); err != nil {
+		if deleteErr := wm.DeleteWorkspace(workspaceID); deleteErr != nil {
+			slog.Warn(fmt.Sprintf("Failed to remove partially imported workspace %d: %v\n", workspaceID, deleteErr))
+		}
+		return nil, err
+	}
+
+	for name, data := range b.ignore {
+		target, err := safeJoin(rootPath, name)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			continue
+		}
+		if _, err := os.Lstat(target); err == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("kept existing %s", target))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to restore %s: %v", target, err))
+			continue
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to restore %s: %v", target, err))
+		}
+	}
+
+	slog.Debug(fmt.Sprintf("Imported workspace %d from %s at %s\n", workspaceID, bundlePath, rootPath))
+	return result, nil
+}
+
+// importData stores the index, history and user tags of a bundle in the store of a workspace.
+func (wm *WorkspaceManager) importData(workspaceID int, b *bundle, rootPath string) error {
+	store, _, err := wm.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	oldRoot := b.manifest.RootPath
+	for i := range b.files {
+		record := &b.files[i]
+		record.ID = 0
+		record.Path = rebasePath(record.Path, oldRoot, rootPath)
+		record.Metadata = rebaseMetadata(record.Metadata, oldRoot, rootPath)
+		// Inodes only identify files on the exporting machine, keeping them would fake renames
+		record.Inode, record.Device = 0, 0
+	}
+	if err := store.UpsertFiles(b.files); err != nil {
+		return fmt.Errorf("failed to import the file index: %w", err)
+	}
+
+	for _, event := range b.history {
+		event.ID = 0
+		event.Payload = rebasePayload(event.Payload, oldRoot, rootPath)
+		if _, err := store.AddHistoryEvent(event); err != nil {
+			return fmt.Errorf("failed to import the history: %w", err)
+		}
+	}
+
+	// Tagged files are then only known by their path, until a scan finds them and mirrors their tags
+	for _, file := range b.tagged {
+		file.ID = 0
+		file.Path = rebasePath(file.Path, oldRoot, rootPath)
+		file.Inode, file.Device, file.Xattr = 0, 0, ""
+		if _, err := store.SaveTaggedFile(file); err != nil {
+			return fmt.Errorf("failed to import the user tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebasePath moves a path inside oldRoot to the same relative location inside newRoot.
+func rebasePath(p, oldRoot, newRoot string) string {
+	if oldRoot == "" || !isSameOrAncestor(oldRoot, p) {
+		return p
+	}
+	rel, err := filepath.Rel(oldRoot, p)
+	if err != nil {
+		return p
+	}
+	return filepath.Join(newRoot, rel)
+}
+
+func rebaseMetadata(data []byte, oldRoot, newRoot string) []byte {
+	var metadata Metadata
+	if len(data) == 0 || json.Unmarshal(data, &metadata) != nil || len(metadata.Relationships) == 0 {
+		return data
+	}
+	for i := range metadata.Relationships {
+		metadata.Relationships[i].RelatedNode = rebasePath(metadata.Relationships[i].RelatedNode, oldRoot, newRoot)
+	}
+	rebased, err := json.Marshal(metadata)
+	if err != nil {
+		return data
+	}
+	return rebased
+}
+
+func rebasePayload(data []byte, oldRoot, newRoot string) []byte {
+	var payload HistoryPayload
+	if len(data) == 0 || json.Unmarshal(data, &payload) != nil {
+		return data
+	}
+	for i := range payload.Results {
+		payload.Results[i].Source = rebasePath(payload.Results[i].Source, oldRoot, newRoot)
+		payload.Results[i].Destination = rebasePath(payload.Results[i].Destination, oldRoot, newRoot)
+	}
+	rebased, err := json.Marshal(payload)
+	if err != nil {
+		return data
+	}
+	return rebased
+}
+
+// findIgnoreFiles returns the ignore files of a workspace by path relative to its root directory.
+func findIgnoreFiles(rootPath string) (map[string][]byte, error) {
+	ignore := make(map[string][]byte)
+	err := filepath.WalkDir(rootPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != rootPath && d != nil && d.IsDir() {
+				slog.Debug(fmt.Sprintf("Skipping %s: %v\n", p, err))
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != rootPath && (d.Name() == DefaultConfigName || d.Name() == ".git") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != ignoreFileName || !d.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootPath, p)
+		if err != nil {
+			return err
+		}
+		ignore[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect ignore files: %w", err)
+	}
+	return ignore, nil
+}
+
+func writeBundle(outPath string, b *bundle) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gzw)
+
+	entries := []struct {
+		name  string
+		value any
+	}{
+		{bundleManifestName, b.manifest},
+		{bundleFilesName, b.files},
+		{bundleHistoryName, b.history},
+		{bundleTagsName, b.tagged},
+	}
+	for _, entry := range entries {
+		data, err := json.MarshalIndent(entry.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeBundleEntry(tw, entry.name, data, b.manifest.ExportedAt); err != nil {
+			return err
+		}
+	}
+	if err := writeBundleEntry(tw, bundleConfigName, []byte(b.config), b.manifest.ExportedAt); err != nil {
+		return err
+	}
+	for name, data := range b.ignore {
+		if err := writeBundleEntry(tw, bundleIgnoreDir+name, data, b.manifest.ExportedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func writeBundleEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// readBundle reads and validates a workspace bundle. Unknown entries are ignored.
+func readBundle(bundlePath string) (*bundle, error) {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a workspace bundle: %w", bundlePath, err)
+	}
+	defer gzr.Close()
+
+	b := &bundle{ignore: make(map[string][]byte)}
+	hasManifest := false
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle entry %s: %w", header.Name, err)
+		}
+		if len(data) > maxBundleEntrySize {
+			return nil, fmt.Errorf("bundle entry %s is too large", header.Name)
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case name == bundleManifestName:
+			err = json.Unmarshal(data, &b.manifest)
+			hasManifest = true
+		case name == bundleConfigName:
+			b.config = string(data)
+		case name == bundleFilesName:
+			err = json.Unmarshal(data, &b.files)
+		case name == bundleHistoryName:
+			err = json.Unmarshal(data, &b.history)
+		case name == bundleTagsName:
+			err = json.Unmarshal(data, &b.tagged)
+		case strings.HasPrefix(name, bundleIgnoreDir) && path.Base(name) == ignoreFileName:
+			b.ignore[strings.TrimPrefix(name, bundleIgnoreDir)] = data
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode bundle entry %s: %w", header.Name, err)
+		}
+	}
+
+	if !hasManifest {
+		return nil, errors.New("bundle has no manifest")
+	}
+	if b.manifest.FormatVersion < 1 || b.manifest.FormatVersion > BundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", b.manifest.FormatVersion)
+	}
+	return b, nil
+}
+
+// Summary formats the content of a bundle, e.g. "12 files, 3 history events, 2 tagged files, 1 ignore files".
+func (manifest *BundleManifest) Summary() string {
+	return fmt.Sprintf("%d files, %d history events, %d tagged files, %d ignore files",
+		manifest.Files, manifest.HistoryEvents, manifest.TaggedFiles, len(manifest.IgnoreFiles))
+}
@@ -0,0 +1,98 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportWorkspace(t *testing.T) {
+	source := t.TempDir()
+	target := t.TempDir()
+	bundlePath := filepath.Join(t.TempDir(), "ws.tar.gz")
+	wm := NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())
+
+	config := "[file_types]\nNotes = [\".md\"]\n"
+	id, err := wm.CreateWorkspace(source, config)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(source, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(source, ignoreFileName), []byte("*.tmp\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(source, "sub", ignoreFileName), []byte("*.log\n"), 0644))
+
+	store, _, err := wm.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	notePath := filepath.Join(source, "sub", "note.md")
+	assert.NoError(t, store.UpsertFiles([]db.FileRecord{{Path: notePath, Size: 5, Hash: "abc", Tags: []string{"work"}, Inode: 42, Device: 1}}))
+	payload := NewHistoryPayload("run-1")
+	payload.AddResult("move", filepath.Join(source, "note.md"), notePath, nil)
+	data, _ := json.Marshal(payload)
+	_, err = store.AddHistoryEvent(db.HistoryEvent{Type: string(EventOrganize), RunID: "run-1", Payload: data})
+	assert.NoError(t, err)
+	_, err = store.SaveTaggedFile(db.TaggedFile{Path: notePath, Inode: 42, Device: 1, Tags: []string{"important", "project-x"}})
+	assert.NoError(t, err)
+
+	manifest, err := wm.ExportWorkspace(id, bundlePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, manifest.Files)
+	assert.Equal(t, 1, manifest.HistoryEvents)
+	assert.Equal(t, 1, manifest.TaggedFiles)
+	assert.Equal(t, []string{ignoreFileName, "sub/" + ignoreFileName}, manifest.IgnoreFiles)
+	assert.NoFileExists(t, bundlePath+".tmp")
+
+	// The ignore file of the target is kept
+	assert.NoError(t, os.WriteFile(filepath.Join(target, ignoreFileName), []byte("keep\n"), 0644))
+
+	result, err := wm.ImportWorkspace(bundlePath, target)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, result.WorkspaceID)
+	assert.Len(t, result.Warnings, 1)
+
+	workspace, err := wm.GetWorkspace(result.WorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, target, workspace.RootPath)
+	assert.Equal(t, config, workspace.Config)
+
+	imported, _, err := wm.OpenWorkspaceDB(result.WorkspaceID)
+	assert.NoError(t, err)
+	records, err := imported.ListFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, filepath.Join(target, "sub", "note.md"), records[0].Path)
+		assert.Equal(t, []string{"work"}, records[0].Tags)
+		assert.Equal(t, "abc", records[0].Hash)
+		assert.Zero(t, records[0].Inode)
+	}
+
+	events, err := imported.ListHistory(db.HistoryFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		parsed, err := ParseHistoryPayload(events[0])
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(target, "note.md"), parsed.Results[0].Source)
+		assert.Equal(t, filepath.Join(target, "sub", "note.md"), parsed.Results[0].Destination)
+	}
+
+	tagged, err := imported.ListTaggedFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, tagged, 1) {
+		assert.Equal(t, filepath.Join(target, "sub", "note.md"), tagged[0].Path)
+		assert.Equal(t, []string{"important", "project-x"}, tagged[0].Tags)
+		assert.Zero(t, tagged[0].Inode)
+	}
+
+	kept, err := os.ReadFile(filepath.Join(target, ignoreFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, "keep\n", string(kept))
+	restored, err := os.ReadFile(filepath.Join(target, "sub", ignoreFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, "*.log\n", string(restored))
+
+	// A root path can only hold one workspace
+	_, err = wm.ImportWorkspace(bundlePath, target)
+	assert.Error(t, err)
+}
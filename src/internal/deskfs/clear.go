@@ -0,0 +1,326 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+type ClearScope string
+
+const (
+	ClearCache     ClearScope = "cache"     // The contents of the cache directory, including the undo journals
+	ClearData      ClearScope = "data"      // The index, text cache and history of a workspace, which stays registered with its user tags
+	ClearWorkspace ClearScope = "workspace" // A workspace: its registration and its database
+	ClearAllData   ClearScope = "all-data"  // The index, text cache and history of every workspace
+	ClearCentral   ClearScope = "central"   // The central database, forgetting every workspace
+	ClearAll       ClearScope = "all"       // Every workspace, the cache and the central database
+)
+
+func ParseClearScope(value string) (ClearScope, error) {
+	switch scope := ClearScope(value); scope {
+	case ClearCache, ClearData, ClearWorkspace, ClearAllData, ClearCentral, ClearAll:
+		return scope, nil
+	}
+	return "", fmt.Errorf("invalid clear scope %q, expected cache, data, workspace, all-data, central or all", value)
+}
+
+// ClearItem is a file, directory or set of database rows deleted by a clear.
+type ClearItem struct {
+	Path        string
+	Description string
+}
+
+// ClearPlan lists what a clear deletes, so that it can be previewed before it is executed.
+type ClearPlan struct {
+	Scope   ClearScope
+	Items   []ClearItem
+	actions []func() error
+}
+
+func (plan *ClearPlan) add(path, description string, action func() error) {
+	plan.Items = append(plan.Items, ClearItem{Path: path, Description: description})
+	plan.actions = append(plan.actions, action)
+}
+
+// Execute deletes the items of the plan, stopping at the first failure.
+func (plan *ClearPlan) Execute() error {
+	for i, action := range plan.actions {
+		if err := action(); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", plan.Items[i].Path, err)
+		}
+	}
+	return nil
+}
+
+// PlanClear lists what clearing scope deletes, without deleting anything. workspaceID selects the
+// workspace of the data and workspace scopes.
+func (dfs *DesktopFS) PlanClear(scope ClearScope, workspaceID int) (*ClearPlan, error) {
+	plan := &ClearPlan{Scope: scope}
+	wm := dfs.WorkspaceManager
+
+	var workspaceIDs []int
+	switch scope {
+	case ClearData, ClearWorkspace:
+		workspaceIDs = []int{workspaceID}
+	case ClearAllData, ClearAll:
+		workspaces, err := wm.ListWorkspaces()
+		if err != nil {
+			return nil, err
+		}
+		for _, workspace := range workspaces {
+			workspaceIDs = append(workspaceIDs, workspace.ID)
+		}
+	}
+
+	for _, id := range workspaceIDs {
+		var err error
+		if scope == ClearData || scope == ClearAllData {
+			err = wm.planClearData(plan, id)
+		} else {
+			err = wm.planClearWorkspace(plan, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scope == ClearCache || scope == ClearAll {
+		cacheDir := DefaultCacheDir
+		if dfs.InstanceConfig != nil && dfs.InstanceConfig.CacheDir != "" {
+			cacheDir = dfs.InstanceConfig.CacheDir
+		}
+		if err := planClearCache(plan, cacheDir, dfs.cacheProtectedPaths()); err != nil {
+			return nil, err
+		}
+	}
+
+	// The central database goes last, the workspaces are looked up in it
+	if scope == ClearCentral || scope == ClearAll {
+		if err := wm.planClearCentral(plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// workspaceDir returns the data directory of a workspace, refusing paths that are not a
+// .desktop_cleaner directory so that a corrupted registration never deletes user files.
+func (wm *WorkspaceManager) workspaceDir(workspaceID int) (string, error) {
+	workspacePath, err := wm.centralDB.GetWorkspacePath(workspaceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find workspace %d: %v", workspaceID, err)
+	}
+	if filepath.Base(workspacePath) != DefaultConfigName || !filepath.IsAbs(workspacePath) {
+		return "", fmt.Errorf("refusing to clear workspace %d, unexpected path %s", workspaceID, workspacePath)
+	}
+	if info, err := os.Lstat(workspacePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("refusing to clear workspace %d, %s is a symlink", workspaceID, workspacePath)
+	}
+	return workspacePath, nil
+}
+
+func (wm *WorkspaceManager) planClearData(plan *ClearPlan, workspaceID int) error {
+	workspacePath, err := wm.workspaceDir(workspaceID)
+	if err != nil {
+		return err
+	}
+	dbPath := filepath.Join(workspacePath, "workspace.db")
+	// Opening a missing database would create it
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	summary, err := wm.summarizeWorkspaceData(workspaceID)
+	if err != nil {
+		return err
+	}
+	description := fmt.Sprintf("index, text cache and history of workspace %d: %d files, %d directories, %d cached texts, %d history events",
+		workspaceID, summary.files, summary.dirs, summary.texts, summary.events)
+	if summary.taggedFiles > 0 {
+		description += fmt.Sprintf(" (the user tags of %d files are kept)", summary.taggedFiles)
+	}
+	plan.add(dbPath, description, func() error {
+		store, _, err := wm.OpenWorkspaceDB(workspaceID)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		return store.ClearData()
+	})
+	return nil
+}
+
+func (wm *WorkspaceManager) planClearWorkspace(plan *ClearPlan, workspaceID int) error {
+	workspacePath, err := wm.workspaceDir(workspaceID)
+	if err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("registration of workspace %d in the central database", workspaceID)
+	dbPath := filepath.Join(workspacePath, "workspace.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		summary, err := wm.summarizeWorkspaceData(workspaceID)
+		if err != nil {
+			return err
+		}
+		description = fmt.Sprintf("database and registration of workspace %d: %d files, %d directories, %d cached texts, %d history events, %d user tags on %d files",
+			workspaceID, summary.files, summary.dirs, summary.texts, summary.events, summary.tags, summary.taggedFiles)
+	}
+	plan.add(dbPath, description, func() error {
+		return wm.DeleteWorkspace(workspaceID)
+	})
+
+	for _, suffix := range []string{"-journal", "-wal", "-shm", ".restore"} {
+		path := dbPath + suffix
+		if _, err := os.Lstat(path); err == nil {
+			plan.add(path, "leftover database file", func() error {
+				return removeIfExists(path)
+			})
+		}
+	}
+
+	// Config files in the workspace directory are not ours to delete, the directory only goes when empty
+	plan.add(workspacePath, "workspace directory, if empty", func() error {
+		entries, err := os.ReadDir(workspacePath)
+		if os.IsNotExist(err) || len(entries) > 0 {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return removeIfExists(workspacePath)
+	})
+	return nil
+}
+
+// workspaceDataSummary counts the rows of a workspace database
+type workspaceDataSummary struct {
+	files, dirs, texts, events int
+	taggedFiles, tags          int
+}
+
+func (wm *WorkspaceManager) summarizeWorkspaceData(workspaceID int) (workspaceDataSummary, error) {
+	var summary workspaceDataSummary
+	store, _, err := wm.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		return summary, err
+	}
+	defer store.Close()
+
+	files, err := store.ListFiles()
+	if err != nil {
+		return summary, err
+	}
+	dirs, err := store.ListDirs()
+	if err != nil {
+		return summary, err
+	}
+	events, err := store.ListHistory(db.HistoryFilter{})
+	if err != nil {
+		return summary, err
+	}
+	if summary.texts, err = store.CountCachedTexts(); err != nil {
+		return summary, err
+	}
+	tagged, err := store.ListTaggedFiles()
+	if err != nil {
+		return summary, err
+	}
+	for _, file := range tagged {
+		summary.tags += len(file.Tags)
+	}
+	summary.files, summary.dirs, summary.events, summary.taggedFiles = len(files), len(dirs), len(events), len(tagged)
+	return summary, nil
+}
+
+// cacheProtectedPaths returns the paths that clearing the cache must never delete.
+func (dfs *DesktopFS) cacheProtectedPaths() []ClearItem {
+	protected := []ClearItem{
+		{Path: dfs.HomeDir, Description: "the home directory"},
+		{Path: DefaultBackupDir, Description: "the backups"},
+	}
+	if dfs.baseConfig != nil {
+		protected = append(protected, ClearItem{Path: dfs.baseConfig.path, Description: "the config file"})
+	}
+	if centralPath, err := db.CentralDBPath(); err == nil {
+		protected = append(protected, ClearItem{Path: centralPath, Description: "the central database"})
+	}
+	return protected
+}
+
+// planClearCache removes the entries of the cache directory, never the directory itself. Directories that
+// are or contain one of the protected paths are refused, in case the cache directory was misconfigured.
+func planClearCache(plan *ClearPlan, cacheDir string, protected []ClearItem) error {
+	cacheDir, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, item := range protected {
+		if item.Path == "" {
+			continue
+		}
+		path, err := filepath.Abs(item.Path)
+		if err != nil {
+			return err
+		}
+		if isSameOrAncestor(cacheDir, path) {
+			return fmt.Errorf("refusing to clear cache directory %s, it contains %s", cacheDir, item.Description)
+		}
+	}
+
+	info, err := os.Lstat(cacheDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("refusing to clear cache directory %s, it is not a directory", cacheDir)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(cacheDir, entry.Name())
+		plan.add(path, fmt.Sprintf("cache entry, %s", FormatSize(pathSize(path))), func() error {
+			return os.RemoveAll(path)
+		})
+	}
+	return nil
+}
+
+func (wm *WorkspaceManager) planClearCentral(plan *ClearPlan) error {
+	centralPath, err := db.CentralDBPath()
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := wm.ListWorkspaces()
+	if err != nil {
+		return err
+	}
+	plan.add(centralPath, fmt.Sprintf("central database: registrations of %d workspaces and settings", len(workspaces)), func() error {
+		if err := wm.centralDB.Close(); err != nil {
+			return err
+		}
+		for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+			if err := removeIfExists(centralPath + suffix); err != nil {
+				return err
+			}
+		}
+		slog.Debug(fmt.Sprintf("Central database %s removed\n", centralPath))
+		return nil
+	})
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClear(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cacheDir := filepath.Join(home, "cache")
+
+	centralDB, err := db.NewCentralDBProvider()
+	assert.NoError(t, err)
+	defer centralDB.Close()
+	dfs := &DesktopFS{
+		HomeDir:          home,
+		WorkspaceManager: NewWorkspaceManager(centralDB, assertlib.NewAssertHandler()),
+		InstanceConfig:   &DeskFSConfig{CacheDir: cacheDir},
+	}
+	wm := dfs.WorkspaceManager
+
+	withConfig := t.TempDir()
+	withoutConfig := t.TempDir()
+	id, err := wm.CreateWorkspace(withConfig, "")
+	assert.NoError(t, err)
+	otherID, err := wm.CreateWorkspace(withoutConfig, "")
+	assert.NoError(t, err)
+	configPath := filepath.Join(createWorkspacePath(withConfig), DefaultConfigName+".toml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("cache_dir = \"/tmp\"\n"), 0644))
+
+	store, _, err := wm.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	assert.NoError(t, store.UpsertFiles([]db.FileRecord{{Path: filepath.Join(withConfig, "a.txt"), Hash: "abc"}}))
+	assert.NoError(t, store.SaveCachedTexts([]db.CachedText{{Hash: "abc", MimeType: "text/plain", Text: "a"}}))
+	_, err = store.SaveTaggedFile(db.TaggedFile{Path: filepath.Join(withConfig, "a.txt"), Tags: []string{"important", "work"}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	t.Run("data keeps the workspace registered", func(t *testing.T) {
+		plan, err := dfs.PlanClear(ClearData, id)
+		assert.NoError(t, err)
+		if assert.Len(t, plan.Items, 1) {
+			assert.Contains(t, plan.Items[0].Description, "1 files")
+			assert.Contains(t, plan.Items[0].Description, "1 cached texts")
+			assert.Contains(t, plan.Items[0].Description, "the user tags of 1 files are kept")
+		}
+		assert.NoError(t, plan.Execute())
+
+		store, _, err := wm.OpenWorkspaceDB(id)
+		assert.NoError(t, err)
+		defer store.Close()
+		records, err := store.ListFiles()
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+		tagged, err := store.ListTaggedFiles()
+		assert.NoError(t, err)
+		assert.Len(t, tagged, 1)
+	})
+
+	t.Run("workspace keeps config files", func(t *testing.T) {
+		plan, err := dfs.PlanClear(ClearWorkspace, id)
+		assert.NoError(t, err)
+		if assert.NotEmpty(t, plan.Items) {
+			assert.Contains(t, plan.Items[0].Description, "2 user tags on 1 files")
+		}
+
+		for _, workspaceID := range []int{id, otherID} {
+			plan, err := dfs.PlanClear(ClearWorkspace, workspaceID)
+			assert.NoError(t, err)
+			assert.NoError(t, plan.Execute())
+		}
+
+		_, err = wm.FindWorkspaceID(withConfig)
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(createWorkspacePath(withConfig), "workspace.db"))
+		assert.FileExists(t, configPath)
+		assert.NoDirExists(t, createWorkspacePath(withoutConfig))
+	})
+
+	t.Run("cache keeps the cache directory", func(t *testing.T) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "journals"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(cacheDir, "journals", "run.json"), []byte("{}"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(cacheDir, "tree.cache"), []byte("cache"), 0644))
+
+		plan, err := dfs.PlanClear(ClearCache, 0)
+		assert.NoError(t, err)
+		assert.Len(t, plan.Items, 2)
+		assert.NoError(t, plan.Execute())
+
+		entries, err := os.ReadDir(cacheDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		// A misconfigured cache directory containing the home directory, the config file, the central
+		// database or the backups is refused
+		centralPath, err := db.CentralDBPath()
+		assert.NoError(t, err)
+		dfs.baseConfig = &IntermediateConfig{path: filepath.Join(home, "config", "desktop_cleaner.toml")}
+		for _, dir := range []string{filepath.Dir(home), filepath.Join(home, "config"), filepath.Dir(centralPath), DefaultBackupDir} {
+			dfs.InstanceConfig.CacheDir = dir
+			_, err = dfs.PlanClear(ClearCache, 0)
+			assert.Error(t, err, dir)
+		}
+		dfs.InstanceConfig.CacheDir = cacheDir
+	})
+
+	t.Run("central removes the central database", func(t *testing.T) {
+		centralPath, err := db.CentralDBPath()
+		assert.NoError(t, err)
+
+		plan, err := dfs.PlanClear(ClearCentral, 0)
+		assert.NoError(t, err)
+		assert.Len(t, plan.Items, 1)
+		assert.NoError(t, plan.Execute())
+		assert.NoFileExists(t, centralPath)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/ZanzyTHEbar/assert-lib"
 	gobaselogger "github.com/ZanzyTHEbar/go-basetools/logger"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -23,16 +24,27 @@ var (
 // Config holds the mapping of file types to extensions
 type DeskFSConfig struct {
 	gobaselogger.Config
-	DirectoryTree *DirectoryTree `toml:"directory_tree"`
-	FileTypeTree  *FileTypeTree  `toml:"file_type_tree"`
-	TargetDir     string         `toml:"target_dir"`
-	CacheDir      string         `toml:"cache_dir"`
+	DirectoryTree *DirectoryTree     `toml:"directory_tree"`
+	FileTypeTree  *FileTypeTree      `toml:"file_type_tree"`
+	TargetDir     string             `toml:"target_dir"`
+	CacheDir      string             `toml:"cache_dir"`
+	Trash         TrashConfig        `toml:"trash"`
+	Relationships RelationshipConfig `toml:"relationships"`
+	UserTags      UserTagsConfig     `toml:"user_tags"`
+	Rules         []*Rule            `toml:"-"`
+	TagRules      []*TagRule         `toml:"-"`
 }
 
 type IntermediateConfig struct {
 	gobaselogger.Config
-	FileTypes map[string][]string `toml:"file_types"` // Ensure TOML tag matches the file
-	CacheDir  string              `toml:"cache_dir"`
+	FileTypes     map[string][]string `toml:"file_types"` // Ensure TOML tag matches the file
+	CacheDir      string              `toml:"cache_dir"`
+	Trash         TrashConfig         `toml:"trash"`
+	Relationships RelationshipConfig  `toml:"relationships"`
+	UserTags      UserTagsConfig      `toml:"user_tags"`
+	Rules         []Rule              `toml:"rules"`
+	TagRules      []TagRule           `toml:"tag_rules"`
+	path          string              // File the config was loaded from
 }
 
 func CreateDirIfNotExist(path string) {
@@ -67,7 +79,7 @@ func NewIntermediateConfig(optionalPath string) *IntermediateConfig {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		defaultConfig = getDefaultConfig()
 		slog.Info(fmt.Sprintf("\nPath %s: %v", filepath.Dir(configPath), err))
-		CreateDirIfNotExist(filepath.Dir(configPath))
+		CreateDirIfNotExist(configPath)
 		file, err := os.Create(configPath)
 		if err != nil {
 			slog.Error(fmt.Sprintf("Error creating default config file: %v", err))
@@ -102,6 +114,7 @@ func NewIntermediateConfig(optionalPath string) *IntermediateConfig {
 	// Step 4: Confirm loaded config (case-sensitive)
 	slog.Debug(fmt.Sprintf("Loaded file_types (case-sensitive): %+v\n", defaultConfig.FileTypes))
 
+	defaultConfig.path = configPath
 	return &defaultConfig
 }
 
@@ -123,20 +136,94 @@ func NewDeskFSConfig() *DeskFSConfig {
 func (dfc *DeskFSConfig) BuildFileTypeTree(config *IntermediateConfig) *DeskFSConfig {
 	// Populate FileTypeTree using the intermediate config data
 	dfc.FileTypeTree.PopulateFileTypes(config.FileTypes)
+	dfc.CacheDir = config.CacheDir
+	dfc.Trash = config.Trash
+	dfc.Relationships = config.Relationships
+	dfc.UserTags = config.UserTags
+	dfc.Rules = compileRules(config.Rules)
+	dfc.TagRules = compileTagRules(config.TagRules)
 	return dfc
 }
 
+// ParseWorkspaceConfig decodes the TOML config stored with a workspace. An empty config is valid and overrides nothing.
+func ParseWorkspaceConfig(config string) (*IntermediateConfig, error) {
+	var workspaceConfig IntermediateConfig
+	if _, err := toml.Decode(config, &workspaceConfig); err != nil {
+		return nil, fmt.Errorf("error decoding workspace config: %w", err)
+	}
+	if _, _, err := workspaceConfig.Relationships.temporalSettings(); err != nil {
+		return nil, err
+	}
+	return &workspaceConfig, nil
+}
+
+// Merge returns a copy of the config with the settings of override applied on top: categories of file types
+// are added or replaced, rules and tag rules replace the base ones, and other settings replace the base when set.
+func (dfc *IntermediateConfig) Merge(override *IntermediateConfig) *IntermediateConfig {
+	merged := *dfc
+	if override == nil {
+		return &merged
+	}
+
+	merged.FileTypes = make(map[string][]string, len(dfc.FileTypes)+len(override.FileTypes))
+	for category, extensions := range dfc.FileTypes {
+		merged.FileTypes[category] = extensions
+	}
+	for category, extensions := range override.FileTypes {
+		merged.FileTypes[category] = extensions
+	}
+
+	if len(override.Rules) > 0 {
+		merged.Rules = override.Rules
+	}
+	if len(override.TagRules) > 0 {
+		merged.TagRules = override.TagRules
+	}
+	if override.CacheDir != "" {
+		merged.CacheDir = override.CacheDir
+	}
+	if override.Trash.Retention != "" {
+		merged.Trash.Retention = override.Trash.Retention
+	}
+	if override.Trash.MaxSize != "" {
+		merged.Trash.MaxSize = override.Trash.MaxSize
+	}
+	if override.Relationships.TemporalWindow != "" {
+		merged.Relationships.TemporalWindow = override.Relationships.TemporalWindow
+	}
+	if override.Relationships.MaxTemporalEdges != 0 {
+		merged.Relationships.MaxTemporalEdges = override.Relationships.MaxTemporalEdges
+	}
+	if override.UserTags.Xattr != nil {
+		merged.UserTags.Xattr = override.UserTags.Xattr
+	}
+	return &merged
+}
+
+// SaveConfig writes every setting of config to filePath, or to the file the config was loaded from when empty.
 func (dfc *IntermediateConfig) SaveConfig(config *IntermediateConfig, filePath string) error {
+	if dfc.Config.Cfg == nil {
+		dfc.Config.Cfg = viper.New()
+	}
+
 	dfc.Config.Cfg.Set("file_types", config.FileTypes)
 	dfc.Config.Cfg.Set("logger.style", config.Logger.Style)
 	dfc.Config.Cfg.Set("logger.level", config.Logger.Level)
 	dfc.Config.Cfg.Set("cache_dir", config.CacheDir)
-
-	if err := dfc.Config.Cfg.WriteConfig(); err != nil {
-		return err
+	dfc.Config.Cfg.Set("trash.retention", config.Trash.Retention)
+	dfc.Config.Cfg.Set("trash.max_size", config.Trash.MaxSize)
+	dfc.Config.Cfg.Set("relationships.temporal_window", config.Relationships.TemporalWindow)
+	dfc.Config.Cfg.Set("relationships.max_temporal_edges", config.Relationships.MaxTemporalEdges)
+	if config.UserTags.Xattr != nil {
+		dfc.Config.Cfg.Set("user_tags.xattr", *config.UserTags.Xattr)
 	}
+	dfc.Config.Cfg.Set("rules", config.Rules)
+	dfc.Config.Cfg.Set("tag_rules", config.TagRules)
 
-	return nil
+	if filePath != "" {
+		return dfc.Config.Cfg.WriteConfigAs(filePath)
+	}
+	return dfc.Config.Cfg.WriteConfig()
 }
 
 // Returns the default configuration
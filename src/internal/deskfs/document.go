@@ -0,0 +1,622 @@
+package deskfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// DocumentData is the metadata embedded in a PDF or Office document.
+type DocumentData struct {
+	Title      string
+	Author     string
+	Subject    string
+	CreatedAt  time.Time // Zero when not recorded
+	ModifiedAt time.Time // Zero when not recorded
+	Pages      int       // Pages of PDFs and word processing documents, slides of presentations, 0 when not recorded
+}
+
+// documentFormats maps the extensions of documents to their format
+var documentFormats = map[string]string{
+	".pdf":  "pdf",
+	".docx": "ooxml", ".docm": "ooxml",
+	".xlsx": "ooxml", ".xlsm": "ooxml",
+	".pptx": "ooxml", ".pptm": "ooxml",
+}
+
+const (
+	maxPDFRead       = 32 << 20 // PDFs larger than this are read from their first and last halves of it
+	maxPDFStream     = 8 << 20  // Largest decompressed object stream
+	maxOOXMLPartSize = 1 << 20  // Largest document properties part of an Office document
+)
+
+var errNoDocumentInfo = errors.New("no document metadata")
+
+// ReadDocumentInfo reads the info dictionary and XMP metadata of PDFs, and the document properties of
+// Office Open XML documents. Files of other types, or without metadata, return nil without error.
+func ReadDocumentInfo(path string) (*DocumentData, error) {
+	format, ok := documentFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, nil
+	}
+
+	var document *DocumentData
+	var err error
+	switch format {
+	case "pdf":
+		document, err = readPDFInfo(path)
+	case "ooxml":
+		document, err = readOOXMLInfo(path)
+	}
+	if errors.Is(err, errNoDocumentInfo) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document metadata of %s: %w", path, err)
+	}
+	return document, nil
+}
+
+// readPDFInfo reads the metadata of a PDF, preferring its info dictionary over its XMP metadata.
+func readPDFInfo(path string) (*DocumentData, error) {
+	data, err := readPDFData(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errNoDocumentInfo
+	}
+
+	objects := parsePDFObjects(data)
+	document := &DocumentData{}
+
+	// The info dictionary is referenced by the trailer, or the cross-reference stream, of the last update
+	if refs := pdfInfoRef.FindAllSubmatch(data, -1); len(refs) > 0 {
+		num, _ := strconv.Atoi(string(refs[len(refs)-1][1]))
+		if info, ok := objects[num]; ok {
+			document.Title = pdfDictString(info, "/Title", objects)
+			document.Author = pdfDictString(info, "/Author", objects)
+			document.Subject = pdfDictString(info, "/Subject", objects)
+			document.CreatedAt = parsePDFDate(pdfDictString(info, "/CreationDate", objects))
+			document.ModifiedAt = parsePDFDate(pdfDictString(info, "/ModDate", objects))
+		}
+	}
+
+	for _, object := range objects {
+		if !pdfPagesType.Match(object) {
+			continue
+		}
+		// The page tree root counts every page
+		if count := pdfCount.FindSubmatch(object); count != nil {
+			if pages, err := strconv.Atoi(string(count[1])); err == nil && pages > document.Pages {
+				document.Pages = pages
+			}
+		}
+	}
+
+	if xmp := findXMP(data, objects); xmp != nil {
+		mergeDocumentData(document, xmp)
+	}
+
+	if *document == (DocumentData{}) {
+		return nil, errNoDocumentInfo
+	}
+	return document, nil
+}
+
+// readPDFData reads a PDF, or the start and the end of large PDFs, where their metadata usually is.
+func readPDFData(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= maxPDFRead {
+		return io.ReadAll(file)
+	}
+
+	data := make([]byte, maxPDFRead)
+	if _, err := io.ReadFull(file, data[:maxPDFRead/2]); err != nil {
+		return nil, err
+	}
+	if _, err := file.ReadAt(data[maxPDFRead/2:], info.Size()-maxPDFRead/2); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+var (
+	pdfObjectHeader = regexp.MustCompile(`(?:^|[^0-9])(\d+)\s+\d+\s+obj\b`)
+	pdfInfoRef      = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	pdfRef          = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+	pdfPagesType    = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCount        = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfObjStm       = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfObjStmN      = regexp.MustCompile(`/N\s+(\d+)`)
+	pdfObjStmFirst  = regexp.MustCompile(`/First\s+(\d+)`)
+)
+
+// parsePDFObjects returns the content of the objects of a PDF by object number, including the objects
+// compressed in object streams. Later definitions, from incremental updates, replace earlier ones.
+func parsePDFObjects(data []byte) map[int][]byte {
+	objects := make(map[int][]byte)
+	var streams [][]byte
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+		body := data[match[1]:]
+		if end := bytes.Index(body, []byte("endobj")); end >= 0 {
+			body = body[:end]
+		}
+		objects[num] = body
+		if pdfObjStm.Match(body) {
+			streams = append(streams, body)
+		}
+	}
+
+	for _, stream := range streams {
+		for num, object := range parseObjectStream(stream) {
+			if _, ok := objects[num]; !ok {
+				objects[num] = object
+			}
+		}
+	}
+	return objects
+}
+
+// pdfStreamData returns the dictionary and the decoded data of a stream object. Only uncompressed
+// streams and Flate encoded streams without predictor are decoded.
+func pdfStreamData(body []byte) ([]byte, []byte, bool) {
+	dictEnd := bytes.Index(body, []byte("stream"))
+	if dictEnd < 0 {
+		return nil, nil, false
+	}
+	dict, content := body[:dictEnd], bytes.TrimLeft(body[dictEnd+len("stream"):], "\r\n")
+	if end := bytes.LastIndex(content, []byte("endstream")); end >= 0 {
+		content = content[:end]
+	}
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return dict, content, true
+	}
+	if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Count(dict, []byte("Decode")) > 1 {
+		return nil, nil, false
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, false
+	}
+	defer reader.Close()
+	// Streams are often followed by an end of line not counted in their length, which zlib ignores
+	decoded, _ := io.ReadAll(io.LimitReader(reader, maxPDFStream))
+	return dict, decoded, true
+}
+
+// parseObjectStream decompresses an object stream and returns its objects by number.
+func parseObjectStream(body []byte) map[int][]byte {
+	dict, decoded, ok := pdfStreamData(body)
+	if !ok {
+		return nil
+	}
+
+	n, first := pdfObjStmN.FindSubmatch(dict), pdfObjStmFirst.FindSubmatch(dict)
+	if n == nil || first == nil {
+		return nil
+	}
+	count, _ := strconv.Atoi(string(n[1]))
+	offset, _ := strconv.Atoi(string(first[1]))
+	if offset < 0 || offset > len(decoded) {
+		return nil
+	}
+
+	header := strings.Fields(string(decoded[:offset]))
+	objects := make(map[int][]byte)
+	for i := 0; i < count && 2*i+1 < len(header); i++ {
+		num, err1 := strconv.Atoi(header[2*i])
+		start, err2 := strconv.Atoi(header[2*i+1])
+		if err1 != nil || err2 != nil || start < 0 || start > len(decoded)-offset {
+			continue
+		}
+		end := len(decoded)
+		if 2*i+3 < len(header) {
+			if next, err := strconv.Atoi(header[2*i+3]); err == nil && next >= start && next <= len(decoded)-offset {
+				end = offset + next
+			}
+		}
+		objects[num] = decoded[offset+start : end]
+	}
+	return objects
+}
+
+// pdfDictString returns the text string of key in a dictionary, following an indirect reference.
+func pdfDictString(dict []byte, key string, objects map[int][]byte) string {
+	raw, _, ok := parsePDFString(pdfResolve(pdfDictValue(dict, key), objects))
+	if !ok {
+		return ""
+	}
+	return decodePDFText(raw)
+}
+
+// pdfDictValue returns the dictionary content following key, starting with its value, or nil.
+func pdfDictValue(dict []byte, key string) []byte {
+	for start := 0; ; {
+		i := bytes.Index(dict[start:], []byte(key))
+		if i < 0 {
+			return nil
+		}
+		value := dict[start+i+len(key):]
+		start += i + len(key)
+		// Skip longer keys sharing the prefix, e.g. /TitleSort
+		if len(value) > 0 && !isPDFDelimiter(value[0]) {
+			continue
+		}
+		return bytes.TrimLeft(value, " \t\r\n")
+	}
+}
+
+// pdfResolve returns the object an indirect reference at the start of value points to, or value.
+func pdfResolve(value []byte, objects map[int][]byte) []byte {
+	if ref := pdfRef.FindSubmatch(value); ref != nil {
+		num, _ := strconv.Atoi(string(ref[1]))
+		return bytes.TrimLeft(objects[num], " \t\r\n")
+	}
+	return value
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f()<>[]{}/%", c) >= 0
+}
+
+// parsePDFString parses the literal or hexadecimal string at the start of value, and returns its length in value.
+func parsePDFString(value []byte) ([]byte, int, bool) {
+	if len(value) == 0 {
+		return nil, 0, false
+	}
+	switch {
+	case value[0] == '<' && (len(value) < 2 || value[1] != '<'):
+		end := bytes.IndexByte(value, '>')
+		if end < 0 {
+			return nil, 0, false
+		}
+		digits := strings.Map(func(r rune) rune {
+			if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return r
+			}
+			return -1
+		}, string(value[1:end]))
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		decoded := make([]byte, len(digits)/2)
+		for i := range decoded {
+			b, _ := strconv.ParseUint(digits[2*i:2*i+2], 16, 8)
+			decoded[i] = byte(b)
+		}
+		return decoded, end + 1, true
+
+	case value[0] == '(':
+		var out []byte
+		depth := 0
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch c {
+			case '\\':
+				i++
+				if i >= len(value) {
+					return out, len(value), true
+				}
+				switch e := value[i]; e {
+				case 'n':
+					out = append(out, '\n')
+				case 'r':
+					out = append(out, '\r')
+				case 't':
+					out = append(out, '\t')
+				case 'b':
+					out = append(out, '\b')
+				case 'f':
+					out = append(out, '\f')
+				case '\r', '\n': // Line continuation
+					if e == '\r' && i+1 < len(value) && value[i+1] == '\n' {
+						i++
+					}
+				default:
+					if e >= '0' && e <= '7' {
+						octal := 0
+						for j := 0; j < 3 && i < len(value) && value[i] >= '0' && value[i] <= '7'; j++ {
+							octal = octal*8 + int(value[i]-'0')
+							i++
+						}
+						i--
+						out = append(out, byte(octal))
+					} else {
+						out = append(out, e)
+					}
+				}
+			case '(':
+				depth++
+				out = append(out, c)
+			case ')':
+				if depth == 0 {
+					return out, i + 1, true
+				}
+				depth--
+				out = append(out, c)
+			default:
+				out = append(out, c)
+			}
+		}
+		return out, len(value), true
+	}
+	return nil, 0, false
+}
+
+// decodePDFText decodes a text string: UTF-16BE or UTF-8 with a byte order mark, else PDFDocEncoding,
+// which matches Latin-1 for printable characters.
+func decodePDFText(raw []byte) string {
+	var text string
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xFE, 0xFF}):
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		text = string(utf16.Decode(units))
+	case bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}):
+		text = string(raw[3:])
+	default:
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(text, "\x00", ""))
+}
+
+// parsePDFDate parses dates like "D:20240301103000+01'00'", whose parts after the year are optional.
+// Invalid dates are zero.
+func parsePDFDate(value string) time.Time {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "D:")
+	digits := len(value) - len(strings.TrimLeft(value, "0123456789"))
+	if digits < 4 {
+		return time.Time{}
+	}
+	// Missing parts default to the first month, day, hour...
+	stamp := value[:digits]
+	if digits < 14 {
+		stamp += "0101000000"[digits-4:]
+	}
+
+	location := time.UTC
+	if zone := strings.ReplaceAll(value[digits:], "'", ""); len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		hours, _ := strconv.Atoi(zone[1:3])
+		minutes := 0
+		if len(zone) >= 5 {
+			minutes, _ = strconv.Atoi(zone[3:5])
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+
+	date, err := time.ParseInLocation("20060102150405", stamp[:14], location)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// findXMP returns the metadata of the XMP packet of a PDF, stored uncompressed or in a Flate encoded stream.
+func findXMP(data []byte, objects map[int][]byte) *DocumentData {
+	if packet := xmpPacket(data); packet != nil {
+		return parseXMP(packet)
+	}
+	for _, object := range objects {
+		if !bytes.Contains(object, []byte("/Metadata")) {
+			continue
+		}
+		if _, decoded, ok := pdfStreamData(object); ok {
+			if packet := xmpPacket(decoded); packet != nil {
+				return parseXMP(packet)
+			}
+		}
+	}
+	return nil
+}
+
+// xmpPacket returns the last x:xmpmeta element of data, the most recent of incremental updates.
+func xmpPacket(data []byte) []byte {
+	start := bytes.LastIndex(data, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len("</x:xmpmeta>")]
+}
+
+// parseXMP reads the Dublin Core title, creator and description, and the XMP dates of an XMP packet.
+// Properties are elements, or attributes of rdf:Description.
+func parseXMP(packet []byte) *DocumentData {
+	document := &DocumentData{}
+	set := func(name, value string) {
+		value = strings.TrimSpace(value)
+		switch name {
+		case "title":
+			document.Title = firstNonEmpty(document.Title, value)
+		case "creator":
+			document.Author = firstNonEmpty(document.Author, value)
+		case "description":
+			document.Subject = firstNonEmpty(document.Subject, value)
+		case "CreateDate":
+			if document.CreatedAt.IsZero() {
+				document.CreatedAt = parseXMPDate(value)
+			}
+		case "ModifyDate":
+			if document.ModifiedAt.IsZero() {
+				document.ModifiedAt = parseXMPDate(value)
+			}
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var property string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "Description":
+				for _, attr := range token.Attr {
+					set(attr.Name.Local, attr.Value)
+				}
+			case "title", "creator", "description", "CreateDate", "ModifyDate":
+				property = token.Name.Local
+			}
+			text.Reset()
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			// Values of dc properties are rdf:li items of an rdf:Alt or rdf:Seq, the first one is kept
+			if property != "" && (token.Name.Local == "li" || token.Name.Local == property) {
+				set(property, text.String())
+				if token.Name.Local == property {
+					property = ""
+				}
+			}
+			text.Reset()
+		}
+	}
+	return document
+}
+
+// parseXMPDate parses the ISO 8601 dates of XMP, which may omit their time or time zone.
+func parseXMPDate(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// mergeDocumentData fills the fields of document that are not set with those of other.
+func mergeDocumentData(document, other *DocumentData) {
+	document.Title = firstNonEmpty(document.Title, other.Title)
+	document.Author = firstNonEmpty(document.Author, other.Author)
+	document.Subject = firstNonEmpty(document.Subject, other.Subject)
+	if document.CreatedAt.IsZero() {
+		document.CreatedAt = other.CreatedAt
+	}
+	if document.ModifiedAt.IsZero() {
+		document.ModifiedAt = other.ModifiedAt
+	}
+	if document.Pages == 0 {
+		document.Pages = other.Pages
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ooxmlCoreProperties is the docProps/core.xml part of an Office document
+type ooxmlCoreProperties struct {
+	Title    string `xml:"title"`
+	Creator  string `xml:"creator"`
+	Subject  string `xml:"subject"`
+	Created  string `xml:"created"`
+	Modified string `xml:"modified"`
+}
+
+// ooxmlAppProperties is the docProps/app.xml part of an Office document
+type ooxmlAppProperties struct {
+	Pages  int `xml:"Pages"`
+	Slides int `xml:"Slides"`
+}
+
+// readOOXMLInfo reads the core and application properties of an Office Open XML document.
+func readOOXMLInfo(path string) (*DocumentData, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return nil, errNoDocumentInfo
+		}
+		return nil, err
+	}
+	defer archive.Close()
+
+	document := &DocumentData{}
+	var core ooxmlCoreProperties
+	if found, err := readOOXMLPart(&archive.Reader, "docProps/core.xml", &core); err != nil {
+		return nil, err
+	} else if found {
+		document.Title = strings.TrimSpace(core.Title)
+		document.Author = strings.TrimSpace(core.Creator)
+		document.Subject = strings.TrimSpace(core.Subject)
+		document.CreatedAt = parseXMPDate(strings.TrimSpace(core.Created))
+		document.ModifiedAt = parseXMPDate(strings.TrimSpace(core.Modified))
+	}
+
+	var app ooxmlAppProperties
+	if found, err := readOOXMLPart(&archive.Reader, "docProps/app.xml", &app); err != nil {
+		return nil, err
+	} else if found {
+		document.Pages = max(app.Pages, app.Slides)
+	}
+
+	if *document == (DocumentData{}) {
+		return nil, errNoDocumentInfo
+	}
+	return document, nil
+}
+
+// readOOXMLPart decodes the XML part name of an Office document into v, reporting whether it exists.
+func readOOXMLPart(archive *zip.Reader, name string, v any) (bool, error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		part, err := file.Open()
+		if err != nil {
+			return false, err
+		}
+		defer part.Close()
+		if err := xml.NewDecoder(io.LimitReader(part, maxOOXMLPartSize)).Decode(v); err != nil {
+			return false, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
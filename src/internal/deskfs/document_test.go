@@ -0,0 +1,191 @@
+package deskfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildPDF returns a PDF with a page tree of pages pages and the info dictionary info
+func buildPDF(info string, pages int) []byte {
+	return []byte(fmt.Sprintf(`%%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [3 0 R] /Count %d >>
+endobj
+3 0 obj
+<< /Type /Pages /Parent 2 0 R /Kids [] /Count 1 >>
+endobj
+4 0 obj
+%s
+endobj
+trailer
+<< /Size 5 /Root 1 0 R /Info 4 0 R >>
+%%%%EOF
+`, pages, info))
+}
+
+// buildCompressedPDF returns a PDF 1.5 whose info dictionary is compressed in an object stream, and whose
+// title and author are only in its XMP metadata
+func buildCompressedPDF(info, xmp string) []byte {
+	objects := []string{"<< /Type /Pages /Kids [] /Count 2 >>", info}
+	header := fmt.Sprintf("2 0 5 %d ", len(objects[0])+1)
+	var stream bytes.Buffer
+	writer := zlib.NewWriter(&stream)
+	writer.Write([]byte(header + objects[0] + " " + objects[1]))
+	writer.Close()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%%PDF-1.5\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R /Metadata 3 0 R >>\nendobj\n")
+	fmt.Fprintf(&b, "3 0 obj\n<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(xmp), xmp)
+	fmt.Fprintf(&b, "4 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(header), stream.Len())
+	b.Write(stream.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\n6 0 obj\n<< /Type /XRef /Root 1 0 R /Info 5 0 R >>\nstream\nendstream\nendobj\n%%%%EOF\n")
+	return b.Bytes()
+}
+
+// buildObjectStreamPDF returns a PDF holding a single compressed object stream with the given header
+func buildObjectStreamPDF(header, objects string) []byte {
+	var stream bytes.Buffer
+	writer := zlib.NewWriter(&stream)
+	writer.Write([]byte(header + objects))
+	writer.Close()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%%PDF-1.5\n1 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(header), stream.Len())
+	b.Write(stream.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\n2 0 obj\n<< /Type /XRef /Root 3 0 R /Info 4 0 R >>\nstream\nendstream\nendobj\n%%%%EOF\n")
+	return b.Bytes()
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:ModifyDate="2024-02-02T09:00:00Z">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Quarterly Report</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>Finance Team</rdf:li><rdf:li>Someone Else</rdf:li></rdf:Seq></dc:creator>
+<xmp:CreateDate>2024-02-01T10:00:00+01:00</xmp:CreateDate>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+// buildOOXML returns an Office document with the given core and application properties
+func buildOOXML(core, app string) []byte {
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for name, content := range map[string]string{"[Content_Types].xml": "<Types/>", "docProps/core.xml": core, "docProps/app.xml": app} {
+		part, _ := archive.Create(name)
+		part.Write([]byte(content))
+	}
+	archive.Close()
+	return b.Bytes()
+}
+
+const testCoreXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>Invoice 2024/117</dc:title><dc:creator>ACME Billing</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">2024-03-05T08:15:00Z</dcterms:created>
+<dcterms:modified xsi:type="dcterms:W3CDTF">2024-03-06T12:00:00Z</dcterms:modified>
+</cp:coreProperties>`
+
+func TestReadDocumentInfo(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		// Literal strings with escapes, and a UTF-16 hexadecimal string
+		"plain.pdf":      buildPDF(`<< /Title (Invoice \(March\)\0522024) /TitleSort (x) /Author <FEFF004A006F00EB006C> /CreationDate (D:20240301103000+01'00') /ModDate (D:2024) >>`, 3),
+		"compressed.pdf": buildCompressedPDF(`<< /Producer (Test) >>`, testXMP),
+		"invoice.docx":   buildOOXML(testCoreXML, `<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"><Pages>2</Pages></Properties>`),
+		"deck.pptx":      buildOOXML(`<cp:coreProperties xmlns:cp="x" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Roadmap</dc:title></cp:coreProperties>`, `<Properties><Slides>12</Slides></Properties>`),
+	}
+	expected := map[string]*DocumentData{
+		"plain.pdf": {
+			Title: "Invoice (March)*2024", Author: "Joël", Pages: 3,
+			CreatedAt:  time.Date(2024, 3, 1, 10, 30, 0, 0, time.FixedZone("", 3600)),
+			ModifiedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"compressed.pdf": {
+			Title: "Quarterly Report", Author: "Finance Team", Pages: 2,
+			CreatedAt:  time.Date(2024, 2, 1, 10, 0, 0, 0, time.FixedZone("", 3600)),
+			ModifiedAt: time.Date(2024, 2, 2, 9, 0, 0, 0, time.UTC),
+		},
+		"invoice.docx": {
+			Title: "Invoice 2024/117", Author: "ACME Billing", Pages: 2,
+			CreatedAt:  time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC),
+			ModifiedAt: time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC),
+		},
+		"deck.pptx": {Title: "Roadmap", Pages: 12},
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+
+		document, err := ReadDocumentInfo(path)
+		assert.NoError(t, err, name)
+		if assert.NotNil(t, document, name) {
+			want := expected[name]
+			assert.Equal(t, want.Title, document.Title, name)
+			assert.Equal(t, want.Author, document.Author, name)
+			assert.Equal(t, want.Pages, document.Pages, name)
+			assert.True(t, want.CreatedAt.Equal(document.CreatedAt), "%s: %v", name, document.CreatedAt)
+			assert.True(t, want.ModifiedAt.Equal(document.ModifiedAt), "%s: %v", name, document.ModifiedAt)
+		}
+	}
+
+	// Documents without metadata, broken documents and other files have none
+	files = map[string][]byte{
+		"empty.pdf": []byte("%PDF-1.4\n%%EOF\n"),
+		"fake.docx": []byte("not a zip"),
+		"notes.txt": []byte("text"),
+		// Object streams with offsets out of their bounds
+		"negative.pdf": buildObjectStreamPDF("4 -50 ", "<< /Title (Lost) >>"),
+		"overflow.pdf": buildObjectStreamPDF("3 0 4 9223372036854775807 ", "<< >> << /Title (Lost) >>"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+		document, err := ReadDocumentInfo(path)
+		assert.NoError(t, err, name)
+		assert.Nil(t, document, name)
+	}
+}
+
+func TestOrganizeDocumentsByMetadata(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/scan0001.docx": string(buildOOXML(testCoreXML, "<Properties/>")),
+		"source/q1.pdf":        string(buildCompressedPDF("<< >>", testXMP)),
+		"source/other.pdf":     string(buildPDF("<< /Title (Menu) >>", 1)),
+		"config.toml": `file_types = { "Documents" = [".pdf", ".docx"] }
+
+[[rules]]
+name = "invoices"
+target = "Invoices/{{.Document.Author}}/{{.Document.Year}}"
+title = "invoice 2024/*"
+
+[[rules]]
+name = "reports"
+target = "Reports/{{.Document.Title}}"
+author = "finance*"
+`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	params := &FilePathParams{SourceDir: source, TargetDir: source, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(source, "Invoices", "ACME Billing", "2024", "scan0001.docx"))
+	assert.FileExists(t, filepath.Join(source, "Reports", "Quarterly Report", "q1.pdf"))
+	assert.FileExists(t, filepath.Join(source, "Documents", "other.pdf"))
+}
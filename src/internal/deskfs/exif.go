@@ -0,0 +1,510 @@
+package deskfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExifData is the EXIF metadata of a photo.
+type ExifData struct {
+	TakenAt     time.Time // Capture date, zero when not recorded
+	Make        string    // Camera manufacturer
+	Model       string    // Camera model
+	Orientation int       // EXIF orientation from 1 to 8, 0 when not recorded
+	HasGPS      bool      // The photo records the position it was taken at
+}
+
+// Camera returns the make and model of the camera, without repeating the make when the model starts with it.
+func (exif *ExifData) Camera() string {
+	if exif.Make == "" || strings.HasPrefix(strings.ToLower(exif.Model), strings.ToLower(exif.Make)) {
+		return exif.Model
+	}
+	if exif.Model == "" {
+		return exif.Make
+	}
+	return exif.Make + " " + exif.Model
+}
+
+// exifContainers maps the extensions of photos to the container holding their EXIF data. Most raw
+// formats are TIFF files.
+var exifContainers = map[string]string{
+	".jpg": "jpeg", ".jpeg": "jpeg", ".jpe": "jpeg",
+	".tif": "tiff", ".tiff": "tiff", ".dng": "tiff", ".nef": "tiff", ".cr2": "tiff", ".arw": "tiff",
+	".heic": "heif", ".heif": "heif",
+}
+
+const (
+	maxExifSegment = 1 << 20 // Largest metadata box or value read from a photo
+	maxIFDEntries  = 1024
+	exifTimeLayout = "2006:01:02 15:04:05"
+)
+
+// EXIF tags read from the IFDs of a photo
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagOrientation       = 0x0112
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagGPSIFD            = 0x8825
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+	tagOffsetTimeOrig    = 0x9011
+	tagGPSLatitude       = 0x0002
+	tagGPSLongitude      = 0x0004
+)
+
+var errNoExif = errors.New("no EXIF data")
+
+// ReadExif reads the EXIF metadata of the JPEG, TIFF, raw or HEIF photo at path. Files of other types, or
+// without EXIF data, return nil without error.
+func ReadExif(path string) (*ExifData, error) {
+	container, ok := exifContainers[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var exif *ExifData
+	switch container {
+	case "jpeg":
+		var segment []byte
+		if segment, err = jpegExifSegment(bufio.NewReader(file)); err == nil {
+			exif, err = parseTIFFExif(bytes.NewReader(segment), int64(len(segment)))
+		}
+	case "tiff":
+		exif, err = parseTIFFExif(file, info.Size())
+	case "heif":
+		var offset, length int64
+		if offset, length, err = heifExifLocation(file, info.Size()); err == nil {
+			exif, err = parseHEIFExif(io.NewSectionReader(file, offset, length), length)
+		}
+	}
+	if errors.Is(err, errNoExif) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EXIF data of %s: %w", path, err)
+	}
+	return exif, nil
+}
+
+// jpegExifSegment returns the TIFF data of the APP1 Exif segment of a JPEG, found before the image data.
+func jpegExifSegment(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, errNoExif
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errNoExif
+		}
+		if b != 0xFF {
+			return nil, fmt.Errorf("invalid JPEG marker")
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF { // Fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, errNoExif
+		}
+		switch {
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8): // Markers without a payload
+			continue
+		case marker == 0xD9 || marker == 0xDA: // End of image, start of the image data
+			return nil, errNoExif
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, errNoExif
+		}
+		if marker != 0xE1 {
+			if _, err := r.Discard(int(length) - 2); err != nil {
+				return nil, errNoExif
+			}
+			continue
+		}
+
+		segment := make([]byte, int(length)-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, errNoExif
+		}
+		// APP1 also holds XMP packets
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// parseHEIFExif parses the payload of the Exif item of a HEIF file, which starts with the offset of the TIFF header.
+func parseHEIFExif(r io.ReaderAt, size int64) (*ExifData, error) {
+	var header [4]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, errNoExif
+	}
+	start := 4 + int64(binary.BigEndian.Uint32(header[:]))
+	if start >= size {
+		return nil, errNoExif
+	}
+	return parseTIFFExif(io.NewSectionReader(r, start, size-start), size-start)
+}
+
+// tiffReader reads the IFDs of TIFF data.
+type tiffReader struct {
+	r     io.ReaderAt
+	size  int64
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+// Sizes of the TIFF field types, by type
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8}
+
+func (t *tiffReader) read(offset int64, length uint32) ([]byte, error) {
+	if offset < 0 || length > maxExifSegment || offset+int64(length) > t.size {
+		return nil, fmt.Errorf("TIFF field out of bounds")
+	}
+	buf := make([]byte, length)
+	if _, err := t.r.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readIFD returns the entries of the IFD at offset, skipping values that cannot be read.
+func (t *tiffReader) readIFD(offset uint32) ([]ifdEntry, error) {
+	header, err := t.read(int64(offset), 2)
+	if err != nil {
+		return nil, err
+	}
+	count := t.order.Uint16(header)
+	if count > maxIFDEntries {
+		return nil, fmt.Errorf("too many IFD entries")
+	}
+	raw, err := t.read(int64(offset)+2, uint32(count)*12)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ifdEntry, 0, count)
+	for i := 0; i < int(count); i++ {
+		field := raw[i*12 : (i+1)*12]
+		entry := ifdEntry{tag: t.order.Uint16(field), kind: t.order.Uint16(field[2:]), count: t.order.Uint32(field[4:])}
+		typeSize, ok := tiffTypeSizes[entry.kind]
+		if !ok || entry.count > maxExifSegment/typeSize {
+			continue
+		}
+		if length := typeSize * entry.count; length <= 4 {
+			entry.value = field[8 : 8+length]
+		} else if entry.value, err = t.read(int64(t.order.Uint32(field[8:])), length); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (entry ifdEntry) string() string {
+	if entry.kind != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (entry ifdEntry) uint(order binary.ByteOrder) (uint32, bool) {
+	switch {
+	case entry.kind == 3 && len(entry.value) >= 2:
+		return uint32(order.Uint16(entry.value)), true
+	case entry.kind == 4 && len(entry.value) >= 4:
+		return order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+// parseTIFFExif reads the camera, orientation, capture date and GPS presence from TIFF data.
+func parseTIFFExif(r io.ReaderAt, size int64) (*ExifData, error) {
+	t := &tiffReader{r: r, size: size}
+	header, err := t.read(0, 8)
+	if err != nil {
+		return nil, errNoExif
+	}
+	switch string(header[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(header[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	exif := &ExifData{}
+	var dateTime, original, digitized, offset string
+	for _, entry := range ifd0 {
+		switch entry.tag {
+		case tagMake:
+			exif.Make = entry.string()
+		case tagModel:
+			exif.Model = entry.string()
+		case tagOrientation:
+			if orientation, ok := entry.uint(t.order); ok && orientation >= 1 && orientation <= 8 {
+				exif.Orientation = int(orientation)
+			}
+		case tagDateTime:
+			dateTime = entry.string()
+		case tagExifIFD:
+			pointer, ok := entry.uint(t.order)
+			if !ok {
+				continue
+			}
+			subIFD, err := t.readIFD(pointer)
+			if err != nil {
+				continue
+			}
+			for _, sub := range subIFD {
+				switch sub.tag {
+				case tagDateTimeOriginal:
+					original = sub.string()
+				case tagDateTimeDigitized:
+					digitized = sub.string()
+				case tagOffsetTimeOrig:
+					offset = sub.string()
+				}
+			}
+		case tagGPSIFD:
+			pointer, ok := entry.uint(t.order)
+			if !ok {
+				continue
+			}
+			gps, err := t.readIFD(pointer)
+			if err != nil {
+				continue
+			}
+			var latitude, longitude bool
+			for _, sub := range gps {
+				latitude = latitude || sub.tag == tagGPSLatitude
+				longitude = longitude || sub.tag == tagGPSLongitude
+			}
+			exif.HasGPS = latitude && longitude
+		}
+	}
+
+	for _, value := range []string{original, digitized, dateTime} {
+		if takenAt, ok := parseExifTime(value, offset); ok {
+			exif.TakenAt = takenAt
+			break
+		}
+	}
+	return exif, nil
+}
+
+// parseExifTime parses an EXIF date, in the local time zone unless its offset is recorded.
+func parseExifTime(value, offset string) (time.Time, bool) {
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse(exifTimeLayout+"-07:00", value+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, value, time.Local)
+	return t, err == nil
+}
+
+// heifExifLocation returns the offset and length of the Exif item of a HEIF file, from the item
+// information and item location boxes of its meta box.
+func heifExifLocation(r io.ReaderAt, size int64) (int64, int64, error) {
+	meta, err := findBox(r, 0, size, "meta")
+	if err != nil {
+		return 0, 0, err
+	}
+	if meta.length > maxExifSegment || meta.length < 4 {
+		return 0, 0, errNoExif
+	}
+	data := make([]byte, meta.length)
+	if _, err := r.ReadAt(data, meta.offset); err != nil {
+		return 0, 0, err
+	}
+	// meta is a full box, its children follow the version and flags
+	children := bytes.NewReader(data[4:])
+
+	iinf, err := findBox(children, 0, int64(len(data)-4), "iinf")
+	if err != nil {
+		return 0, 0, err
+	}
+	itemID, err := heifExifItemID(data[4+iinf.offset : 4+iinf.offset+iinf.length])
+	if err != nil {
+		return 0, 0, err
+	}
+	iloc, err := findBox(children, 0, int64(len(data)-4), "iloc")
+	if err != nil {
+		return 0, 0, err
+	}
+	return heifItemLocation(data[4+iloc.offset:4+iloc.offset+iloc.length], itemID)
+}
+
+type isoBox struct {
+	offset int64 // Offset of the payload
+	length int64 // Length of the payload
+}
+
+// findBox returns the payload of the first box of type boxType between start and end.
+func findBox(r io.ReaderAt, start, end int64, boxType string) (isoBox, error) {
+	for offset := start; offset+8 <= end; {
+		var header [16]byte
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return isoBox{}, errNoExif
+		}
+		size, headerSize := int64(binary.BigEndian.Uint32(header[:4])), int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return isoBox{}, errNoExif
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if size < headerSize || size > end-offset {
+			return isoBox{}, errNoExif
+		}
+		if string(header[4:8]) == boxType {
+			return isoBox{offset: offset + headerSize, length: size - headerSize}, nil
+		}
+		offset += size
+	}
+	return isoBox{}, errNoExif
+}
+
+// heifExifItemID returns the ID of the Exif item from the payload of an iinf box.
+func heifExifItemID(iinf []byte) (uint32, error) {
+	if len(iinf) < 6 {
+		return 0, errNoExif
+	}
+	offset := 6 // Version, flags and a 16 bit entry count
+	if iinf[0] != 0 {
+		offset = 8
+	}
+	entries := bytes.NewReader(iinf)
+	for {
+		infe, err := findBox(entries, int64(offset), int64(len(iinf)), "infe")
+		if err != nil {
+			return 0, err
+		}
+		payload := iinf[infe.offset : infe.offset+infe.length]
+		offset = int(infe.offset + infe.length)
+		if len(payload) == 0 {
+			continue
+		}
+
+		// Item types are only recorded from version 2
+		switch version := payload[0]; {
+		case version == 2 && len(payload) >= 12 && string(payload[8:12]) == "Exif":
+			return uint32(binary.BigEndian.Uint16(payload[4:6])), nil
+		case version == 3 && len(payload) >= 14 && string(payload[10:14]) == "Exif":
+			return binary.BigEndian.Uint32(payload[4:8]), nil
+		}
+	}
+}
+
+// heifItemLocation returns the offset and length of the first extent of an item from the payload of an iloc box.
+func heifItemLocation(iloc []byte, itemID uint32) (int64, int64, error) {
+	r := &byteCursor{data: iloc}
+	version := r.uint(1)
+	r.skip(3)
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version != 1 && version != 2 {
+		indexSize = 0
+	}
+
+	itemCount := r.uint(2)
+	if version == 2 {
+		itemCount = r.uint(4)
+	}
+	for i := uint64(0); i < itemCount && r.err == nil; i++ {
+		id := r.uint(2)
+		if version == 2 {
+			id = r.uint(4)
+		}
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod = r.uint(2) & 0xF
+		}
+		r.skip(2) // Data reference index
+		baseOffset := r.uint(baseOffsetSize)
+		extentCount := r.uint(2)
+
+		for extent := uint64(0); extent < extentCount && r.err == nil; extent++ {
+			r.skip(indexSize)
+			extentOffset := r.uint(offsetSize)
+			extentLength := r.uint(lengthSize)
+			// Only items stored in the file itself are supported
+			if uint32(id) == itemID && extent == 0 && constructionMethod == 0 && r.err == nil {
+				return int64(baseOffset + extentOffset), int64(extentLength), nil
+			}
+		}
+	}
+	return 0, 0, errNoExif
+}
+
+// byteCursor reads big-endian integers of variable size, recording the first read past the end.
+type byteCursor struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (c *byteCursor) uint(size int) uint64 {
+	if c.err != nil || c.pos+size > len(c.data) {
+		c.err = errNoExif
+		return 0
+	}
+	var value uint64
+	for _, b := range c.data[c.pos : c.pos+size] {
+		value = value<<8 | uint64(b)
+	}
+	c.pos += size
+	return value
+}
+
+func (c *byteCursor) skip(size int) {
+	if c.err == nil && c.pos+size > len(c.data) {
+		c.err = errNoExif
+	}
+	c.pos += size
+}
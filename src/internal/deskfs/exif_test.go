@@ -0,0 +1,259 @@
+package deskfs
+
+import (
+	"bytes"
+	"desktop-cleaner/internal/db"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testIFDEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, value string) testIFDEntry {
+	return testIFDEntry{tag: tag, kind: 2, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+func longEntry(order binary.ByteOrder, tag uint16, value uint32) testIFDEntry {
+	data := make([]byte, 4)
+	order.PutUint32(data, value)
+	return testIFDEntry{tag: tag, kind: 4, count: 1, data: data}
+}
+
+// encodeIFD encodes an IFD at offset, followed by its values larger than 4 bytes.
+func encodeIFD(order binary.ByteOrder, offset uint32, entries []testIFDEntry) []byte {
+	var ifd, values bytes.Buffer
+	valuesOffset := offset + 2 + uint32(len(entries))*12 + 4
+	binary.Write(&ifd, order, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(&ifd, order, entry.tag)
+		binary.Write(&ifd, order, entry.kind)
+		binary.Write(&ifd, order, entry.count)
+		if len(entry.data) <= 4 {
+			ifd.Write(append(entry.data, make([]byte, 4-len(entry.data))...))
+			continue
+		}
+		binary.Write(&ifd, order, valuesOffset+uint32(values.Len()))
+		values.Write(entry.data)
+	}
+	binary.Write(&ifd, order, uint32(0))
+	return append(ifd.Bytes(), values.Bytes()...)
+}
+
+// buildTIFFExif returns TIFF data with a camera, an orientation, a capture date and a GPS position.
+func buildTIFFExif(order binary.ByteOrder, cameraMake, model, takenAt string) []byte {
+	header := []byte("MM\x00*\x00\x00\x00\x08")
+	if order == binary.LittleEndian {
+		header = []byte("II*\x00\x08\x00\x00\x00")
+	}
+
+	orientation := make([]byte, 2)
+	order.PutUint16(orientation, 6)
+	ifd0 := func(exifOffset, gpsOffset uint32) []testIFDEntry {
+		return []testIFDEntry{
+			asciiEntry(tagMake, cameraMake),
+			asciiEntry(tagModel, model),
+			{tag: tagOrientation, kind: 3, count: 1, data: orientation},
+			longEntry(order, tagExifIFD, exifOffset),
+			longEntry(order, tagGPSIFD, gpsOffset),
+		}
+	}
+	exifOffset := uint32(8 + len(encodeIFD(order, 8, ifd0(0, 0))))
+	exifIFD := encodeIFD(order, exifOffset, []testIFDEntry{asciiEntry(tagDateTimeOriginal, takenAt), asciiEntry(tagOffsetTimeOrig, "+02:00")})
+	gpsOffset := exifOffset + uint32(len(exifIFD))
+	rational := make([]byte, 24)
+	gpsIFD := encodeIFD(order, gpsOffset, []testIFDEntry{
+		{tag: tagGPSLatitude, kind: 5, count: 3, data: rational},
+		{tag: tagGPSLongitude, kind: 5, count: 3, data: rational},
+	})
+
+	data := append(header, encodeIFD(order, 8, ifd0(exifOffset, gpsOffset))...)
+	data = append(data, exifIFD...)
+	return append(data, gpsIFD...)
+}
+
+// buildJPEG returns a JPEG whose APP1 segment holds tiff, after an XMP APP1 segment
+func buildJPEG(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	for _, payload := range [][]byte{[]byte("http://ns.adobe.com/xap/1.0/\x00<x/>"), append([]byte("Exif\x00\x00"), tiff...)} {
+		b.Write([]byte{0xFF, 0xE1})
+		binary.Write(&b, binary.BigEndian, uint16(len(payload)+2))
+		b.Write(payload)
+	}
+	b.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return b.Bytes()
+}
+
+func isoBoxBytes(boxType string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	return append(append(box, boxType...), content...)
+}
+
+// buildHEIF returns a HEIF file whose Exif item, stored after the meta box, holds tiff
+func buildHEIF(tiff []byte) []byte {
+	exifItem := append(binary.BigEndian.AppendUint32(nil, 6), append([]byte("Exif\x00\x00"), tiff...)...)
+
+	infe := func(id uint16, itemType string) []byte {
+		payload := []byte{2, 0, 0, 0}
+		payload = binary.BigEndian.AppendUint16(payload, id)
+		payload = append(payload, 0, 0)
+		return isoBoxBytes("infe", append(append(payload, itemType...), 0))
+	}
+	iinf := isoBoxBytes("iinf", []byte{0, 0, 0, 0, 0, 2}, infe(1, "hvc1"), infe(2, "Exif"))
+
+	iloc := func(exifOffset uint32) []byte {
+		payload := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 2}
+		for _, item := range []struct {
+			id             uint16
+			offset, length uint32
+		}{{1, 0, 0}, {2, exifOffset, uint32(len(exifItem))}} {
+			payload = binary.BigEndian.AppendUint16(payload, item.id)
+			payload = append(payload, 0, 0, 0, 1) // Data reference index, one extent
+			payload = binary.BigEndian.AppendUint32(payload, item.offset)
+			payload = binary.BigEndian.AppendUint32(payload, item.length)
+		}
+		return isoBoxBytes("iloc", payload)
+	}
+
+	ftyp := isoBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	meta := func(exifOffset uint32) []byte {
+		return isoBoxBytes("meta", []byte{0, 0, 0, 0}, isoBoxBytes("hdlr", make([]byte, 24)), iinf, iloc(exifOffset))
+	}
+	exifOffset := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(exifOffset), isoBoxBytes("mdat", exifItem)}, nil)
+}
+
+func TestReadExif(t *testing.T) {
+	dir := t.TempDir()
+	expected := time.Date(2023, 7, 14, 18, 30, 5, 0, time.FixedZone("", 2*60*60))
+
+	files := map[string][]byte{
+		"photo.jpg":  buildJPEG(buildTIFFExif(binary.BigEndian, "Canon", "Canon EOS R6", "2023:07:14 18:30:05")),
+		"photo.tiff": buildTIFFExif(binary.LittleEndian, "Canon", "Canon EOS R6", "2023:07:14 18:30:05"),
+		"photo.heic": buildHEIF(buildTIFFExif(binary.BigEndian, "Canon", "Canon EOS R6", "2023:07:14 18:30:05")),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+
+		exif, err := ReadExif(path)
+		assert.NoError(t, err, name)
+		if assert.NotNil(t, exif, name) {
+			assert.True(t, expected.Equal(exif.TakenAt), "%s: %v", name, exif.TakenAt)
+			assert.Equal(t, "Canon EOS R6", exif.Camera(), name)
+			assert.Equal(t, 6, exif.Orientation, name)
+			assert.True(t, exif.HasGPS, name)
+		}
+	}
+
+	// A box whose 64 bit size overflows the end of its parent
+	hugeBox := binary.BigEndian.AppendUint64(append(binary.BigEndian.AppendUint32(nil, 1), "iinf"...), 0x7FFFFFFFFFFFFFFF)
+	malformed := bytes.Join([][]byte{isoBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), isoBoxBytes("meta", []byte{0, 0, 0, 0}, isoBoxBytes("hdlr"), hugeBox)}, nil)
+
+	// Photos without EXIF data, malformed photos, and other files, have none
+	for name, content := range map[string][]byte{"plain.jpg": {0xFF, 0xD8, 0xFF, 0xD9}, "broken.jpg": []byte("not a jpeg"), "malformed.heic": malformed, "notes.txt": []byte("text")} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+		exif, err := ReadExif(path)
+		assert.NoError(t, err, name)
+		assert.Nil(t, exif, name)
+	}
+}
+
+func TestOrganizePhotosByExif(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/IMG_0001.jpg": string(buildJPEG(buildTIFFExif(binary.BigEndian, "FUJIFILM", "X-T4", "2021:03:02 10:00:00"))),
+		"source/IMG_0002.jpg": string(buildJPEG(buildTIFFExif(binary.LittleEndian, "Apple", "iPhone 12", "2019:12:24 20:00:00"))),
+		"source/download.jpg": string([]byte{0xFF, 0xD8, 0xFF, 0xD9}),
+		"config.toml": `file_types = { "Images" = [".jpg"] }
+
+[[rules]]
+name = "iphone"
+target = "Phone/{{.Exif.Year}}"
+camera = "*iphone*"
+
+[[rules]]
+name = "photos"
+target = "Pics/{{.Exif.Year}}/{{.Exif.Camera}}"
+taken_after = "2000-01-01"
+`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	params := &FilePathParams{SourceDir: source, TargetDir: source, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(source, "Pics", "2021", "FUJIFILM X-T4", "IMG_0001.jpg"))
+	assert.FileExists(t, filepath.Join(source, "Phone", "2019", "IMG_0002.jpg"))
+	assert.FileExists(t, filepath.Join(source, "Images", "download.jpg"))
+}
+
+func TestRuleTargetTemplate(t *testing.T) {
+	for _, target := range []string{"Pics/{{.Exif.Nope}}", "Pics/{{.Exif.Year"} {
+		rule := Rule{Name: "invalid", Target: target}
+		assert.Error(t, rule.compile(), target)
+	}
+
+	rule := Rule{Name: "escape", Target: "../{{.Name}}"}
+	assert.NoError(t, rule.compile())
+	_, err := rule.TargetFor(&FileNode{Name: "a.jpg", Metadata: Metadata{NodeType: "file"}})
+	assert.Error(t, err)
+
+	rule = Rule{Name: "camera", Target: "Pics/{{.Exif.Camera}}"}
+	assert.NoError(t, rule.compile())
+	target, err := rule.TargetFor(&FileNode{Name: "a.jpg", Metadata: Metadata{NodeType: "file", Exif: &ExifData{Make: "ACME", Model: "Cam/2"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("Pics", "ACME Cam-2"), target)
+}
+
+func TestContentMetadataIsLazy(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"photo.jpg": string(buildJPEG(buildTIFFExif(binary.BigEndian, "Canon", "Canon EOS R6", "2023:07:14 18:30:05"))),
+	})
+	defer cleanup()
+	path := filepath.Join(dir, "photo.jpg")
+
+	// Metadata of the file system does not read contents, until they are needed
+	metadata, err := GenerateMetadata(path)
+	assert.NoError(t, err)
+	assert.Nil(t, metadata.Exif)
+	fileNode := &FileNode{Path: path, Name: "photo.jpg", Metadata: metadata}
+	ensureContentMetadata(fileNode)
+	if assert.NotNil(t, fileNode.Metadata.Exif) {
+		assert.Equal(t, "Canon EOS R6", fileNode.Metadata.Exif.Camera())
+	}
+
+	// The indexer reads the contents of new files, and not those of unchanged ones on rescans
+	workspaceDB := db.NewMemoryWorkspaceStore()
+	dfs := &DesktopFS{}
+	_, err = dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	record, err := workspaceDB.GetFile(path)
+	assert.NoError(t, err)
+	var recorded Metadata
+	assert.NoError(t, json.Unmarshal(record.Metadata, &recorded))
+	assert.NotNil(t, recorded.Exif)
+
+	_, err = dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	if assert.Len(t, dfs.DirectoryTree.Root.Files, 1) {
+		assert.Nil(t, dfs.DirectoryTree.Root.Files[0].Metadata.Exif)
+	}
+}
@@ -39,6 +39,14 @@ type FilePathParams struct {
 	SourceDir          string
 	TargetDir          string
 	DryRun             bool
+	PruneEmpty         bool
+	InspectArchives    bool                   // Route archives by the category of the files they contain
+	ExtractArchives    bool                   // Extract archives into a sibling folder and organize their contents
+	ExtractMaxSize     int64                  // Maximum uncompressed size of an extracted archive
+	ExtractMaxEntries  int                    // Maximum number of entries of an extracted archive
+	Incremental        bool                   // Scan the source directory incrementally against its workspace database
+	KeepGroups         bool                   // Keep groups of related files together in the folder of their largest file
+	GroupTypes         []string               // Content relationships forming the groups kept together, all when empty
 	ConflictResolution ConflictResolutionType // "overwrite", "skip", or "rename"
 }
 
@@ -50,7 +58,15 @@ type DesktopFS struct {
 	WorkspaceManager *WorkspaceManager
 	DirectoryTree    *DirectoryTree
 	InstanceConfig   *DeskFSConfig
+	WorkspaceID      int    // Active workspace, 0 outside of any workspace
+	WorkspaceRoot    string // Root directory of the active workspace
+	baseConfig       *IntermediateConfig
 	term             *terminal.Terminal
+	journal          *Journal
+	pendingArchives  map[*Rule][]*FileNode
+	archiveMu        sync.Mutex
+	extractedDirs    []string
+	groupTargets     map[*FileNode]string // Folders of the files kept together with their group
 }
 
 // NewFilePathParams initializes FilePathParams with sensible defaults.
@@ -63,10 +79,12 @@ func NewFilePathParams() *FilePathParams {
 		RemoveAfter:        false,    // Default to keeping source files after move
 		DryRun:             false,    // Default to executing actual file operations
 		ConflictResolution: "rename", // Default to renaming files to avoid conflicts
+		ExtractMaxSize:     DefaultExtractMaxSize,
+		ExtractMaxEntries:  DefaultExtractMaxEntries,
 	}
 }
 
-func NewDesktopFS(term *terminal.Terminal, centralDB *db.CentralDBProvider) *DesktopFS {
+func NewDesktopFS(term *terminal.Terminal, centralDB db.CentralStore) *DesktopFS {
 	var err error
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -133,6 +151,13 @@ func CalculateMaxDepth(sourceDir string) (int, error) {
 
 // Move or copy files based on the configuration
 func (dfs *DesktopFS) EnhancedOrganize(cfg *DeskFSConfig, params *FilePathParams) error {
+	dfs.journal = nil
+	err := dfs.organize(cfg, params)
+	dfs.recordRun(EventOrganize, params.SourceDir, err)
+	return err
+}
+
+func (dfs *DesktopFS) organize(cfg *DeskFSConfig, params *FilePathParams) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // Ensure context is canceled after function e
 
@@ -147,14 +172,44 @@ func (dfs *DesktopFS) EnhancedOrganize(cfg *DeskFSConfig, params *FilePathParams
 		}
 	}
 
-	// Calculate the maximum depth of SourceDir
-	maxDepth, err := CalculateMaxDepth(params.SourceDir)
-	if err != nil {
-		return fmt.Errorf("failed to calculate max depth: %w", err)
+	// Record the operations of the run so it can be undone
+	dfs.journal = nil
+	if !params.DryRun {
+		dfs.journal = NewJournal(cfg.CacheDir, params)
+		defer dfs.saveJournal()
 	}
 
-	if err := dfs.buildTreeAndCache(params.SourceDir, params.Recursive, maxDepth); err != nil {
-		return fmt.Errorf("failed to build directory tree: %w", err)
+	// Extract archives first so their contents are part of the tree
+	dfs.extractedDirs = nil
+	if params.ExtractArchives {
+		if err := dfs.extractArchives(params); err != nil {
+			return fmt.Errorf("failed to extract archives: %w", err)
+		}
+	}
+
+	if params.Incremental {
+		if err := dfs.buildTreeIncremental(params); err != nil {
+			return fmt.Errorf("failed to scan workspace: %w", err)
+		}
+	} else {
+		// Calculate the maximum depth of SourceDir
+		maxDepth, err := CalculateMaxDepth(params.SourceDir)
+		if err != nil {
+			return fmt.Errorf("failed to calculate max depth: %w", err)
+		}
+
+		if err := dfs.buildTreeAndCache(params.SourceDir, params.Recursive, maxDepth); err != nil {
+			return fmt.Errorf("failed to build directory tree: %w", err)
+		}
+	}
+
+	dfs.pendingArchives = make(map[*Rule][]*FileNode)
+
+	// Resolve the folders of related files before the files are organized concurrently
+	dfs.groupTargets = nil
+	if params.KeepGroups {
+		dfs.groupTargets = make(map[*FileNode]string)
+		dfs.planGroupTargets(ctx, dfs.DirectoryTree.Root, cfg, params, dfs.groupTargets)
 	}
 
 	var wg sync.WaitGroup
@@ -175,6 +230,18 @@ func (dfs *DesktopFS) EnhancedOrganize(cfg *DeskFSConfig, params *FilePathParams
 		return fmt.Errorf("failed to organize files: %w", err)
 	}
 
+	// Bundle the files matched by archive rules
+	if err := dfs.flushArchives(params); err != nil {
+		return fmt.Errorf("failed to archive files: %w", err)
+	}
+
+	// Remove the directories this run has emptied
+	if params.PruneEmpty && !params.DryRun {
+		if err := dfs.pruneEmptyDirs(params); err != nil {
+			return fmt.Errorf("failed to prune empty directories: %w", err)
+		}
+	}
+
 	// Commit changes if Git is enabled
 	if params.GitEnabled {
 		if err := dfs.GitAddAndCommit(dfs.Cwd, fmt.Sprintf("Organized files for %s", dfs.Cwd)); err != nil {
@@ -187,6 +254,16 @@ func (dfs *DesktopFS) EnhancedOrganize(cfg *DeskFSConfig, params *FilePathParams
 		}
 	}
 
+	// Apply the trash retention policy once the run has finished
+	if !params.DryRun {
+		purged, err := EnforceTrashRetention(cfg.Trash)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Failed to enforce trash retention: %v\n", err))
+		} else if len(purged) > 0 {
+			slog.Info(fmt.Sprintf("Purged %d expired items from the trash\n", len(purged)))
+		}
+	}
+
 	return nil
 }
 
@@ -201,9 +278,46 @@ func (dfs *DesktopFS) InitConfig(optionalConfigPath string) {
 	deskfsConfig = deskfsConfig.BuildFileTypeTree(config)
 
 	// Set the loaded configuration for this instance
+	dfs.baseConfig = config
 	dfs.InstanceConfig = deskfsConfig
 }
 
+// ActivateWorkspace resolves the active workspace for path and applies its stored config on top of the
+// loaded config. Outside of any workspace the loaded config is used and no error is returned.
+func (dfs *DesktopFS) ActivateWorkspace(path string) error {
+	if dfs.WorkspaceManager == nil || dfs.baseConfig == nil {
+		return nil
+	}
+
+	workspaceID, rootDir, err := dfs.WorkspaceManager.ResolveWorkspace(path)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("No active workspace: %v\n", err))
+		if dfs.WorkspaceID != 0 {
+			dfs.InstanceConfig = NewDeskFSConfig().BuildFileTypeTree(dfs.baseConfig)
+			dfs.WorkspaceID, dfs.WorkspaceRoot = 0, ""
+		}
+		return nil
+	}
+
+	// The workspace is active even when its config is invalid, so that the config can be fixed
+	dfs.WorkspaceID = workspaceID
+	dfs.WorkspaceRoot = rootDir
+	slog.Debug(fmt.Sprintf("Active workspace %d at %s\n", workspaceID, rootDir))
+
+	workspace, err := dfs.WorkspaceManager.GetWorkspace(workspaceID)
+	if err != nil {
+		return err
+	}
+	workspaceConfig, err := ParseWorkspaceConfig(workspace.Config)
+	if err != nil {
+		dfs.InstanceConfig = NewDeskFSConfig().BuildFileTypeTree(dfs.baseConfig)
+		return fmt.Errorf("invalid config of workspace %d: %w", workspaceID, err)
+	}
+
+	dfs.InstanceConfig = NewDeskFSConfig().BuildFileTypeTree(dfs.baseConfig.Merge(workspaceConfig))
+	return nil
+}
+
 func (dfs *DesktopFS) GetDesktopCleanerIgnore(dir string) (*ignore.GitIgnore, error) {
 	ignorePath := filepath.Join(dir, ".desktop-cleaner-ignore")
 
@@ -326,12 +440,6 @@ func (dfs *DesktopFS) Move(node *DirectoryNode, dst string, recursive bool, dryr
 	return nil
 }
 
-// MoveToTrash moves a file or directory to the trash (cache) directory
-func (dfs *DesktopFS) MoveToTrash(node *DirectoryNode) error {
-	dst := filepath.Join(dfs.CacheDir, filepath.Base(node.Path))
-	return os.Rename(node.Path, dst)
-}
-
 // buildTreeAndCache recursively builds a directory tree and populates a cache
 func (dfs *DesktopFS) buildTreeAndCache(rootPath string, recursive bool, maxDepth int) error {
 
@@ -373,7 +481,8 @@ func (dfs *DesktopFS) buildTreeNodes(node *DirectoryNode, recursive bool, maxDep
 			node.Children = append(node.Children, childDir)
 			dfs.DirectoryTree.SafeCacheSet(childPath, childDir)
 
-			if !recursive {
+			// Extracted archives are always organized, even in non-recursive runs
+			if !recursive && !dfs.isExtracted(childPath) {
 				continue
 			}
 
@@ -419,8 +528,21 @@ func (dfs *DesktopFS) traverseAndOrganize(ctx context.Context, cancel context.Ca
 			default:
 			}
 
-			// Determine the target folder based on file extension
-			targetDir, found := dfs.determineTargetFolder(ctx, fileNode, cfg)
+			// Files kept together with their group were resolved before the traversal
+			targetDir, found := dfs.groupTargets[fileNode]
+			fileName := filepath.Base(fileNode.Path)
+			if !found {
+				var rule *Rule
+				var name string
+				targetDir, name, rule, found = dfs.resolveTarget(ctx, fileNode, cfg, params)
+				if name != "" {
+					fileName = name
+				}
+				if rule != nil && rule.Action == RuleArchive {
+					dfs.queueArchive(rule, fileNode)
+					return
+				}
+			}
 			if !found {
 				slog.Warn(fmt.Sprintf("Skipping file %s as no target path found\n", fileNode.Name))
 				return // Skip files without a target folder
@@ -429,7 +551,7 @@ func (dfs *DesktopFS) traverseAndOrganize(ctx context.Context, cancel context.Ca
 			// Construct the correct destination directory and path
 			destDir := filepath.Join(params.TargetDir, targetDir)
 			slog.Debug(fmt.Sprintf("Creating directory: %s\n", destDir))
-			destPath := filepath.Join(destDir, filepath.Base(fileNode.Path)) // Only the base name
+			destPath := filepath.Join(destDir, fileName)
 			slog.Debug(fmt.Sprintf("Moving file %s to %s\n", fileNode.Path, destPath))
 
 			// Check if the target file already exists
@@ -452,7 +574,7 @@ func (dfs *DesktopFS) traverseAndOrganize(ctx context.Context, cancel context.Ca
 			slog.Info(fmt.Sprintf("Moving file %s to %s\n", fileNode.Path, destPath))
 
 			// Ensure target directory exists before moving or copying files
-			if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+			if err := dfs.journal.mkdirAll(destDir); err != nil {
 				select {
 				case errCh <- fmt.Errorf("failed to create target directory %s: %w", destDir, err):
 					cancel() // Cancel all ongoing operations
@@ -475,6 +597,15 @@ func (dfs *DesktopFS) traverseAndOrganize(ctx context.Context, cancel context.Ca
 					cancel() // Cancel all ongoing operations
 				default:
 				}
+				return
+			}
+
+			if !params.DryRun {
+				op := JournalMove
+				if params.CopyFiles && !params.RemoveAfter {
+					op = JournalCopy
+				}
+				dfs.journal.Record(op, fileNode.Path, destPath, 0)
 			}
 
 		}(fileNode)
@@ -482,12 +613,87 @@ func (dfs *DesktopFS) traverseAndOrganize(ctx context.Context, cancel context.Ca
 
 	// Process each child directory
 	for _, childDir := range node.Children {
-		if params.Recursive {
+		if params.Recursive || dfs.isExtracted(childDir.Path) {
 			dfs.traverseAndOrganize(ctx, cancel, childDir, cfg, params, wg, errCh)
 		}
 	}
 }
 
+// resolveTarget returns the folder fileNode is organized into, relative to the target directory, its new
+// name when a rule renames it, and the rule it matched if any. Files matched by an archive rule have no folder.
+func (dfs *DesktopFS) resolveTarget(ctx context.Context, fileNode *FileNode, cfg *DeskFSConfig, params *FilePathParams) (string, string, *Rule, bool) {
+	// Rules take precedence over the extension mapping
+	if rule := cfg.matchRule(fileNode); rule != nil {
+		if rule.Action == RuleArchive {
+			return "", "", rule, false
+		}
+		target, name, err := rule.DestinationFor(fileNode)
+		if err == nil {
+			slog.Info(fmt.Sprintf("File %s matched rule %q, target path: %s\n", fileNode.Name, rule.Name, filepath.Join(target, name)))
+			return target, name, rule, true
+		}
+		slog.Warn(fmt.Sprintf("Ignoring rule %q for %s: %v\n", rule.Name, fileNode.Name, err))
+	}
+
+	// Determine the target folder based on file extension
+	targetDir, found := dfs.determineTargetFolder(ctx, fileNode, cfg)
+
+	// Refine the folder of archives by the category of their content
+	if params.InspectArchives && archiveKind(fileNode.Name) != "" {
+		if category, ok := dfs.dominantArchiveCategory(ctx, fileNode.Path, cfg); ok {
+			targetDir = filepath.Join(targetDir, category)
+			found = true
+			slog.Info(fmt.Sprintf("Archive %s mostly contains %s files\n", fileNode.Name, category))
+		}
+	}
+	return targetDir, "", nil, found
+}
+
+// queueArchive defers a file matched by an archive rule until the end of the run.
+func (dfs *DesktopFS) queueArchive(rule *Rule, fileNode *FileNode) {
+	dfs.archiveMu.Lock()
+	defer dfs.archiveMu.Unlock()
+
+	dfs.pendingArchives[rule] = append(dfs.pendingArchives[rule], fileNode)
+}
+
+// flushArchives writes one archive per archive rule with the files queued during the run.
+func (dfs *DesktopFS) flushArchives(params *FilePathParams) error {
+	for rule, files := range dfs.pendingArchives {
+		if params.DryRun {
+			for _, fileNode := range files {
+				slog.Info(fmt.Sprintf("Dry run: archiving %s into %s\n", fileNode.Path, rule.Target))
+			}
+			continue
+		}
+
+		name := rule.Name
+		if name == "" {
+			name = filepath.Base(rule.Target)
+		}
+		target, err := relativeTarget(rule.Target)
+		if err != nil {
+			return fmt.Errorf("archive rule: %w", err)
+		}
+		targetDir := filepath.Join(params.TargetDir, target)
+		if _, err := dfs.archiveFiles(files, params.SourceDir, targetDir, name, ArchiveFormat(rule.Format), OriginalsMode(rule.Originals)); err != nil {
+			return err
+		}
+	}
+	dfs.pendingArchives = nil
+	return nil
+}
+
+// saveJournal persists the journal of the current run if it recorded any operation.
+func (dfs *DesktopFS) saveJournal() {
+	if dfs.journal == nil || len(dfs.journal.Entries) == 0 {
+		return
+	}
+	if err := dfs.journal.Save(); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to save journal for run %s: %v\n", dfs.journal.RunID, err))
+	}
+}
+
 // determineTargetFolder traverses the FileTypeTree in DeskFSConfig to find the appropriate folder
 // based on the file's extension. It returns the path to the target folder if a match is found.
 func (dfs *DesktopFS) determineTargetFolder(ctx context.Context, fileNode *FileNode, cfg *DeskFSConfig) (string, bool) {
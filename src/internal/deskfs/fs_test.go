@@ -6,13 +6,13 @@ import (
 	"path/filepath"
 	"testing"
 
+	"desktop-cleaner/internal/db"
 	"desktop-cleaner/internal/terminal"
 
 	"github.com/stretchr/testify/assert"
 )
 
-// TODO: Setup mock filesystem & Database for testing
-// TODO: Test workspaces feature
+// TODO: Setup mock filesystem for testing
 
 func loadTestConfig(configPath string) *DeskFSConfig {
 	// Call NewConfig with the provided path (can be nil if no path is specified)
@@ -97,15 +97,67 @@ func TestNewConfig(t *testing.T) {
 	})
 
 	t.Run("creates default config if no config found", func(t *testing.T) {
+		dir, cleanup := setupTestDir(t, map[string]string{})
+		defer cleanup()
+		originalDir, _ := os.Getwd()
+		defer os.Chdir(originalDir)
+		os.Chdir(dir)
+
 		config := loadTestConfig("")
 		found := config.FileTypeTree.Root.FindExtension(".md")
 		assert.True(t, found, "Expected to find '.md' extension in default config")
 	})
 }
 
+func TestMergeConfig(t *testing.T) {
+	base, err := ParseWorkspaceConfig("[user_tags]\nxattr = true\n")
+	assert.NoError(t, err)
+
+	// Unset booleans keep the base value, explicitly set ones override it
+	merged := base.Merge(&IntermediateConfig{})
+	assert.True(t, merged.UserTags.XattrEnabled())
+
+	override, err := ParseWorkspaceConfig("[user_tags]\nxattr = false\n")
+	assert.NoError(t, err)
+	merged = base.Merge(override)
+	assert.False(t, merged.UserTags.XattrEnabled())
+	assert.True(t, base.UserTags.XattrEnabled(), "Expected the base config to be left untouched")
+}
+
+func TestSaveConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	xattr := false
+	config := &IntermediateConfig{
+		FileTypes: map[string][]string{"Docs": {".pdf"}},
+		CacheDir:  "/tmp/cache",
+		Trash:     TrashConfig{Retention: "30d"},
+		UserTags:  UserTagsConfig{Xattr: &xattr},
+		Rules:     []Rule{{Name: "installers", Action: RuleArchive, Target: "Archive", Extensions: []string{".exe"}}},
+		TagRules:  []TagRule{{Tag: "work", Extensions: []string{".pdf"}}},
+	}
+	assert.NoError(t, config.SaveConfig(config, configPath))
+
+	saved := NewIntermediateConfig(configPath)
+	if assert.NotNil(t, saved) {
+		assert.Equal(t, config.FileTypes, saved.FileTypes)
+		assert.Equal(t, config.CacheDir, saved.CacheDir)
+		assert.Equal(t, config.Trash, saved.Trash)
+		if assert.NotNil(t, saved.UserTags.Xattr) {
+			assert.False(t, *saved.UserTags.Xattr)
+		}
+		if assert.Len(t, saved.Rules, 1) {
+			assert.Equal(t, config.Rules[0].Name, saved.Rules[0].Name)
+			assert.Equal(t, config.Rules[0].Action, saved.Rules[0].Action)
+			assert.Equal(t, config.Rules[0].Target, saved.Rules[0].Target)
+			assert.Equal(t, config.Rules[0].Extensions, saved.Rules[0].Extensions)
+		}
+		assert.Equal(t, config.TagRules, saved.TagRules)
+	}
+}
+
 func TestBuildTreeAndCache(t *testing.T) {
 	term := terminal.NewTerminal()
-	dfs := NewDesktopFS(term)
+	dfs := NewDesktopFS(term, db.NewMemoryCentralStore())
 
 	dir, cleanup := setupTestDir(t, map[string]string{
 		"docs/report.docx": "",
@@ -158,7 +210,7 @@ func TestPopulateFileTypes(t *testing.T) {
 
 func TestEnhancedOrganize(t *testing.T) {
 	term := terminal.NewTerminal()
-	dfs := NewDesktopFS(term)
+	dfs := NewDesktopFS(term, db.NewMemoryCentralStore())
 
 	dir, cleanup := setupTestDir(t, map[string]string{
 		"source/report.docx":           "",
@@ -227,7 +279,7 @@ func TestEnhancedOrganize_NonexistentDirs(t *testing.T) {
 
 func initDeskFS(t *testing.T) *DesktopFS {
 	term := terminal.NewTerminal()
-	dfs := NewDesktopFS(term)
+	dfs := NewDesktopFS(term, db.NewMemoryCentralStore())
 
 	dir, cleanup := setupTestDir(t, map[string]string{
 		"source/report.docx":           "",
@@ -0,0 +1,320 @@
+package deskfs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type GraphFormat string
+
+const (
+	GraphDOT     GraphFormat = "dot"
+	GraphGraphML GraphFormat = "graphml"
+	GraphJSON    GraphFormat = "json"
+)
+
+func ParseGraphFormat(value string) (GraphFormat, error) {
+	switch format := GraphFormat(strings.ToLower(value)); format {
+	case GraphDOT, GraphGraphML, GraphJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid graph format %q, expected dot, graphml or json", value)
+}
+
+// GraphOptions selects the part of the relationship graph that is exported.
+type GraphOptions struct {
+	Types    []string // Relationship types to keep, all when empty
+	MaxDepth int      // Maximum depth of the nodes below the root, unlimited when 0
+}
+
+// GraphNode is a directory or file of the relationship graph, identified by its path.
+type GraphNode struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	Type       string    `json:"type"`
+	Depth      int       `json:"depth"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// GraphEdge is a relationship between two nodes. Symmetric relationships are exported once, undirected.
+type GraphEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Type     string `json:"type"`
+	Directed bool   `json:"directed"`
+}
+
+// Graph is the relationship graph of a directory tree.
+type Graph struct {
+	Root  string      `json:"root"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// BuildGraph walks rootPath into a DirectoryTree, adds the metadata and relationships of its nodes and
+// returns the graph of the relationships selected by opts. Workspace directories are left out.
+func (dfs *DesktopFS) BuildGraph(rootPath string, opts GraphOptions) (*Graph, error) {
+	rootPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", rootPath)
+	}
+
+	tree, err := NewDirectoryTree(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	tree.Root.Metadata = metadataFromFileInfo(rootPath, info)
+	depths := map[string]int{rootPath: 0}
+	if err := addGraphNodes(tree.Root, 1, opts.MaxDepth, depths); err != nil {
+		return nil, err
+	}
+
+	if err := dfs.AddRelationships(tree.Root); err != nil {
+		return nil, err
+	}
+	return dfs.newGraph(tree, depths, opts.Types), nil
+}
+
+// addGraphNodes adds the entries of node at depth to the tree, using the Lstat data of each entry so
+// that symlinks are nodes of their own and never followed.
+func addGraphNodes(node *DirectoryNode, depth, maxDepth int, depths map[string]int) error {
+	if maxDepth > 0 && depth > maxDepth {
+		return nil
+	}
+	entries, err := os.ReadDir(node.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(node.Path, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Error getting file info for %s: %v", path, err))
+			continue
+		}
+		depths[path] = depth
+
+		if entry.IsDir() {
+			if entry.Name() == DefaultConfigName {
+				delete(depths, path)
+				continue
+			}
+			child := node.AddChildDirectory(path)
+			child.Metadata = metadataFromFileInfo(path, info)
+			if err := addGraphNodes(child, depth+1, maxDepth, depths); err != nil {
+				return err
+			}
+			continue
+		}
+
+		node.AddFile(&FileNode{
+			Path:       path,
+			Name:       entry.Name(),
+			Extension:  strings.ToLower(filepath.Ext(entry.Name())),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+			Metadata:   metadataFromFileInfo(path, info),
+		})
+	}
+	return nil
+}
+
+func (dfs *DesktopFS) newGraph(tree *DirectoryTree, depths map[string]int, types []string) *Graph {
+	graph := &Graph{Root: tree.Root.Path, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	keep := make(map[string]bool, len(types))
+	for _, relType := range types {
+		keep[relType] = true
+	}
+
+	for _, node := range dfs.collectAllNodes(tree.Root) {
+		label := filepath.Base(node.Path)
+		if node.Path == tree.Root.Path {
+			label = node.Path
+		}
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:         node.Path,
+			Label:      label,
+			Type:       node.Metadata.NodeType,
+			Depth:      depths[node.Path],
+			Size:       node.Metadata.Size,
+			ModifiedAt: node.Metadata.ModifiedAt,
+		})
+
+		for _, relationship := range node.Metadata.Relationships {
+			if len(keep) > 0 && !keep[relationship.Type] {
+				continue
+			}
+			if _, ok := depths[relationship.RelatedNode]; !ok {
+				continue
+			}
+			directed := relationship.Type == "contains" || relationship.Type == "parent"
+			// Symmetric relationships are recorded on both nodes, export them once
+			if !directed && relationship.RelatedNode < node.Path {
+				continue
+			}
+			graph.Edges = append(graph.Edges, GraphEdge{
+				Source:   node.Path,
+				Target:   relationship.RelatedNode,
+				Type:     relationship.Type,
+				Directed: directed,
+			})
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Type < b.Type
+	})
+	return graph
+}
+
+// Write writes the graph to w in format.
+func (graph *Graph) Write(w io.Writer, format GraphFormat) error {
+	switch format {
+	case GraphDOT:
+		return graph.writeDOT(w)
+	case GraphGraphML:
+		return graph.writeGraphML(w)
+	case GraphJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	}
+	return fmt.Errorf("unsupported graph format %q", format)
+}
+
+// writeDOT writes the graph as a Graphviz digraph. Symmetric edges are drawn without arrows.
+func (graph *Graph) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(graph.Root))
+	b.WriteString("  node [fontname=\"Helvetica\"];\n")
+	for _, node := range graph.Nodes {
+		shape := "note"
+		if node.Type == "directory" {
+			shape = "folder"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", dotQuote(node.ID), dotQuote(node.Label), shape)
+	}
+	for _, edge := range graph.Edges {
+		attributes := fmt.Sprintf("label=%s", dotQuote(edge.Type))
+		if !edge.Directed {
+			attributes += ", dir=none, style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotQuote(edge.Source), dotQuote(edge.Target), attributes)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	Name     string `xml:"attr.name,attr"`
+	DataType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed bool          `xml:"directed,attr"`
+	Data     []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// writeGraphML writes the graph as GraphML, with the node attributes and edge types as data keys.
+func (graph *Graph) writeGraphML(w io.Writer) error {
+	doc := graphMLDocument{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Keys = []graphMLKey{
+		{ID: "label", For: "node", Name: "label", DataType: "string"},
+		{ID: "type", For: "node", Name: "type", DataType: "string"},
+		{ID: "depth", For: "node", Name: "depth", DataType: "int"},
+		{ID: "size", For: "node", Name: "size", DataType: "long"},
+		{ID: "modified_at", For: "node", Name: "modified_at", DataType: "string"},
+		{ID: "relationship", For: "edge", Name: "relationship", DataType: "string"},
+	}
+	doc.Graph.ID = graph.Root
+	doc.Graph.EdgeDefault = "directed"
+
+	for _, node := range graph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: []graphMLData{
+			{Key: "label", Value: node.Label},
+			{Key: "type", Value: node.Type},
+			{Key: "depth", Value: fmt.Sprint(node.Depth)},
+			{Key: "size", Value: fmt.Sprint(node.Size)},
+			{Key: "modified_at", Value: node.ModifiedAt.Format(time.RFC3339)},
+		}})
+	}
+	for _, edge := range graph.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source:   edge.Source,
+			Target:   edge.Target,
+			Directed: edge.Directed,
+			Data:     []graphMLData{{Key: "relationship", Value: edge.Type}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,77 @@
+package deskfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildGraph(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"a.txt":              "a",
+		"b.txt":              "b",
+		"docs/c.txt":         "c",
+		"docs/deep/d.txt":    "d",
+		".desktop_cleaner/x": "x",
+	})
+	defer cleanup()
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "b.txt"), old, old))
+
+	dfs := &DesktopFS{}
+	graph, err := dfs.BuildGraph(dir, GraphOptions{MaxDepth: 2})
+	assert.NoError(t, err)
+
+	var ids []string
+	for _, node := range graph.Nodes {
+		ids = append(ids, node.ID)
+	}
+	assert.Contains(t, ids, filepath.Join(dir, "docs", "deep"))
+	assert.NotContains(t, ids, filepath.Join(dir, "docs", "deep", "d.txt"), "Expected nodes below the depth to be left out")
+	assert.NotContains(t, ids, filepath.Join(dir, ".desktop_cleaner"), "Expected the workspace directory to be left out")
+	assert.Contains(t, graph.Edges, GraphEdge{Source: dir, Target: filepath.Join(dir, "docs"), Type: "contains", Directed: true})
+
+	// Temporal edges are exported once, and only between nodes modified within the window
+	temporal := 0
+	for _, edge := range graph.Edges {
+		if edge.Type == TemporalRelationship {
+			temporal++
+			assert.False(t, edge.Directed)
+			assert.Less(t, edge.Source, edge.Target)
+			assert.NotEqual(t, filepath.Join(dir, "b.txt"), edge.Source)
+			assert.NotEqual(t, filepath.Join(dir, "b.txt"), edge.Target)
+		}
+	}
+	assert.NotZero(t, temporal)
+
+	graph, err = dfs.BuildGraph(dir, GraphOptions{Types: []string{"parent"}})
+	assert.NoError(t, err)
+	for _, edge := range graph.Edges {
+		assert.Equal(t, "parent", edge.Type)
+	}
+
+	t.Run("formats", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, graph.Write(&out, GraphJSON))
+		var decoded Graph
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		assert.Len(t, decoded.Edges, len(graph.Edges))
+
+		out.Reset()
+		assert.NoError(t, graph.Write(&out, GraphGraphML))
+		var document graphMLDocument
+		assert.NoError(t, xml.Unmarshal(out.Bytes(), &document))
+		assert.Len(t, document.Graph.Nodes, len(graph.Nodes))
+		assert.Len(t, document.Keys, 6)
+
+		out.Reset()
+		assert.NoError(t, graph.Write(&out, GraphDOT))
+		assert.Contains(t, out.String(), `"`+filepath.Join(dir, "docs")+`" -> "`+dir+`" [label="parent"];`)
+	})
+}
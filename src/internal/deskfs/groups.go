@@ -0,0 +1,348 @@
+package deskfs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content relationships between the files of a directory
+const (
+	SameStemRelationship           = "same-stem"           // Files sharing a name, e.g. photo.jpg, photo.xmp and photo.RAW
+	SubtitleRelationship           = "subtitle"            // Subtitles and the video they belong to, e.g. movie.en.srt and movie.mkv
+	SeriesRelationship             = "series"              // Numbered files, e.g. scan_001.pdf to scan_120.pdf
+	DownloadedTogetherRelationship = "downloaded-together" // Files downloaded from the same page within a short time
+)
+
+// ContentRelationshipTypes lists the content relationships in the order they are detected
+var ContentRelationshipTypes = []string{
+	SameStemRelationship,
+	SubtitleRelationship,
+	SeriesRelationship,
+	DownloadedTogetherRelationship,
+}
+
+const (
+	minSeriesLength          = 3                // Minimum number of files of a series
+	downloadedTogetherWindow = 10 * time.Minute // Maximum time between files downloaded together
+)
+
+var (
+	subtitleExtensions = map[string]bool{".srt": true, ".vtt": true, ".ass": true, ".ssa": true, ".sub": true, ".idx": true}
+	videoExtensions    = map[string]bool{".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".webm": true, ".m4v": true, ".wmv": true}
+	seriesPattern      = regexp.MustCompile(`^(.*?)(\d+)(\D*)$`)
+)
+
+// ContentGroup is a set of related files of a single directory.
+type ContentGroup struct {
+	Type  string
+	Files []*FileNode
+}
+
+type contentDetector func(files []*FileNode) [][]*FileNode
+
+var contentDetectors = map[string]contentDetector{
+	SameStemRelationship:           detectSameStem,
+	SubtitleRelationship:           detectSubtitles,
+	SeriesRelationship:             detectSeries,
+	DownloadedTogetherRelationship: detectDownloadedTogether,
+}
+
+// ParseGroupTypes validates a list of content relationship types. An empty list selects every type.
+func ParseGroupTypes(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return ContentRelationshipTypes, nil
+	}
+	for _, value := range values {
+		if _, ok := contentDetectors[value]; !ok {
+			return nil, fmt.Errorf("invalid group type %q, expected %s", value, strings.Join(ContentRelationshipTypes, ", "))
+		}
+	}
+	return values, nil
+}
+
+// DetectContentGroups returns the groups of related files among files, which share a directory. types
+// selects the detectors to run, all of them when empty.
+func DetectContentGroups(files []*FileNode, types []string) []ContentGroup {
+	selected := make(map[string]bool, len(types))
+	for _, relType := range types {
+		selected[relType] = true
+	}
+
+	var groups []ContentGroup
+	for _, relType := range ContentRelationshipTypes {
+		if len(selected) > 0 && !selected[relType] {
+			continue
+		}
+		for _, members := range contentDetectors[relType](files) {
+			groups = append(groups, ContentGroup{Type: relType, Files: members})
+		}
+	}
+	return groups
+}
+
+// Pairs returns the pairs of files related by the group. Series and downloads are chained in order,
+// other groups are related to their first file, so that the number of pairs stays linear.
+func (group ContentGroup) Pairs() [][2]*FileNode {
+	var pairs [][2]*FileNode
+	for i := 1; i < len(group.Files); i++ {
+		anchor := group.Files[0]
+		if group.Type == SeriesRelationship || group.Type == DownloadedTogetherRelationship {
+			anchor = group.Files[i-1]
+		}
+		pairs = append(pairs, [2]*FileNode{anchor, group.Files[i]})
+	}
+	return pairs
+}
+
+func splitName(fileNode *FileNode) (stem string, ext string) {
+	name := filepath.Base(fileNode.Path)
+	ext = filepath.Ext(name)
+	return strings.TrimSuffix(name, ext), strings.ToLower(ext)
+}
+
+// detectSameStem groups the files with the same name but a different extension.
+func detectSameStem(files []*FileNode) [][]*FileNode {
+	byStem := make(map[string][]*FileNode)
+	for _, fileNode := range files {
+		if stem, _ := splitName(fileNode); stem != "" {
+			byStem[strings.ToLower(stem)] = append(byStem[strings.ToLower(stem)], fileNode)
+		}
+	}
+	return sortedGroups(byStem, 2, func(a, b *FileNode) bool { return a.Path < b.Path })
+}
+
+// detectSubtitles groups each video with its subtitles, whose names may add a language or other tags
+// to the name of the video, e.g. movie.en.forced.srt for movie.mkv.
+func detectSubtitles(files []*FileNode) [][]*FileNode {
+	videos := make(map[string]*FileNode)
+	for _, fileNode := range files {
+		if stem, ext := splitName(fileNode); videoExtensions[ext] {
+			videos[strings.ToLower(stem)] = fileNode
+		}
+	}
+
+	byVideo := make(map[string][]*FileNode)
+	for _, fileNode := range files {
+		stem, ext := splitName(fileNode)
+		if !subtitleExtensions[ext] {
+			continue
+		}
+		for candidate := strings.ToLower(stem); candidate != ""; {
+			if video, ok := videos[candidate]; ok {
+				if len(byVideo[candidate]) == 0 {
+					byVideo[candidate] = []*FileNode{video}
+				}
+				byVideo[candidate] = append(byVideo[candidate], fileNode)
+				break
+			}
+			dot := strings.LastIndex(candidate, ".")
+			if dot < 0 {
+				break
+			}
+			candidate = candidate[:dot]
+		}
+	}
+
+	// The video stays first, its subtitles are related to it
+	groups := sortedGroups(byVideo, 2, nil)
+	for _, group := range groups {
+		subtitles := group[1:]
+		sort.Slice(subtitles, func(i, j int) bool { return subtitles[i].Path < subtitles[j].Path })
+	}
+	return groups
+}
+
+// detectSeries groups the files whose names only differ by a number, in the order of their numbers.
+func detectSeries(files []*FileNode) [][]*FileNode {
+	numbers := make(map[*FileNode]uint64)
+	bySeries := make(map[string][]*FileNode)
+	for _, fileNode := range files {
+		stem, ext := splitName(fileNode)
+		match := seriesPattern.FindStringSubmatch(stem)
+		if match == nil {
+			continue
+		}
+		number, err := strconv.ParseUint(match[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		numbers[fileNode] = number
+		key := strings.ToLower(match[1]) + "\x00" + strings.ToLower(match[3]) + "\x00" + ext
+		bySeries[key] = append(bySeries[key], fileNode)
+	}
+
+	return sortedGroups(bySeries, minSeriesLength, func(a, b *FileNode) bool {
+		if numbers[a] != numbers[b] {
+			return numbers[a] < numbers[b]
+		}
+		return a.Path < b.Path
+	})
+}
+
+// detectDownloadedTogether groups the files downloaded from the same page, as recorded by the browser,
+// in the order they were downloaded. Downloads further apart than downloadedTogetherWindow start a new group.
+func detectDownloadedTogether(files []*FileNode) [][]*FileNode {
+	byOrigin := make(map[string][]*FileNode)
+	for _, fileNode := range files {
+		if origin := fileNode.Metadata.DownloadedFrom; origin != "" {
+			byOrigin[origin] = append(byOrigin[origin], fileNode)
+		}
+	}
+
+	downloadedAt := func(fileNode *FileNode) time.Time {
+		if !fileNode.Metadata.CreatedAt.IsZero() {
+			return fileNode.Metadata.CreatedAt
+		}
+		return fileNode.Metadata.ModifiedAt
+	}
+
+	var groups [][]*FileNode
+	for _, downloads := range sortedGroups(byOrigin, 2, func(a, b *FileNode) bool {
+		if !downloadedAt(a).Equal(downloadedAt(b)) {
+			return downloadedAt(a).Before(downloadedAt(b))
+		}
+		return a.Path < b.Path
+	}) {
+		start := 0
+		for i := 1; i <= len(downloads); i++ {
+			if i < len(downloads) && downloadedAt(downloads[i]).Sub(downloadedAt(downloads[i-1])) <= downloadedTogetherWindow {
+				continue
+			}
+			if i-start >= 2 {
+				groups = append(groups, downloads[start:i])
+			}
+			start = i
+		}
+	}
+	return groups
+}
+
+// sortedGroups returns the groups of byKey with at least minSize files, each sorted with less when set,
+// in the order of their keys.
+func sortedGroups(byKey map[string][]*FileNode, minSize int, less func(a, b *FileNode) bool) [][]*FileNode {
+	keys := make([]string, 0, len(byKey))
+	for key, group := range byKey {
+		if len(group) >= minSize {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	groups := make([][]*FileNode, 0, len(keys))
+	for _, key := range keys {
+		group := byKey[key]
+		if less != nil {
+			sort.Slice(group, func(i, j int) bool { return less(group[i], group[j]) })
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// addContentRelationships adds symmetric relationships between the related files of node and its descendants
+func (dfs *DesktopFS) addContentRelationships(node *DirectoryNode) {
+	for _, group := range DetectContentGroups(node.Files, nil) {
+		for _, pair := range group.Pairs() {
+			a, b := pair[0], pair[1]
+			a.Metadata.Relationships = append(a.Metadata.Relationships, Relationship{RelatedNode: b.Path, Type: group.Type})
+			b.Metadata.Relationships = append(b.Metadata.Relationships, Relationship{RelatedNode: a.Path, Type: group.Type})
+		}
+	}
+	for _, child := range node.Children {
+		dfs.addContentRelationships(child)
+	}
+}
+
+// planGroupTargets keeps the related files of the organized directories together. The files of a group,
+// including those related through other groups, all go to the folder of the largest of them that has a
+// folder. Files matched by an archive rule are left out of their groups.
+func (dfs *DesktopFS) planGroupTargets(ctx context.Context, node *DirectoryNode, cfg *DeskFSConfig, params *FilePathParams, targets map[*FileNode]string) {
+	// The detectors need the times and download origin of the files
+	for _, fileNode := range node.Files {
+		ensureMetadata(fileNode)
+	}
+
+	index := make(map[*FileNode]int, len(node.Files))
+	for i, fileNode := range node.Files {
+		index[fileNode] = i
+	}
+	sets := newUnionFind(len(node.Files))
+	for _, group := range DetectContentGroups(node.Files, params.GroupTypes) {
+		for _, pair := range group.Pairs() {
+			sets.union(index[pair[0]], index[pair[1]])
+		}
+	}
+
+	members := make(map[int][]*FileNode)
+	for i, fileNode := range node.Files {
+		root := sets.find(i)
+		members[root] = append(members[root], fileNode)
+	}
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+
+		var anchor *FileNode
+		var anchorTarget string
+		var eligible []*FileNode
+		for _, fileNode := range group {
+			// Grouped files keep their names, a rule renaming the anchor would split its group
+			target, _, rule, found := dfs.resolveTarget(ctx, fileNode, cfg, params)
+			if rule != nil && rule.Action == RuleArchive {
+				continue
+			}
+			eligible = append(eligible, fileNode)
+			if found && (anchor == nil || fileNode.Size > anchor.Size || (fileNode.Size == anchor.Size && fileNode.Path < anchor.Path)) {
+				anchor, anchorTarget = fileNode, target
+			}
+		}
+		if anchor == nil {
+			continue
+		}
+		for _, fileNode := range eligible {
+			targets[fileNode] = anchorTarget
+			if fileNode != anchor {
+				slog.Info(fmt.Sprintf("Keeping %s together with %s in %s\n", fileNode.Name, anchor.Name, anchorTarget))
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		if params.Recursive || dfs.isExtracted(child.Path) {
+			dfs.planGroupTargets(ctx, child, cfg, params, targets)
+		}
+	}
+}
+
+// unionFind merges the overlapping groups of a directory into disjoint sets
+type unionFind []int
+
+func newUnionFind(size int) unionFind {
+	parents := make(unionFind, size)
+	for i := range parents {
+		parents[i] = i
+	}
+	return parents
+}
+
+func (parents unionFind) find(i int) int {
+	for parents[i] != i {
+		parents[i] = parents[parents[i]]
+		i = parents[i]
+	}
+	return i
+}
+
+func (parents unionFind) union(a, b int) {
+	if rootA, rootB := parents.find(a), parents.find(b); rootA != rootB {
+		parents[rootB] = rootA
+	}
+}
@@ -0,0 +1,105 @@
+package deskfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"desktop-cleaner/internal/db"
+	"desktop-cleaner/internal/terminal"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func groupPaths(groups []ContentGroup, relType string) [][]string {
+	var paths [][]string
+	for _, group := range groups {
+		if group.Type != relType {
+			continue
+		}
+		var names []string
+		for _, fileNode := range group.Files {
+			names = append(names, filepath.Base(fileNode.Path))
+		}
+		paths = append(paths, names)
+	}
+	return paths
+}
+
+func TestDetectContentGroups(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var files []*FileNode
+	add := func(name string, metadata Metadata) {
+		files = append(files, &FileNode{Path: filepath.Join("/dir", name), Name: name, Metadata: metadata})
+	}
+	add("photo.jpg", Metadata{})
+	add("photo.xmp", Metadata{})
+	add("photo.RAW", Metadata{})
+	add("movie.mkv", Metadata{})
+	add("movie.en.forced.srt", Metadata{})
+	add("movie.fr.srt", Metadata{})
+	add("other.srt", Metadata{})
+	for _, n := range []int{10, 2, 1} {
+		add(fmt.Sprintf("scan_%03d.pdf", n), Metadata{})
+	}
+	add("scan_004.png", Metadata{})
+	add("invoice.pdf", Metadata{DownloadedFrom: "https://shop.example/orders", CreatedAt: base})
+	add("receipt.pdf", Metadata{DownloadedFrom: "https://shop.example/orders", CreatedAt: base.Add(time.Minute)})
+	add("later.pdf", Metadata{DownloadedFrom: "https://shop.example/orders", CreatedAt: base.Add(time.Hour)})
+
+	groups := DetectContentGroups(files, nil)
+	assert.Equal(t, [][]string{{"photo.RAW", "photo.jpg", "photo.xmp"}}, groupPaths(groups, SameStemRelationship))
+	assert.Equal(t, [][]string{{"movie.mkv", "movie.en.forced.srt", "movie.fr.srt"}}, groupPaths(groups, SubtitleRelationship))
+	assert.Equal(t, [][]string{{"scan_001.pdf", "scan_002.pdf", "scan_010.pdf"}}, groupPaths(groups, SeriesRelationship))
+	assert.Equal(t, [][]string{{"invoice.pdf", "receipt.pdf"}}, groupPaths(groups, DownloadedTogetherRelationship))
+
+	// Subtitles are related to their video, series are chained
+	for _, group := range groups {
+		if group.Type == SeriesRelationship {
+			pairs := group.Pairs()
+			assert.Len(t, pairs, 2)
+			assert.Equal(t, group.Files[1], pairs[1][0])
+		}
+		if group.Type == SubtitleRelationship {
+			for _, pair := range group.Pairs() {
+				assert.Equal(t, "movie.mkv", pair[0].Name)
+			}
+		}
+	}
+
+	groups = DetectContentGroups(files, []string{SeriesRelationship})
+	assert.Len(t, groups, 1)
+
+	_, err := ParseGroupTypes([]string{"same-stem", "siblings"})
+	assert.Error(t, err)
+}
+
+func TestOrganizeKeepGroups(t *testing.T) {
+	dfs := NewDesktopFS(terminal.NewTerminal(), db.NewMemoryCentralStore())
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/photo.jpg":    "jpeg data",
+		"source/photo.xmp":    "xmp",
+		"source/movie.mkv":    "video data",
+		"source/movie.en.srt": "subtitles",
+		"source/notes.xmp":    "xmp",
+		"config.toml":         `file_types = { "Pics" = [".jpg"], "Vids" = [".mkv"] }`,
+	})
+	defer cleanup()
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	params := NewFilePathParams()
+	params.SourceDir = filepath.Join(dir, "source")
+	params.TargetDir = params.SourceDir
+	params.Recursive = false
+	params.KeepGroups = true
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(params.SourceDir, "Pics", "photo.jpg"))
+	assert.FileExists(t, filepath.Join(params.SourceDir, "Pics", "photo.xmp"), "Expected the sidecar to follow its photo")
+	assert.FileExists(t, filepath.Join(params.SourceDir, "Vids", "movie.mkv"))
+	assert.FileExists(t, filepath.Join(params.SourceDir, "Vids", "movie.en.srt"), "Expected the subtitles to follow their video")
+	assert.FileExists(t, filepath.Join(params.SourceDir, "notes.xmp"), "Expected files without a group or folder to stay")
+}
@@ -0,0 +1,185 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+type HistoryEventType string
+
+const (
+	EventOrganize HistoryEventType = "organize"
+	EventArchive  HistoryEventType = "archive"
+	EventUndo     HistoryEventType = "undo"
+	EventTrash    HistoryEventType = "trash"
+	EventTag      HistoryEventType = "tag"
+	EventConfig   HistoryEventType = "config"
+)
+
+// FileResult is the outcome of an operation on a single file.
+type FileResult struct {
+	Op          string `json:"op"`
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// HistoryPayload is the JSON payload stored with every history event.
+type HistoryPayload struct {
+	RunID    string            `json:"run_id,omitempty"`
+	User     string            `json:"user"`
+	Args     []string          `json:"args,omitempty"`
+	Counts   map[string]int    `json:"counts,omitempty"`
+	Results  []FileResult      `json:"results,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// NewHistoryPayload creates a payload for the current user and command line.
+func NewHistoryPayload(runID string) *HistoryPayload {
+	return &HistoryPayload{
+		RunID:  runID,
+		User:   currentUserName(),
+		Args:   os.Args[1:],
+		Counts: make(map[string]int),
+	}
+}
+
+// AddResult records the outcome of an operation on a file and counts it by operation, or as failed.
+func (payload *HistoryPayload) AddResult(op, source, destination string, err error) {
+	result := FileResult{Op: op, Source: source, Destination: destination}
+	if err != nil {
+		result.Error = err.Error()
+		payload.Counts["failed"]++
+	} else {
+		payload.Counts[op]++
+	}
+	payload.Results = append(payload.Results, result)
+}
+
+// Summary formats the counts of the payload, e.g. "move: 3, mkdir: 1".
+func (payload *HistoryPayload) Summary() string {
+	ops := make([]string, 0, len(payload.Counts))
+	for op := range payload.Counts {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	parts := make([]string, 0, len(ops))
+	for _, op := range ops {
+		parts = append(parts, fmt.Sprintf("%s: %d", op, payload.Counts[op]))
+	}
+	if payload.Error != "" {
+		parts = append(parts, "error: "+payload.Error)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseHistoryPayload decodes the payload of a stored event.
+func ParseHistoryPayload(event db.HistoryEvent) (*HistoryPayload, error) {
+	payload := &HistoryPayload{}
+	if len(event.Payload) == 0 {
+		return payload, nil
+	}
+	if err := json.Unmarshal(event.Payload, payload); err != nil {
+		return nil, fmt.Errorf("failed to decode event %d: %w", event.ID, err)
+	}
+	return payload, nil
+}
+
+func currentUserName() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// RecordHistory stores an event in the history of the workspace containing path. Paths outside
+// of any workspace have no history, and failures are only logged so they never fail an operation.
+func (dfs *DesktopFS) RecordHistory(path string, eventType HistoryEventType, payload *HistoryPayload) {
+	if dfs.WorkspaceManager == nil {
+		return
+	}
+
+	workspaceID, _, err := dfs.WorkspaceManager.FindWorkspaceForPath(path)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Not recording %s event: %v\n", eventType, err))
+		return
+	}
+	dfs.RecordWorkspaceHistory(workspaceID, eventType, payload)
+}
+
+// RecordWorkspaceHistory stores an event in the history of a workspace.
+func (dfs *DesktopFS) RecordWorkspaceHistory(workspaceID int, eventType HistoryEventType, payload *HistoryPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Failed to encode %s event: %v\n", eventType, err))
+		return
+	}
+
+	store, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Failed to record %s event: %v\n", eventType, err))
+		return
+	}
+	defer store.Close()
+
+	event := db.HistoryEvent{Type: string(eventType), RunID: payload.RunID, Payload: data}
+	if _, err := store.AddHistoryEvent(event); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to record %s event: %v\n", eventType, err))
+	}
+}
+
+// recordRun stores the operations journaled by the current run as a history event.
+func (dfs *DesktopFS) recordRun(eventType HistoryEventType, path string, runErr error) {
+	if dfs.journal == nil {
+		return
+	}
+
+	payload := NewHistoryPayload(dfs.journal.RunID)
+	for _, entry := range dfs.journal.Entries {
+		payload.AddResult(string(entry.Op), entry.Source, entry.Destination, nil)
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+	dfs.RecordHistory(path, eventType, payload)
+	dfs.relocateUserTags(path, dfs.journal.Entries)
+}
+
+// UndoRun undoes a journaled run and records it in the history of its workspace.
+func (dfs *DesktopFS) UndoRun(journal *Journal) ([]string, error) {
+	if journal.UndoneAt != nil {
+		return journal.Undo()
+	}
+
+	warnings, err := journal.Undo()
+
+	// Undone moves go back from their destination to their source
+	moves := make([]JournalEntry, 0, len(journal.Entries))
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		moves = append(moves, JournalEntry{Op: entry.Op, Source: entry.Destination, Destination: entry.Source})
+	}
+	dfs.relocateUserTags(journal.SourceDir, moves)
+
+	payload := NewHistoryPayload(journal.RunID)
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		payload.AddResult(string(entry.Op), entry.Source, entry.Destination, nil)
+	}
+	payload.Warnings = warnings
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	dfs.RecordHistory(journal.SourceDir, EventUndo, payload)
+
+	return warnings, err
+}
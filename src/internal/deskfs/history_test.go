@@ -0,0 +1,44 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordHistory(t *testing.T) {
+	dir := t.TempDir()
+	dfs := &DesktopFS{WorkspaceManager: NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())}
+
+	id, err := dfs.WorkspaceManager.CreateWorkspace(dir, "")
+	assert.NoError(t, err)
+
+	payload := NewHistoryPayload("run-1")
+	payload.AddResult("move", filepath.Join(dir, "a.txt"), filepath.Join(dir, "Text", "a.txt"), nil)
+	payload.AddResult("move", filepath.Join(dir, "b.txt"), "", errors.New("permission denied"))
+	dfs.RecordHistory(filepath.Join(dir, "nested"), EventOrganize, payload)
+
+	// Paths outside of any workspace are not recorded
+	dfs.RecordHistory(t.TempDir(), EventTrash, NewHistoryPayload(""))
+
+	store, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	events, err := store.ListHistory(db.HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, string(EventOrganize), events[0].Type)
+	assert.Equal(t, "run-1", events[0].RunID)
+
+	parsed, err := ParseHistoryPayload(events[0])
+	assert.NoError(t, err)
+	assert.Len(t, parsed.Results, 2)
+	assert.Equal(t, "failed: 1, move: 1", parsed.Summary())
+
+	events, err = store.ListHistory(db.HistoryFilter{Type: string(EventUndo)})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
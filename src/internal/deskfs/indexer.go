@@ -0,0 +1,511 @@
+package deskfs
+
+import (
+	"crypto/sha256"
+	"desktop-cleaner/internal/db"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// mtimeGranularity guards against file systems with coarse timestamps: a directory modified within
+// this window of its last scan may have changed again without its mtime moving, so it is re-read.
+const mtimeGranularity = 2 * time.Second
+
+// IndexStats summarizes an index run.
+type IndexStats struct {
+	Indexed     int // Files present in the index after the run
+	Hashed      int // Files whose content was (re)hashed
+	Renamed     int // Files detected as renamed or moved through their inode
+	Removed     int // Records of files that no longer exist
+	SkippedDirs int // Unchanged directories that were not re-read
+}
+
+// fileIdentity identifies a file across renames on the same device.
+type fileIdentity struct {
+	dev, ino uint64
+}
+
+// scanner holds the state of an incremental scan against the records of a workspace database.
+type scanner struct {
+	dfs          *DesktopFS
+	full         bool
+	recursive    bool
+	maxDepth     int // Deepest directory level read below the scanned directory, unlimited when not positive
+	now          time.Time
+	workspaceDir string
+
+	files      map[string]*db.FileRecord
+	filesByDir map[string][]*db.FileRecord
+	identities map[fileIdentity]*db.FileRecord
+	dirs       map[string]db.DirRecord
+	subdirs    map[string][]string
+
+	seenFiles   map[string]bool
+	seenDirs    map[string]bool
+	unscanned   map[string]bool // Directories left unread by a non-recursive or depth limited scan
+	renamedFrom map[string]bool
+	xattrTags   map[string]xattrTaggedFile
+	changed     []db.FileRecord
+	dirty       []db.DirRecord
+	stats       IndexStats
+}
+
+// IndexWorkspace scans rootPath and stores every file with its metadata in the workspace database.
+// Unless full is set, the scan is incremental: see ScanWorkspace.
+func (dfs *DesktopFS) IndexWorkspace(rootPath string, workspaceDB db.WorkspaceStore, full bool) (IndexStats, error) {
+	stats, err := dfs.ScanWorkspace(rootPath, workspaceDB, full)
+	if err != nil {
+		return stats, err
+	}
+
+	logIndexStats(rootPath, stats)
+	return stats, nil
+}
+
+func logIndexStats(path string, stats IndexStats) {
+	slog.Info(fmt.Sprintf("Indexed %d files in %s (%d hashed, %d renamed, %d removed, %d directories unchanged)\n",
+		stats.Indexed, path, stats.Hashed, stats.Renamed, stats.Removed, stats.SkippedDirs))
+}
+
+// ScanWorkspace builds dfs.DirectoryTree for rootPath from the state persisted in the workspace
+// database and updates it. Directories whose mtime has not changed since the previous scan are not
+// re-read, files are only re-hashed when their size or mtime changed, and files that moved are
+// recognized by their inode and device. With full set, every directory is re-read.
+func (dfs *DesktopFS) ScanWorkspace(rootPath string, workspaceDB db.WorkspaceStore, full bool) (IndexStats, error) {
+	return dfs.newScanner(rootPath, full).scan(rootPath, workspaceDB)
+}
+
+// newScanner prepares a recursive scan against the database of the workspace rooted at rootPath.
+func (dfs *DesktopFS) newScanner(rootPath string, full bool) *scanner {
+	return &scanner{
+		dfs:         dfs,
+		full:        full,
+		recursive:   true,
+		now:         time.Now(),
+		files:       make(map[string]*db.FileRecord),
+		filesByDir:  make(map[string][]*db.FileRecord),
+		identities:  make(map[fileIdentity]*db.FileRecord),
+		dirs:        make(map[string]db.DirRecord),
+		subdirs:     make(map[string][]string),
+		seenFiles:   make(map[string]bool),
+		seenDirs:    make(map[string]bool),
+		unscanned:   make(map[string]bool),
+		renamedFrom: make(map[string]bool),
+		xattrTags:   make(map[string]xattrTaggedFile),
+		// The workspace directory holds the database being written to
+		workspaceDir: createWorkspacePath(filepath.Clean(rootPath)),
+	}
+}
+
+// scan builds dfs.DirectoryTree for rootPath, a directory of the workspace, and updates its records.
+func (s *scanner) scan(rootPath string, workspaceDB db.WorkspaceStore) (IndexStats, error) {
+	dfs := s.dfs
+	rootPath = filepath.Clean(rootPath)
+
+	if err := s.load(workspaceDB); err != nil {
+		return s.stats, err
+	}
+
+	tree, err := NewDirectoryTree(rootPath)
+	if err != nil {
+		return s.stats, fmt.Errorf("failed to create directory tree: %w", err)
+	}
+	tree.Cache = make(map[string]*DirectoryNode)
+	dfs.DirectoryTree = tree
+
+	if err := s.scanDir(tree.Root, 0); err != nil {
+		return s.stats, err
+	}
+
+	if err := s.save(workspaceDB, rootPath); err != nil {
+		return s.stats, err
+	}
+	if dfs.xattrTagsEnabled() {
+		if err := dfs.syncXattrTags(workspaceDB, s.xattrTags); err != nil {
+			return s.stats, fmt.Errorf("failed to sync tags with extended attributes: %w", err)
+		}
+	}
+	return s.stats, nil
+}
+
+// buildTreeIncremental builds the tree of the source directory by rescanning it against the
+// database of the workspace containing it, down to the depth the run is limited to.
+func (dfs *DesktopFS) buildTreeIncremental(params *FilePathParams) error {
+	if dfs.WorkspaceManager == nil {
+		return fmt.Errorf("incremental scans require a workspace")
+	}
+
+	workspaceID, _, err := dfs.WorkspaceManager.FindWorkspaceForPath(params.SourceDir)
+	if err != nil {
+		return err
+	}
+
+	workspaceDB, rootPath, err := dfs.WorkspaceManager.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		return err
+	}
+	defer workspaceDB.Close()
+
+	sourceDir, err := filepath.Abs(params.SourceDir)
+	if err != nil {
+		return err
+	}
+
+	s := dfs.newScanner(rootPath, false)
+	s.recursive, s.maxDepth = params.Recursive, params.MaxDepth
+	stats, err := s.scan(sourceDir, workspaceDB)
+	if err != nil {
+		return err
+	}
+	logIndexStats(sourceDir, stats)
+	return nil
+}
+
+// load reads the files and directories recorded by previous scans.
+func (s *scanner) load(workspaceDB db.WorkspaceStore) error {
+	records, err := workspaceDB.ListFiles()
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		record := &records[i]
+		s.files[record.Path] = record
+		s.filesByDir[filepath.Dir(record.Path)] = append(s.filesByDir[filepath.Dir(record.Path)], record)
+		if record.Inode != 0 {
+			s.identities[fileIdentity{record.Device, record.Inode}] = record
+		}
+	}
+
+	dirs, err := workspaceDB.ListDirs()
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		s.dirs[dir.Path] = dir
+		parent := filepath.Dir(dir.Path)
+		if parent != dir.Path {
+			s.subdirs[parent] = append(s.subdirs[parent], dir.Path)
+		}
+	}
+	return nil
+}
+
+// scanDir populates node, at depth below the scanned directory, reusing the recorded listing of the
+// directory when it is unchanged.
+func (s *scanner) scanDir(node *DirectoryNode, depth int) error {
+	info, err := os.Lstat(node.Path)
+	if err != nil {
+		return err
+	}
+	s.seenDirs[node.Path] = true
+	node.Metadata = metadataFromFileInfo(node.Path, info)
+	AddTagsToMetadata(node.Path, &node.Metadata, s.dfs.tagRules())
+
+	stored, known := s.dirs[node.Path]
+	if s.full || !known || !stored.ModifiedAt.Equal(info.ModTime()) || !info.ModTime().Before(stored.ScannedAt.Add(-mtimeGranularity)) {
+		return s.readDir(node, info, depth)
+	}
+
+	// Reuse the recorded listing, unless it disagrees with the disk
+	records := s.filesByDir[node.Path]
+	infos := make([]os.FileInfo, len(records))
+	for i, record := range records {
+		fileInfo, err := os.Lstat(record.Path)
+		if err != nil {
+			return s.readDir(node, info, depth)
+		}
+		infos[i] = fileInfo
+	}
+	for _, childPath := range s.subdirs[node.Path] {
+		if _, err := os.Lstat(childPath); err != nil {
+			return s.readDir(node, info, depth)
+		}
+	}
+
+	s.stats.SkippedDirs++
+	for i, record := range records {
+		if err := s.addFile(node, record.Path, infos[i]); err != nil {
+			return err
+		}
+	}
+	for _, childPath := range s.subdirs[node.Path] {
+		if err := s.addDir(node, childPath, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir lists a new or changed directory and records its mtime.
+func (s *scanner) readDir(node *DirectoryNode, info os.FileInfo, depth int) error {
+	// Take the mtime before reading, so changes made during the scan are seen by the next one
+	s.dirty = append(s.dirty, db.DirRecord{Path: node.Path, ModifiedAt: info.ModTime(), ScannedAt: s.now})
+
+	entries, err := os.ReadDir(node.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		childPath := filepath.Join(node.Path, entry.Name())
+		if entry.IsDir() {
+			if err := s.addDir(node, childPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Error getting file info for %s: %v", childPath, err))
+			continue
+		}
+		if err := s.addFile(node, childPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scanner) addDir(parent *DirectoryNode, path string, depth int) error {
+	if path == s.workspaceDir {
+		return nil
+	}
+
+	child := parent.AddChildDirectory(path)
+	s.dfs.DirectoryTree.SafeCacheSet(path, child)
+
+	// Like buildTreeNodes, directories out of reach of the run are part of the tree but left unread.
+	// New ones are recorded without an mtime, so they are listed with their parent yet read once reached.
+	if (!s.recursive && !s.dfs.isExtracted(path)) || (s.maxDepth > 0 && depth > s.maxDepth) {
+		s.unscanned[path] = true
+		if _, known := s.dirs[path]; !known {
+			s.dirty = append(s.dirty, db.DirRecord{Path: path, ScannedAt: s.now})
+		}
+		return nil
+	}
+	return s.scanDir(child, depth)
+}
+
+// addFile adds a file to the tree and refreshes its record, hashing it only when it changed.
+func (s *scanner) addFile(node *DirectoryNode, path string, info os.FileInfo) error {
+	s.seenFiles[path] = true
+
+	fileNode := &FileNode{
+		Path:       path,
+		Name:       info.Name(),
+		Extension:  strings.ToLower(filepath.Ext(info.Name())),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+		Metadata:   metadataFromFileInfo(path, info),
+	}
+	node.AddFile(fileNode)
+	s.dfs.DirectoryTree.SafeCacheSet(path, node)
+
+	dev, ino, hasIdentity := statIdentity(info)
+
+	previous := s.files[path]
+	if previous == nil && hasIdentity {
+		// A file at a new path with a known identity whose old path is gone was renamed or moved
+		if candidate := s.identities[fileIdentity{dev, ino}]; candidate != nil && !s.seenFiles[candidate.Path] {
+			if _, err := os.Lstat(candidate.Path); os.IsNotExist(err) {
+				previous = candidate
+				s.renamedFrom[candidate.Path] = true
+				s.stats.Renamed++
+				slog.Debug(fmt.Sprintf("Detected rename of %s to %s\n", candidate.Path, path))
+			}
+		}
+	}
+
+	unchanged := previous != nil && previous.Size == info.Size() && previous.ModifiedAt.Equal(info.ModTime())
+	if unchanged && previous.Path == path && previous.Inode == ino && previous.Device == dev && !s.full {
+		fileNode.Metadata.Hash = previous.Hash
+		fileNode.Metadata.MimeType = previous.MimeType
+		AddTagsToMetadata(path, &fileNode.Metadata, s.dfs.tagRules())
+		s.addXattrTags(fileNode, dev, ino)
+		// Tags follow the tag rules and extended attributes, which may have changed since the file was indexed
+		if !slices.Equal(previous.Tags, fileNode.Metadata.Tags) {
+			return s.retag(previous, fileNode.Metadata.Tags)
+		}
+		return nil
+	}
+
+	var hash, mimeType string
+	if unchanged {
+		hash, mimeType = previous.Hash, previous.MimeType
+	} else if info.Mode().IsRegular() {
+		var err error
+		hash, mimeType, err = hashAndDetect(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to index %s: %w", path, err)
+		}
+		s.stats.Hashed++
+	}
+	fileNode.Metadata.Hash = hash
+	fileNode.Metadata.MimeType = mimeType
+	// The recorded content metadata of unchanged files stays valid, only new contents are read
+	if info.Mode().IsRegular() {
+		addContentMetadata(path, &fileNode.Metadata)
+	}
+	// Tags are generated once the MIME type is known
+	AddTagsToMetadata(path, &fileNode.Metadata, s.dfs.tagRules())
+	s.addXattrTags(fileNode, dev, ino)
+
+	metadata, err := json.Marshal(fileNode.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of %s: %w", path, err)
+	}
+
+	s.changed = append(s.changed, db.FileRecord{
+		Path:       path,
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+		Hash:       hash,
+		MimeType:   mimeType,
+		Tags:       fileNode.Metadata.Tags,
+		Metadata:   metadata,
+		Inode:      ino,
+		Device:     dev,
+		IndexedAt:  s.now,
+	})
+	return nil
+}
+
+// retag records new tags for an unchanged file, keeping the rest of its record.
+func (s *scanner) retag(previous *db.FileRecord, tags []string) error {
+	var metadata Metadata
+	if len(previous.Metadata) > 0 {
+		if err := json.Unmarshal(previous.Metadata, &metadata); err != nil {
+			return fmt.Errorf("failed to unmarshal metadata of %s: %w", previous.Path, err)
+		}
+	}
+	metadata.Tags = tags
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of %s: %w", previous.Path, err)
+	}
+
+	record := *previous
+	record.Tags = tags
+	record.Metadata = data
+	record.IndexedAt = s.now
+	s.changed = append(s.changed, record)
+	return nil
+}
+
+// save persists the changed records and drops those under rootPath that were not seen.
+func (s *scanner) save(workspaceDB db.WorkspaceStore, rootPath string) error {
+	if err := workspaceDB.UpsertFiles(s.changed); err != nil {
+		return err
+	}
+	if err := workspaceDB.UpsertDirs(s.dirty); err != nil {
+		return err
+	}
+
+	var removedFiles []string
+	for path := range s.files {
+		if s.seenFiles[path] {
+			continue
+		}
+		if s.renamedFrom[path] {
+			removedFiles = append(removedFiles, path)
+		} else if s.covers(rootPath, path) {
+			removedFiles = append(removedFiles, path)
+			s.stats.Removed++
+		}
+	}
+	if err := workspaceDB.DeleteFiles(removedFiles); err != nil {
+		return err
+	}
+
+	var removedDirs []string
+	for path := range s.dirs {
+		if !s.seenDirs[path] && !s.unscanned[path] && s.covers(rootPath, path) {
+			removedDirs = append(removedDirs, path)
+		}
+	}
+	if err := workspaceDB.DeleteDirs(removedDirs); err != nil {
+		return err
+	}
+
+	s.stats.Indexed = len(s.seenFiles)
+	return nil
+}
+
+// covers reports whether path lies in the part of rootPath that was read by the scan.
+func (s *scanner) covers(rootPath, path string) bool {
+	if !isSameOrAncestor(rootPath, path) {
+		return false
+	}
+	for dir := filepath.Dir(path); dir != rootPath && filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+		if s.unscanned[dir] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashAndDetect computes the SHA-256 of a file and its MIME type, from the extension when known
+// and from the first bytes of the content otherwise.
+func hashAndDetect(path string) (string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	head = head[:n]
+
+	hasher := sha256.New()
+	hasher.Write(head)
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), mimeTypeOf(path, head), nil
+}
+
+// mimeTypeOf returns the MIME type of a file from its extension when known, and from head otherwise.
+func mimeTypeOf(path string, head []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+	return http.DetectContentType(head)
+}
+
+// detectMimeType returns the MIME type of a regular file without hashing it, empty when it cannot be read.
+func detectMimeType(path string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return http.DetectContentType(head[:n])
+}
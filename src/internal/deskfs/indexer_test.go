@@ -0,0 +1,176 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexWorkspace(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"notes.txt":        "hello",
+		"docs/report.json": `{"a": 1}`,
+	})
+	defer cleanup()
+
+	workspaceDB := db.NewMemoryWorkspaceStore()
+
+	dfs := &DesktopFS{}
+	stats, err := dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Indexed, "Expected the workspace database itself not to be indexed")
+
+	record, err := workspaceDB.GetFile(filepath.Join(dir, "notes.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), record.Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", record.Hash)
+	assert.Contains(t, record.MimeType, "text/plain")
+	assert.Contains(t, record.Tags, "file")
+
+	// Removed files are dropped from the index on the next run
+	assert.NoError(t, os.Remove(filepath.Join(dir, "notes.txt")))
+	stats, err = dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Indexed)
+	assert.Equal(t, 1, stats.Removed)
+
+	records, err := workspaceDB.ListFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, filepath.Join(dir, "docs/report.json"), records[0].Path)
+	}
+}
+
+func TestScanWorkspaceIncremental(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"a/one.txt": "one",
+		"b/two.txt": "two",
+	})
+	defer cleanup()
+
+	workspaceDB := db.NewMemoryWorkspaceStore()
+
+	// Directories modified within the mtime granularity of a scan are always re-read
+	past := time.Now().Add(-time.Hour)
+	for _, path := range []string{dir, filepath.Join(dir, "a"), filepath.Join(dir, "b")} {
+		assert.NoError(t, os.Chtimes(path, past, past))
+	}
+
+	dfs := &DesktopFS{}
+	stats, err := dfs.ScanWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Hashed)
+	assert.Equal(t, 0, stats.SkippedDirs)
+
+	stats, err = dfs.ScanWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Indexed)
+	assert.Equal(t, 0, stats.Hashed, "Expected unchanged files not to be re-hashed")
+	assert.Equal(t, 3, stats.SkippedDirs, "Expected unchanged directories not to be re-read")
+	assert.Len(t, dfs.DirectoryTree.Root.Children, 2, "Expected the tree to be rebuilt from the index")
+
+	assert.NoError(t, os.Rename(filepath.Join(dir, "a/one.txt"), filepath.Join(dir, "b/uno.txt")))
+
+	stats, err = dfs.ScanWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Indexed)
+	assert.Equal(t, 1, stats.Renamed)
+	assert.Equal(t, 0, stats.Hashed, "Expected renamed files to keep their hash")
+	assert.Equal(t, 0, stats.Removed)
+
+	record, err := workspaceDB.GetFile(filepath.Join(dir, "b/uno.txt"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, record.Hash)
+
+	_, err = workspaceDB.GetFile(filepath.Join(dir, "a/one.txt"))
+	assert.Error(t, err)
+}
+
+func TestBuildTreeIncrementalSubdirectory(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"top.txt":         "top",
+		"a/one.txt":       "one",
+		"a/b/two.txt":     "two",
+		"a/b/c/three.txt": "three",
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{WorkspaceManager: NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())}
+	workspaceID, err := dfs.WorkspaceManager.CreateWorkspace(dir, "")
+	assert.NoError(t, err)
+	workspaceDB, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(workspaceID)
+	assert.NoError(t, err)
+	_, err = dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+
+	// Files outside of the scanned part of the workspace keep their records even when gone
+	assert.NoError(t, os.Remove(filepath.Join(dir, "top.txt")))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a/b/c/three.txt")))
+
+	err = dfs.buildTreeIncremental(&FilePathParams{SourceDir: filepath.Join(dir, "a"), Recursive: true, MaxDepth: 1})
+	assert.NoError(t, err)
+
+	root := dfs.DirectoryTree.Root
+	assert.Equal(t, filepath.Join(dir, "a"), root.Path)
+	if assert.Len(t, root.Files, 1) && assert.Len(t, root.Children, 1) {
+		assert.Equal(t, "one.txt", root.Files[0].Name)
+		b := root.Children[0]
+		assert.Len(t, b.Files, 1, "Expected the files at the maximum depth to be scanned")
+		if assert.Len(t, b.Children, 1) {
+			assert.Empty(t, b.Children[0].Files, "Expected directories below the maximum depth to be left unread")
+		}
+	}
+
+	for _, path := range []string{"top.txt", "a/one.txt", "a/b/two.txt", "a/b/c/three.txt"} {
+		_, err := workspaceDB.GetFile(filepath.Join(dir, path))
+		assert.NoError(t, err, path)
+	}
+
+	// Non-recursive runs only read the source directory itself
+	err = dfs.buildTreeIncremental(&FilePathParams{SourceDir: filepath.Join(dir, "a")})
+	assert.NoError(t, err)
+	if assert.Len(t, dfs.DirectoryTree.Root.Children, 1) {
+		assert.Empty(t, dfs.DirectoryTree.Root.Children[0].Files)
+	}
+
+	// Once reached, the removed file is dropped
+	err = dfs.buildTreeIncremental(&FilePathParams{SourceDir: filepath.Join(dir, "a"), Recursive: true})
+	assert.NoError(t, err)
+	_, err = workspaceDB.GetFile(filepath.Join(dir, "a/b/c/three.txt"))
+	assert.Error(t, err)
+	_, err = workspaceDB.GetFile(filepath.Join(dir, "top.txt"))
+	assert.NoError(t, err)
+}
+
+func TestScanWorkspaceRetagsUnchangedFiles(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"report.pdf": "report",
+	})
+	defer cleanup()
+
+	workspaceDB := db.NewMemoryWorkspaceStore()
+	dfs := &DesktopFS{InstanceConfig: &DeskFSConfig{}}
+	_, err := dfs.ScanWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+
+	record, err := workspaceDB.GetFile(filepath.Join(dir, "report.pdf"))
+	assert.NoError(t, err)
+	assert.NotContains(t, record.Tags, "work")
+
+	// A new tag rule applies to files that did not change since they were indexed
+	dfs.InstanceConfig.TagRules = compileTagRules([]TagRule{{Tag: "work", Extensions: []string{".pdf"}}})
+	stats, err := dfs.ScanWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Hashed)
+
+	record, err = workspaceDB.GetFile(filepath.Join(dir, "report.pdf"))
+	assert.NoError(t, err)
+	assert.Contains(t, record.Tags, "work")
+	assert.Contains(t, string(record.Metadata), "work")
+	assert.NotEmpty(t, record.Hash)
+}
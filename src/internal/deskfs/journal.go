@@ -0,0 +1,336 @@
+package deskfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JournalOp string
+
+const (
+	JournalMove  JournalOp = "move"
+	JournalCopy  JournalOp = "copy"
+	JournalMkdir JournalOp = "mkdir"
+	JournalRmdir JournalOp = "rmdir"
+	// JournalArchive records an archive written by the run, JournalTrash a file it moved to the trash
+	JournalArchive JournalOp = "archive"
+	JournalTrash   JournalOp = "trash"
+	// JournalExtract records a file (destination) extracted from an archive (source)
+	JournalExtract JournalOp = "extract"
+	// JournalRemove records an original (source) removed once written to an archive (destination) as entry
+	JournalRemove JournalOp = "remove"
+)
+
+const journalDirName = "journal"
+
+// JournalEntry records a single file system operation performed during a run.
+type JournalEntry struct {
+	Op          JournalOp   `json:"op"`
+	Source      string      `json:"source"`
+	Destination string      `json:"destination,omitempty"`
+	Mode        os.FileMode `json:"mode,omitempty"`  // Permissions of removed directories, used to recreate them
+	Entry       string      `json:"entry,omitempty"` // Name of a removed original inside its archive
+	Time        time.Time   `json:"time"`
+}
+
+// Journal is the ordered record of the operations of one organize run, used to undo it.
+type Journal struct {
+	RunID     string         `json:"run_id"`
+	StartedAt time.Time      `json:"started_at"`
+	SourceDir string         `json:"source_dir"`
+	TargetDir string         `json:"target_dir"`
+	UndoneAt  *time.Time     `json:"undone_at,omitempty"`
+	Entries   []JournalEntry `json:"entries"`
+	path      string
+	mu        sync.Mutex
+}
+
+// NewJournal creates an empty journal stored under cacheDir.
+func NewJournal(cacheDir string, params *FilePathParams) *Journal {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir
+	}
+
+	runID := newRunID()
+	return &Journal{
+		RunID:     runID,
+		StartedAt: time.Now(),
+		SourceDir: params.SourceDir,
+		TargetDir: params.TargetDir,
+		Entries:   []JournalEntry{},
+		path:      filepath.Join(cacheDir, journalDirName, runID+".json"),
+	}
+}
+
+// newRunID returns a sortable, unique identifier for a run.
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Record appends an operation to the journal. It is safe for concurrent use.
+func (journal *Journal) Record(op JournalOp, source, destination string, mode os.FileMode) {
+	if journal == nil {
+		return
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	journal.Entries = append(journal.Entries, JournalEntry{
+		Op:          op,
+		Source:      source,
+		Destination: destination,
+		Mode:        mode,
+		Time:        time.Now(),
+	})
+}
+
+// recordRemove appends the removal of an original that was written to archivePath as entry.
+func (journal *Journal) recordRemove(source, archivePath, entry string) {
+	if journal == nil {
+		return
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	journal.Entries = append(journal.Entries, JournalEntry{
+		Op:          JournalRemove,
+		Source:      source,
+		Destination: archivePath,
+		Entry:       entry,
+		Time:        time.Now(),
+	})
+}
+
+// append adds entries recorded separately to the journal.
+func (journal *Journal) append(entries []JournalEntry) {
+	if journal == nil {
+		return
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	journal.Entries = append(journal.Entries, entries...)
+}
+
+// Save writes the journal to disk.
+func (journal *Journal) Save() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(journal.path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+
+	if err := os.WriteFile(journal.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write journal %s: %w", journal.path, err)
+	}
+	return nil
+}
+
+// ListJournals returns the journals stored under cacheDir, newest first.
+func ListJournals(cacheDir string) ([]*Journal, error) {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir
+	}
+
+	dir := filepath.Join(cacheDir, journalDirName)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var journals []*Journal
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		journal, err := loadJournal(filepath.Join(dir, file.Name()))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Skipping unreadable journal %s: %v\n", file.Name(), err))
+			continue
+		}
+		journals = append(journals, journal)
+	}
+
+	sort.Slice(journals, func(i, j int) bool {
+		return journals[i].RunID > journals[j].RunID
+	})
+	return journals, nil
+}
+
+// FindJournal returns the journal for runID, or the most recent run that has not been undone.
+func FindJournal(cacheDir, runID string) (*Journal, error) {
+	journals, err := ListJournals(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, journal := range journals {
+		if runID != "" && strings.HasPrefix(journal.RunID, runID) {
+			return journal, nil
+		}
+		if runID == "" && journal.UndoneAt == nil {
+			return journal, nil
+		}
+	}
+
+	if runID != "" {
+		return nil, fmt.Errorf("no journal found for run %s", runID)
+	}
+	return nil, fmt.Errorf("no run left to undo")
+}
+
+func loadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, err
+	}
+	journal.path = path
+	return journal, nil
+}
+
+// Undo reverts the operations of a journal in reverse order. Operations that cannot be
+// reverted because the file system has changed since are skipped and returned as warnings.
+func (journal *Journal) Undo() ([]string, error) {
+	if journal.UndoneAt != nil {
+		return nil, fmt.Errorf("run %s was already undone", journal.RunID)
+	}
+
+	var warnings []string
+	// Archives still holding originals that could not be restored are kept
+	keptArchives := map[string]bool{}
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+
+		switch entry.Op {
+		case JournalMove:
+			if _, err := os.Lstat(entry.Source); err == nil {
+				warnings = append(warnings, fmt.Sprintf("not restoring %s: path already exists", entry.Source))
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(entry.Source), os.ModePerm); err != nil {
+				return warnings, fmt.Errorf("failed to recreate directory for %s: %w", entry.Source, err)
+			}
+			if err := os.Rename(entry.Destination, entry.Source); err != nil {
+				warnings = append(warnings, fmt.Sprintf("could not move %s back: %v", entry.Destination, err))
+			}
+		case JournalCopy:
+			if err := os.Remove(entry.Destination); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				warnings = append(warnings, fmt.Sprintf("could not remove copy %s: %v", entry.Destination, err))
+			}
+		case JournalMkdir:
+			// Only remove directories the run created if nothing else has been put in them since
+			if err := os.Remove(entry.Source); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				slog.Debug(fmt.Sprintf("Keeping directory %s: %v\n", entry.Source, err))
+			}
+		case JournalArchive:
+			if keptArchives[entry.Source] {
+				warnings = append(warnings, fmt.Sprintf("keeping archive %s: not every removed original was restored", entry.Source))
+				continue
+			}
+			if err := os.Remove(entry.Source); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				warnings = append(warnings, fmt.Sprintf("could not remove archive %s: %v", entry.Source, err))
+			}
+		case JournalExtract:
+			// Extracted folders are removed by their mkdir entries once emptied of the extracted files
+			if err := os.Remove(entry.Destination); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				warnings = append(warnings, fmt.Sprintf("could not remove extracted file %s: %v", entry.Destination, err))
+			}
+		case JournalRemove:
+			// Removed originals are extracted back from their archive, which is still there at this point
+			if _, err := os.Lstat(entry.Source); err == nil {
+				warnings = append(warnings, fmt.Sprintf("not restoring %s: path already exists", entry.Source))
+				keptArchives[entry.Destination] = true
+				continue
+			}
+			if err := restoreArchivedFile(entry.Destination, entry.Entry, entry.Source); err != nil {
+				warnings = append(warnings, fmt.Sprintf("could not restore %s from archive %s: %v", entry.Source, entry.Destination, err))
+				keptArchives[entry.Destination] = true
+			}
+		case JournalTrash:
+			if _, err := os.Lstat(entry.Source); err == nil {
+				warnings = append(warnings, fmt.Sprintf("not restoring %s: path already exists", entry.Source))
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(entry.Source), os.ModePerm); err != nil {
+				return warnings, fmt.Errorf("failed to recreate directory for %s: %w", entry.Source, err)
+			}
+			if err := os.Rename(entry.Destination, entry.Source); err != nil {
+				warnings = append(warnings, fmt.Sprintf("could not restore %s from the trash: %v", entry.Source, err))
+				continue
+			}
+			infoPath := filepath.Join(filepath.Dir(filepath.Dir(entry.Destination)), trashInfoDir, filepath.Base(entry.Destination)+trashInfoExt)
+			os.Remove(infoPath)
+		case JournalRmdir:
+			mode := entry.Mode.Perm()
+			if mode == 0 {
+				mode = 0755
+			}
+			if err := os.MkdirAll(entry.Source, mode); err != nil {
+				warnings = append(warnings, fmt.Sprintf("could not recreate directory %s: %v", entry.Source, err))
+			}
+		default:
+			warnings = append(warnings, fmt.Sprintf("unknown journal operation %q", entry.Op))
+		}
+	}
+
+	now := time.Now()
+	journal.UndoneAt = &now
+	if err := journal.Save(); err != nil {
+		return warnings, err
+	}
+	return warnings, nil
+}
+
+// mkdirAll creates dir and its missing parents, recording every directory it creates.
+func (journal *Journal) mkdirAll(dir string) error {
+	var missing []string
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(current); err == nil {
+			break
+		}
+		missing = append(missing, current)
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Record parents first so undo removes the deepest directories first
+	for i := len(missing) - 1; i >= 0; i-- {
+		journal.Record(JournalMkdir, missing[i], "", 0)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package deskfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneEmptyDirsAndUndo(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/nested/deeper/report.docx": "",
+		"source/keep/photo.jpg":            "",
+		"source/empty":                     "",
+		"target/.desktop_cleaner.toml":     `file_types = { "docs/Reports" = [".docx"] }`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "target/.desktop_cleaner.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	params := &FilePathParams{
+		SourceDir:          filepath.Join(dir, "source"),
+		TargetDir:          filepath.Join(dir, "target"),
+		Recursive:          true,
+		PruneEmpty:         true,
+		ConflictResolution: RenameSuffix,
+	}
+
+	err := dfs.EnhancedOrganize(dfs.InstanceConfig, params)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dir, "target/docs/Reports/report.docx"))
+	assert.NoDirExists(t, filepath.Join(dir, "source/nested"), "Expected emptied directories to be pruned")
+	assert.DirExists(t, filepath.Join(dir, "source/empty"), "Expected directories empty before the run to be kept")
+	assert.FileExists(t, filepath.Join(dir, "source/keep/photo.jpg"))
+
+	journal, err := FindJournal(dfs.InstanceConfig.CacheDir, "")
+	assert.NoError(t, err)
+
+	warnings, err := journal.Undo()
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	assert.FileExists(t, filepath.Join(dir, "source/nested/deeper/report.docx"))
+	assert.NoDirExists(t, filepath.Join(dir, "target/docs"), "Expected directories created by the run to be removed")
+
+	_, err = FindJournal(dfs.InstanceConfig.CacheDir, "")
+	assert.Error(t, err, "Expected no run left to undo")
+}
@@ -1,10 +1,43 @@
 package deskfs
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
+	"sort"
 	"time"
 )
 
+// TemporalRelationship relates nodes modified within the configured window of each other
+const TemporalRelationship = "modified-around-same-time"
+
+const (
+	defaultTemporalWindow   = 24 * time.Hour
+	defaultMaxTemporalEdges = 10
+)
+
+// RelationshipConfig controls the temporal relationships added between nodes.
+type RelationshipConfig struct {
+	TemporalWindow   string `toml:"temporal_window"`    // Maximum difference in modification time, e.g. "6h" or "2d"; defaults to a day
+	MaxTemporalEdges int    `toml:"max_temporal_edges"` // Maximum temporal relationships per node, closest first; defaults to 10, negative for no limit
+}
+
+// temporalSettings returns the window and the cap on edges per node, applying the defaults.
+func (cfg RelationshipConfig) temporalSettings() (time.Duration, int, error) {
+	window := defaultTemporalWindow
+	if cfg.TemporalWindow != "" {
+		var err error
+		if window, err = ParseAge(cfg.TemporalWindow); err != nil {
+			return 0, 0, fmt.Errorf("invalid temporal window: %w", err)
+		}
+	}
+	maxEdges := cfg.MaxTemporalEdges
+	if maxEdges == 0 {
+		maxEdges = defaultMaxTemporalEdges
+	}
+	return window, maxEdges, nil
+}
+
 // Relationship captures an edge between two nodes with a specific meaning
 type Relationship struct {
 	RelatedNode string // Path of the related node
@@ -13,14 +46,28 @@ type Relationship struct {
 
 // Metadata holds additional information for each node in the DirectoryTree
 type Metadata struct {
-	Size          int64          // Size of the file or directory
-	ModifiedAt    time.Time      // Last modified time
-	CreatedAt     time.Time      // Creation time (if available)
-	NodeType      string         // "file" or "directory"
-	Permissions   os.FileMode    // File permissions
-	Owner         string         // Owner of the file (if available)
-	Tags          []string       // Tags associated with the file or directory
-	Relationships []Relationship // Relationships to other nodes
+	Size                  int64          // Size of the file or directory
+	ModifiedAt            time.Time      // Last modified time
+	CreatedAt             time.Time      // Creation time (if available)
+	CreatedAtIsChangeTime bool           // CreatedAt is the inode change time, the filesystem does not record creation times
+	NodeType              string         // "file" or "directory"
+	Permissions           os.FileMode    // File permissions
+	Owner                 string         // Owner of the file (if available)
+	Group                 string         // Group of the file (if available)
+	Inode                 uint64         // Inode number (if available)
+	Device                uint64         // Device number of the filesystem holding the node (if available)
+	Links                 uint64         // Number of hard links (if available)
+	DownloadedFrom        string         // Page or URL the file was downloaded from (if recorded by the browser)
+	Hash                  string         // SHA-256 of the file content, set when indexing
+	MimeType              string         // MIME type of the file, set when indexing
+	Exif                  *ExifData      // EXIF metadata of photos (if recorded and read, see ensureContentMetadata)
+	Audio                 *AudioData     // Tags of audio files (if recorded and read)
+	Document              *DocumentData  // Embedded metadata of PDFs and Office documents (if recorded and read)
+	Tags                  []string       // Tags associated with the file or directory
+	Relationships         []Relationship // Relationships to other nodes
+
+	tagsGenerated bool // Tags were generated, rather than left empty by a scan without tagging
+	contentRead   bool // Exif, Audio and Document were read from the content of the file
 }
 
 // GenerateMetadata generates metadata for a given file or directory node
@@ -29,14 +76,16 @@ func GenerateMetadata(nodePath string) (Metadata, error) {
 	if err != nil {
 		return Metadata{}, err
 	}
+	return metadataFromFileInfo(nodePath, fileInfo), nil
+}
 
+// metadataFromFileInfo builds the metadata of a node from its FileInfo, completed with what the
+// platform records about the node at nodePath. The content of files is not read.
+func metadataFromFileInfo(nodePath string, fileInfo os.FileInfo) Metadata {
 	// Get file permissions and modification time
 	permissions := fileInfo.Mode()
 	modifiedAt := fileInfo.ModTime()
 
-	// Placeholder for createdAt, as it may not be available on all systems
-	createdAt := time.Time{}
-
 	// Set NodeType to "file" or "directory"
 	nodeType := "file"
 	if fileInfo.IsDir() {
@@ -47,14 +96,60 @@ func GenerateMetadata(nodePath string) (Metadata, error) {
 	metadata := Metadata{
 		Size:        fileInfo.Size(),
 		ModifiedAt:  modifiedAt,
-		CreatedAt:   createdAt,
 		NodeType:    nodeType,
 		Permissions: permissions,
-		Owner:       "unknown",  // TODO: Owner retrieval can be implemented based on platform
+		Owner:       "unknown",
+		Group:       "unknown",
 		Tags:        []string{}, // Initialize with an empty list of tags
 	}
+	addPlatformMetadata(nodePath, fileInfo, &metadata)
 
-	return metadata, nil
+	return metadata
+}
+
+// addContentMetadata completes metadata with what the content of the file records about itself
+func addContentMetadata(nodePath string, metadata *Metadata) {
+	exif, err := ReadExif(nodePath)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Skipping EXIF data: %v\n", err))
+	}
+	metadata.Exif = exif
+
+	audio, err := ReadAudioTags(nodePath)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Skipping audio tags: %v\n", err))
+	}
+	metadata.Audio = audio
+
+	document, err := ReadDocumentInfo(nodePath)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Skipping document metadata: %v\n", err))
+	}
+	metadata.Document = document
+	metadata.contentRead = true
+}
+
+// ensureMetadata fills the metadata of a file node built without it, as by a full scan
+func ensureMetadata(fileNode *FileNode) {
+	if fileNode.Metadata.NodeType != "" {
+		return
+	}
+	if info, err := os.Lstat(fileNode.Path); err == nil {
+		fileNode.Metadata = metadataFromFileInfo(fileNode.Path, info)
+	}
+}
+
+// ensureContentMetadata fills the metadata of a file node, and reads what its content records about
+// itself. Contents are only read when a rule or template needs them, as parsing them is costly.
+func ensureContentMetadata(fileNode *FileNode) {
+	ensureMetadata(fileNode)
+	metadata := &fileNode.Metadata
+	if metadata.contentRead || metadata.Exif != nil || metadata.Audio != nil || metadata.Document != nil {
+		return
+	}
+	if metadata.Permissions.IsRegular() {
+		addContentMetadata(fileNode.Path, metadata)
+	}
 }
 
 // AddMetadataToTree recursively traverses the DirectoryTree and adds metadata to each node
@@ -65,7 +160,7 @@ func (dfs *DesktopFS) AddMetadataToTree(node *DirectoryNode) error {
 		return err
 	}
 	// Add tags to metadata
-	AddTagsToMetadata(&metadata)
+	AddTagsToMetadata(node.Path, &metadata, dfs.tagRules())
 	node.Metadata = metadata
 
 	// Add metadata to all files within the directory
@@ -75,7 +170,7 @@ func (dfs *DesktopFS) AddMetadataToTree(node *DirectoryNode) error {
 			return err
 		}
 		// Add tags to file metadata
-		AddTagsToMetadata(&fileMetadata)
+		AddTagsToMetadata(fileNode.Path, &fileMetadata, dfs.tagRules())
 		fileNode.Metadata = fileMetadata
 	}
 
@@ -112,33 +207,82 @@ func (dfs *DesktopFS) FlattenMetadata(node *DirectoryNode) map[string]interface{
 	return flatMetadata
 }
 
-// AddRelationships adds relationships between nodes in the DirectoryTree
-func (dfs *DesktopFS) AddRelationships(node *DirectoryNode) {
-	// Add parent-child relationships
+// AddRelationships adds relationships between nodes in the DirectoryTree: "contains" and "parent" between
+// directories and their contents, symmetric "modified-around-same-time" relationships between the
+// directories and files modified within the configured window of each other, and symmetric content
+// relationships between related files of the same directory.
+func (dfs *DesktopFS) AddRelationships(node *DirectoryNode) error {
+	var cfg RelationshipConfig
+	if dfs.InstanceConfig != nil {
+		cfg = dfs.InstanceConfig.Relationships
+	}
+	window, maxEdges, err := cfg.temporalSettings()
+	if err != nil {
+		return err
+	}
+
+	dfs.addStructuralRelationships(node)
+	dfs.addContentRelationships(node)
+	addTemporalRelationships(dfs.collectAllNodes(node), window, maxEdges)
+	return nil
+}
+
+// addStructuralRelationships adds the parent-child relationships of node and its descendants
+func (dfs *DesktopFS) addStructuralRelationships(node *DirectoryNode) {
 	for _, child := range node.Children {
 		dfs.AddRelationship(node, child.Path, "contains")
 		dfs.AddRelationship(child, node.Path, "parent")
-		// Recursively add relationships to children
-		dfs.AddRelationships(child)
+		dfs.addStructuralRelationships(child)
 	}
 
 	for _, file := range node.Files {
 		dfs.AddRelationship(node, file.Path, "contains")
 	}
+}
+
+// addTemporalRelationships relates nodes modified within window of each other. Nodes are sorted by
+// modification time, and each node is paired with at most maxEdges of its successors within the window.
+// Pairs are then accepted closest first while both nodes have fewer than maxEdges temporal relationships,
+// so that bursts of files modified together stay linear instead of quadratic. A negative maxEdges
+// relates every pair within the window.
+func addTemporalRelationships(nodes []relatedNode, window time.Duration, maxEdges int) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i].Metadata.ModifiedAt, nodes[j].Metadata.ModifiedAt
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return nodes[i].Path < nodes[j].Path
+	})
 
-	// Add temporal relationships
-	allNodes := dfs.collectAllNodes(node)
-	for i, nodeA := range allNodes {
-		for j, nodeB := range allNodes {
-			if i != j && nodeA.Metadata.ModifiedAt.Sub(nodeB.Metadata.ModifiedAt) < time.Hour*24 {
-				// If nodes were modified within a day of each other, relate them
-				relationship := Relationship{
-					RelatedNode: nodeB.Path,
-					Type:        "modified-around-same-time",
-				}
-				nodeA.Metadata.Relationships = append(nodeA.Metadata.Relationships, relationship)
+	type pair struct {
+		a, b int
+		gap  time.Duration
+	}
+	var pairs []pair
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			if maxEdges >= 0 && j-i > maxEdges {
+				break
+			}
+			gap := nodes[j].Metadata.ModifiedAt.Sub(nodes[i].Metadata.ModifiedAt)
+			if gap > window {
+				break
 			}
+			pairs = append(pairs, pair{a: i, b: j, gap: gap})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].gap < pairs[j].gap })
+
+	edges := make([]int, len(nodes))
+	for _, p := range pairs {
+		if maxEdges >= 0 && (edges[p.a] >= maxEdges || edges[p.b] >= maxEdges) {
+			continue
 		}
+		a, b := nodes[p.a], nodes[p.b]
+		a.Metadata.Relationships = append(a.Metadata.Relationships, Relationship{RelatedNode: b.Path, Type: TemporalRelationship})
+		b.Metadata.Relationships = append(b.Metadata.Relationships, Relationship{RelatedNode: a.Path, Type: TemporalRelationship})
+		edges[p.a]++
+		edges[p.b]++
 	}
 }
 
@@ -150,10 +294,18 @@ func (dfs *DesktopFS) AddRelationship(node *DirectoryNode, relatedPath string, r
 	node.Metadata.Relationships = append(node.Metadata.Relationships, relationship)
 }
 
+// relatedNode is a directory or file node whose metadata relationships are added to
+type relatedNode struct {
+	Path     string
+	Metadata *Metadata
+}
+
 // collectAllNodes collects all nodes (both directories and files) from the given DirectoryNode
-func (dfs *DesktopFS) collectAllNodes(node *DirectoryNode) []*DirectoryNode {
-	var nodes []*DirectoryNode
-	nodes = append(nodes, node)
+func (dfs *DesktopFS) collectAllNodes(node *DirectoryNode) []relatedNode {
+	nodes := []relatedNode{{Path: node.Path, Metadata: &node.Metadata}}
+	for _, file := range node.Files {
+		nodes = append(nodes, relatedNode{Path: file.Path, Metadata: &file.Metadata})
+	}
 	for _, child := range node.Children {
 		nodes = append(nodes, dfs.collectAllNodes(child)...)
 	}
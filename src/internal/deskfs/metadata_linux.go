@@ -0,0 +1,108 @@
+//go:build linux
+
+package deskfs
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Names of the users and groups owning files, looked up once per ID
+var (
+	ownerNamesMu sync.Mutex
+	userNames    = map[uint32]string{}
+	groupNames   = map[uint32]string{}
+)
+
+// addPlatformMetadata completes metadata with the owner, group, identity and link count of the node
+// from its stat data, and its creation time from statx. Filesystems that do not record creation times
+// fall back to the inode change time, flagged with CreatedAtIsChangeTime.
+func addPlatformMetadata(nodePath string, fileInfo os.FileInfo, metadata *Metadata) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	metadata.Owner = lookupUserName(stat.Uid)
+	metadata.Group = lookupGroupName(stat.Gid)
+	metadata.Inode = stat.Ino
+	metadata.Device = uint64(stat.Dev)
+	metadata.Links = uint64(stat.Nlink)
+	if fileInfo.Mode().IsRegular() {
+		metadata.DownloadedFrom = downloadOrigin(nodePath)
+	}
+
+	if birthTime, ok := statxBirthTime(nodePath, fileInfo, stat.Ino); ok {
+		metadata.CreatedAt = birthTime
+		return
+	}
+	metadata.CreatedAt = time.Unix(stat.Ctim.Unix())
+	metadata.CreatedAtIsChangeTime = true
+}
+
+// statxBirthTime returns the birth time of the node at nodePath, if its filesystem records it. Symlinks
+// are not followed when fileInfo describes the link itself, and a node replaced since fileInfo was read
+// is ignored.
+func statxBirthTime(nodePath string, fileInfo os.FileInfo, ino uint64) (time.Time, bool) {
+	flags := unix.AT_STATX_DONT_SYNC
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		flags |= unix.AT_SYMLINK_NOFOLLOW
+	}
+
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, nodePath, flags, unix.STATX_BTIME|unix.STATX_INO, &stx); err != nil {
+		return time.Time{}, false
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 || stx.Ino != ino {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
+
+// downloadOrigin returns the page a file was downloaded from, or else the URL it was downloaded from,
+// as recorded by browsers in the freedesktop.org extended attributes.
+func downloadOrigin(nodePath string) string {
+	for _, name := range []string{"user.xdg.referrer.url", "user.xdg.origin.url"} {
+		if value, err := getXattr(nodePath, name); err == nil && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// lookupUserName returns the name of the user with uid, or the uid itself when it has no name.
+func lookupUserName(uid uint32) string {
+	ownerNamesMu.Lock()
+	defer ownerNamesMu.Unlock()
+
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// lookupGroupName returns the name of the group with gid, or the gid itself when it has no name.
+func lookupGroupName(gid uint32) string {
+	ownerNamesMu.Lock()
+	defer ownerNamesMu.Unlock()
+
+	if name, ok := groupNames[gid]; ok {
+		return name
+	}
+	name := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupNames[gid] = name
+	return name
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package deskfs
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestGenerateMetadataLinux(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("a"), 0644))
+	assert.NoError(t, os.Link(path, filepath.Join(dir, "b.txt")))
+
+	current, err := user.Current()
+	assert.NoError(t, err)
+
+	metadata, err := GenerateMetadata(path)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Username, metadata.Owner)
+	assert.NotEqual(t, "unknown", metadata.Group)
+	assert.Equal(t, uint64(2), metadata.Links)
+	assert.NotZero(t, metadata.Inode)
+	assert.False(t, metadata.CreatedAt.IsZero())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	dev, ino, _ := statIdentity(info)
+	assert.Equal(t, ino, metadata.Inode)
+	assert.Equal(t, dev, metadata.Device)
+}
+
+func TestDownloadOrigin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice.pdf")
+	assert.NoError(t, os.WriteFile(path, []byte("pdf"), 0644))
+	if err := unix.Setxattr(path, "user.xdg.origin.url", []byte("https://shop.example/invoice.pdf"), 0); err != nil {
+		t.Skipf("Extended attributes are not supported: %v", err)
+	}
+
+	metadata, err := GenerateMetadata(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://shop.example/invoice.pdf", metadata.DownloadedFrom)
+
+	// The page the file was downloaded from takes precedence over its URL
+	assert.NoError(t, unix.Setxattr(path, "user.xdg.referrer.url", []byte("https://shop.example/orders"), 0))
+	metadata, err = GenerateMetadata(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://shop.example/orders", metadata.DownloadedFrom)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package deskfs
+
+import "os"
+
+// addPlatformMetadata completes metadata with the identity of the node where the platform exposes it.
+// Owner, group and creation time are only resolved on Linux.
+func addPlatformMetadata(nodePath string, fileInfo os.FileInfo, metadata *Metadata) {
+	if dev, ino, ok := statIdentity(fileInfo); ok {
+		metadata.Device, metadata.Inode = dev, ino
+	}
+}
@@ -0,0 +1,66 @@
+package deskfs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func temporalRelations(metadata Metadata) []string {
+	var related []string
+	for _, relationship := range metadata.Relationships {
+		if relationship.Type == TemporalRelationship {
+			related = append(related, relationship.RelatedNode)
+		}
+	}
+	return related
+}
+
+func TestAddRelationships(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	root := NewDirectoryNode("/root", nil)
+	root.Metadata.ModifiedAt = base.Add(-72 * time.Hour)
+	docs := root.AddChildDirectory("/root/docs")
+	docs.Metadata.ModifiedAt = base.Add(-48 * time.Hour)
+
+	// A burst of files modified within minutes, and one file a week later
+	for i := 0; i < 20; i++ {
+		docs.AddFile(&FileNode{
+			Path:     fmt.Sprintf("/root/docs/%02d.txt", i),
+			Metadata: Metadata{ModifiedAt: base.Add(time.Duration(i) * time.Minute)},
+		})
+	}
+	late := &FileNode{Path: "/root/late.txt", Metadata: Metadata{ModifiedAt: base.Add(7 * 24 * time.Hour)}}
+	root.AddFile(late)
+
+	dfs := &DesktopFS{InstanceConfig: &DeskFSConfig{Relationships: RelationshipConfig{TemporalWindow: "1h", MaxTemporalEdges: 4}}}
+	assert.NoError(t, dfs.AddRelationships(root))
+
+	for _, file := range docs.Files {
+		related := temporalRelations(file.Metadata)
+		assert.NotEmpty(t, related, "Expected %s to be related to the burst", file.Path)
+		assert.LessOrEqual(t, len(related), 4, "Expected the edges of %s to be capped", file.Path)
+
+		// Relationships are symmetric
+		for _, path := range related {
+			for _, other := range docs.Files {
+				if other.Path == path {
+					assert.Contains(t, temporalRelations(other.Metadata), file.Path)
+				}
+			}
+		}
+	}
+	assert.Equal(t, []string{"/root/docs/01.txt"}, temporalRelations(docs.Files[0].Metadata)[:1], "Expected the closest node first")
+
+	// Nodes outside the window of every other node are left alone
+	assert.Empty(t, temporalRelations(late.Metadata))
+	assert.Empty(t, temporalRelations(root.Metadata))
+	assert.Empty(t, temporalRelations(docs.Metadata))
+	assert.Contains(t, root.Metadata.Relationships, Relationship{RelatedNode: "/root/docs", Type: "contains"})
+	assert.Contains(t, docs.Metadata.Relationships, Relationship{RelatedNode: "/root", Type: "parent"})
+
+	dfs.InstanceConfig.Relationships.TemporalWindow = "soon"
+	assert.Error(t, dfs.AddRelationships(root))
+}
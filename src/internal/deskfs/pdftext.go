@@ -0,0 +1,366 @@
+package deskfs
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	maxPDFPages      = 10000   // Largest page tree walked
+	maxCMapEntries   = 1 << 16 // Largest number of codes mapped by a ToUnicode map
+	pdfTJSpaceAdjust = -200    // TJ adjustments below this, in thousandths of an em, separate words
+)
+
+var (
+	pdfRootRef   = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfPageType  = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfRefs      = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfNamedRefs = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	cmapBfChar   = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	cmapBfRange  = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	cmapTokens   = regexp.MustCompile(`<[0-9A-Fa-f\s]*>|\[|\]`)
+)
+
+// pdfPage is a page of a PDF: its content streams and its fonts by resource name
+type pdfPage struct {
+	contents []int
+	fonts    map[string]int
+}
+
+// pdfCMap maps the character codes of a font to Unicode text, as read from its ToUnicode map
+type pdfCMap struct {
+	codeBytes int
+	chars     map[uint32]string
+}
+
+type pdfTextReader struct {
+	objects map[int][]byte
+	cmaps   map[int]*pdfCMap
+}
+
+// pdfTextExtractor reads the text layer of PDFs: the strings shown by the content streams of their pages,
+// in page order, mapped to Unicode by the ToUnicode maps of their fonts. Scanned PDFs have no text layer.
+func pdfTextExtractor(content []byte) (string, error) {
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return "", fmt.Errorf("not a PDF")
+	}
+	r := &pdfTextReader{objects: parsePDFObjects(content), cmaps: make(map[int]*pdfCMap)}
+
+	var b strings.Builder
+	pages := r.pages(content)
+	for _, page := range pages {
+		for _, num := range page.contents {
+			if _, data, ok := pdfStreamData(r.objects[num]); ok {
+				r.showText(data, page.fonts, &b)
+			}
+		}
+		b.WriteString("\n\n")
+	}
+
+	// Without a readable page tree, the content streams are read in object order
+	if len(pages) == 0 {
+		nums := make([]int, 0, len(r.objects))
+		for num := range r.objects {
+			nums = append(nums, num)
+		}
+		sort.Ints(nums)
+		for _, num := range nums {
+			if _, data, ok := pdfStreamData(r.objects[num]); ok && bytes.Contains(data, []byte("BT")) {
+				r.showText(data, nil, &b)
+			}
+		}
+	}
+	return normalizeSpace(b.String()), nil
+}
+
+// pages returns the pages of the page tree of the document catalog.
+func (r *pdfTextReader) pages(data []byte) []pdfPage {
+	roots := pdfRootRef.FindAllSubmatch(data, -1)
+	if len(roots) == 0 {
+		return nil
+	}
+	root, _ := strconv.Atoi(string(roots[len(roots)-1][1]))
+	refs := r.refs(pdfDictValue(r.objects[root], "/Pages"))
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var pages []pdfPage
+	r.walkPages(refs[0], nil, make(map[int]bool), &pages)
+	return pages
+}
+
+// walkPages appends the pages below a node of the page tree, which inherit the resources of their parents.
+func (r *pdfTextReader) walkPages(num int, resources []byte, visited map[int]bool, pages *[]pdfPage) {
+	if visited[num] || len(visited) > maxPDFPages {
+		return
+	}
+	visited[num] = true
+	node := r.objects[num]
+	if own := pdfDictValue(node, "/Resources"); own != nil {
+		resources = pdfDict(pdfResolve(own, r.objects))
+	}
+
+	if pdfPageType.Match(node) {
+		*pages = append(*pages, pdfPage{contents: r.refs(pdfDictValue(node, "/Contents")), fonts: r.fonts(resources)})
+		return
+	}
+	for _, kid := range r.refs(pdfDictValue(node, "/Kids")) {
+		r.walkPages(kid, resources, visited, pages)
+	}
+}
+
+// refs returns the objects referenced by a value, a reference or an array of references.
+func (r *pdfTextReader) refs(value []byte) []int {
+	if bytes.HasPrefix(value, []byte("[")) {
+		if end := bytes.IndexByte(value, ']'); end >= 0 {
+			value = value[:end]
+		}
+	} else if ref := pdfRef.Find(value); ref != nil {
+		value = ref
+	} else {
+		return nil
+	}
+
+	var nums []int
+	for _, ref := range pdfRefs.FindAllSubmatch(value, -1) {
+		num, _ := strconv.Atoi(string(ref[1]))
+		nums = append(nums, num)
+	}
+	return nums
+}
+
+// fonts returns the font objects of resources by name.
+func (r *pdfTextReader) fonts(resources []byte) map[string]int {
+	fontDict := pdfDict(pdfResolve(pdfDictValue(resources, "/Font"), r.objects))
+	fonts := make(map[string]int)
+	for _, font := range pdfNamedRefs.FindAllSubmatch(fontDict, -1) {
+		num, _ := strconv.Atoi(string(font[2]))
+		fonts[string(font[1])] = num
+	}
+	return fonts
+}
+
+// pdfDict returns the dictionary at the start of value, up to its matching end.
+func pdfDict(value []byte) []byte {
+	if !bytes.HasPrefix(value, []byte("<<")) {
+		return nil
+	}
+	depth := 0
+	for i := 0; i+1 < len(value); i++ {
+		switch {
+		case value[i] == '<' && value[i+1] == '<':
+			depth++
+			i++
+		case value[i] == '>' && value[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return value[:i+1]
+			}
+		}
+	}
+	return value
+}
+
+// cmap returns the ToUnicode map of a font, nil when it has none.
+func (r *pdfTextReader) cmap(font int) *pdfCMap {
+	if cmap, ok := r.cmaps[font]; ok {
+		return cmap
+	}
+	var cmap *pdfCMap
+	if refs := r.refs(pdfDictValue(r.objects[font], "/ToUnicode")); len(refs) > 0 {
+		if _, data, ok := pdfStreamData(r.objects[refs[0]]); ok {
+			cmap = parseToUnicode(data)
+		}
+	}
+	r.cmaps[font] = cmap
+	return cmap
+}
+
+// parseToUnicode parses the bfchar and bfrange mappings of a ToUnicode map.
+func parseToUnicode(data []byte) *pdfCMap {
+	cmap := &pdfCMap{codeBytes: 1, chars: make(map[uint32]string)}
+	hexValue := func(token []byte) uint32 {
+		raw, _, _ := parsePDFString(token)
+		var code uint32
+		for _, b := range raw {
+			code = code<<8 | uint32(b)
+		}
+		if len(raw) > cmap.codeBytes {
+			cmap.codeBytes = min(len(raw), 4)
+		}
+		return code
+	}
+	utf16Text := func(raw []byte) string {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 0; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	for _, section := range cmapBfChar.FindAllSubmatch(data, -1) {
+		tokens := cmapTokens.FindAll(section[1], -1)
+		for i := 0; i+1 < len(tokens); i += 2 {
+			code := hexValue(tokens[i])
+			dst, _, _ := parsePDFString(tokens[i+1])
+			cmap.chars[code] = utf16Text(dst)
+		}
+	}
+
+	for _, section := range cmapBfRange.FindAllSubmatch(data, -1) {
+		tokens := cmapTokens.FindAll(section[1], -1)
+		for i := 0; i+2 < len(tokens) && len(cmap.chars) < maxCMapEntries; {
+			lo, hi := hexValue(tokens[i]), hexValue(tokens[i+1])
+			i += 2
+			if hi < lo || hi-lo > maxCMapEntries {
+				hi = lo
+			}
+
+			// Either a destination per code, or the destination of the first code, incremented
+			if string(tokens[i]) == "[" {
+				i++
+				for code := lo; i < len(tokens) && string(tokens[i]) != "]"; i, code = i+1, code+1 {
+					dst, _, _ := parsePDFString(tokens[i])
+					cmap.chars[code] = utf16Text(dst)
+				}
+				i++
+				continue
+			}
+			dst, _, _ := parsePDFString(tokens[i])
+			i++
+			for offset := uint32(0); offset <= hi-lo && len(dst) >= 2; offset++ {
+				next := append([]byte(nil), dst...)
+				last := uint16(next[len(next)-2])<<8 | uint16(next[len(next)-1]) + uint16(offset)
+				next[len(next)-2], next[len(next)-1] = byte(last>>8), byte(last)
+				cmap.chars[lo+offset] = utf16Text(next)
+			}
+		}
+	}
+	return cmap
+}
+
+// decodeShown decodes a string shown with a font, by its ToUnicode map when it has one.
+func decodeShown(raw []byte, cmap *pdfCMap) string {
+	if cmap == nil {
+		if bytes.HasPrefix(raw, []byte{0xFE, 0xFF}) {
+			return decodePDFText(raw)
+		}
+		return decodeWindows1252(raw)
+	}
+
+	var b strings.Builder
+	for i := 0; i+cmap.codeBytes <= len(raw); i += cmap.codeBytes {
+		var code uint32
+		for _, c := range raw[i : i+cmap.codeBytes] {
+			code = code<<8 | uint32(c)
+		}
+		b.WriteString(cmap.chars[code])
+	}
+	return b.String()
+}
+
+// showText writes the text shown by the text operators of a content stream.
+func (r *pdfTextReader) showText(data []byte, fonts map[string]int, b *strings.Builder) {
+	var cmap *pdfCMap
+	var shown []string
+	var numbers []float64
+	var name string
+	inArray := false
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0:
+			i++
+
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			i += len(pdfDict(data[i:]))
+
+		case c == '(' || c == '<':
+			raw, n, ok := parsePDFString(data[i:])
+			if !ok {
+				return
+			}
+			shown = append(shown, decodeShown(raw, cmap))
+			i += n
+
+		case c == '[' || c == ']':
+			inArray = c == '['
+			i++
+
+		case c == '/':
+			end := i + 1
+			for end < len(data) && !isPDFDelimiter(data[end]) {
+				end++
+			}
+			name = string(data[i+1 : end])
+			i = end
+
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(data) && (data[end] == '.' || (data[end] >= '0' && data[end] <= '9')) {
+				end++
+			}
+			number, _ := strconv.ParseFloat(string(data[i:end]), 64)
+			// Large negative adjustments between the strings of TJ arrays are spaces between words
+			if inArray && number < pdfTJSpaceAdjust {
+				shown = append(shown, " ")
+			}
+			numbers = append(numbers, number)
+			i = end
+
+		default:
+			end := i + 1
+			for end < len(data) && !isPDFDelimiter(data[end]) {
+				end++
+			}
+			operator := string(data[i:end])
+			i = end
+
+			switch operator {
+			case "Tj", "TJ":
+				b.WriteString(strings.Join(shown, ""))
+			case "'", "\"":
+				b.WriteByte('\n')
+				b.WriteString(strings.Join(shown, ""))
+			case "Td", "TD":
+				// Moving down starts a new line, moving along the line separates words
+				if len(numbers) >= 2 && numbers[len(numbers)-1] != 0 {
+					b.WriteByte('\n')
+				} else {
+					b.WriteByte(' ')
+				}
+			case "T*", "ET":
+				b.WriteByte('\n')
+			case "Tf":
+				cmap = nil
+				if font, ok := fonts[name]; ok {
+					cmap = r.cmap(font)
+				}
+			case "BI":
+				// Skip the data of inline images, up to the EI operator
+				if end := bytes.Index(data[i:], []byte("EI")); end >= 0 {
+					i += end + 2
+				} else {
+					i = len(data)
+				}
+			}
+			shown, numbers = shown[:0], numbers[:0]
+		}
+		if b.Len() > maxExtractedText {
+			return
+		}
+	}
+}
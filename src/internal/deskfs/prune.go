@@ -0,0 +1,94 @@
+package deskfs
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ignore "github.com/sabhiram/go-gitignore"
+)
+
+// pruneEmptyDirs removes the directories of the scanned tree that the current run has emptied.
+// Directories that were already empty before the run, ignored directories, the source root and
+// the ancestors of the target directory are always kept.
+func (dfs *DesktopFS) pruneEmptyDirs(params *FilePathParams) error {
+	if dfs.DirectoryTree == nil {
+		return nil
+	}
+
+	ignored, err := dfs.GetDesktopCleanerIgnore(params.SourceDir)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range dfs.DirectoryTree.Root.Children {
+		if err := dfs.pruneNode(child, params, ignored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneNode prunes the children of node before node itself, so emptied parents are removed too.
+func (dfs *DesktopFS) pruneNode(node *DirectoryNode, params *FilePathParams, ignored *ignore.GitIgnore) error {
+	for _, child := range node.Children {
+		if err := dfs.pruneNode(child, params, ignored); err != nil {
+			return err
+		}
+	}
+
+	// A node without scanned content was empty (or not scanned) before the run
+	if len(node.Files) == 0 && len(node.Children) == 0 {
+		return nil
+	}
+
+	if isSameOrAncestor(node.Path, params.TargetDir) {
+		return nil
+	}
+
+	if ignored != nil {
+		if rel, err := filepath.Rel(params.SourceDir, node.Path); err == nil {
+			rel = filepath.ToSlash(rel)
+			if ignored.MatchesPath(rel) || ignored.MatchesPath(rel+"/") {
+				slog.Debug(fmt.Sprintf("Not pruning ignored directory %s\n", node.Path))
+				return nil
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(node.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+
+	info, err := os.Lstat(node.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(node.Path); err != nil {
+		return fmt.Errorf("failed to remove empty directory %s: %w", node.Path, err)
+	}
+
+	dfs.journal.Record(JournalRmdir, node.Path, "", info.Mode())
+	slog.Info(fmt.Sprintf("Removed empty directory %s\n", node.Path))
+	return nil
+}
+
+// isSameOrAncestor reports whether dir is path itself or one of its parent directories.
+func isSameOrAncestor(dir, path string) bool {
+	if path == "" {
+		return false
+	}
+	dir = filepath.Clean(dir)
+	path = filepath.Clean(path)
+	return dir == path || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
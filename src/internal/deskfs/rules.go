@@ -0,0 +1,455 @@
+package deskfs
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type RuleAction string
+
+const (
+	RuleMove    RuleAction = "move"
+	RuleArchive RuleAction = "archive"
+)
+
+// Rule routes the files matching all of its predicates. Rules are evaluated in order before the
+// extension mapping of file_types, and the first matching rule wins.
+type Rule struct {
+	Name        string     `toml:"name"`
+	Action      RuleAction `toml:"action"`       // "move" (default) or "archive"
+	Target      string     `toml:"target"`       // Destination folder, relative to the target directory; a template for move rules, see TargetData
+	Destination string     `toml:"destination"`  // Destination of the file without its extension instead of target, a template naming the file, e.g. "Music/{{.Audio.Artist}}/{{.Audio.Track}} - {{.Audio.Title}}"
+	Extensions  []string   `toml:"extensions"`   // Matches any of these extensions
+	OlderThan   string     `toml:"older_than"`   // Matches files last modified before this age, e.g. "90d"
+	LargerThan  string     `toml:"larger_than"`  // Matches files larger than this size, e.g. "100MB"
+	Tags        []string   `toml:"tags"`         // Matches files carrying all of these tags
+	Camera      string     `toml:"camera"`       // Matches photos taken with a camera matching this glob, case-insensitively
+	HasGPS      *bool      `toml:"has_gps"`      // Matches photos with, or without, the position they were taken at
+	TakenAfter  string     `toml:"taken_after"`  // Matches photos taken on or after this date, e.g. "2024-01-01"
+	TakenBefore string     `toml:"taken_before"` // Matches photos taken before this date
+	Title       string     `toml:"title"`        // Matches PDFs and Office documents with an embedded title matching this glob, case-insensitively
+	Author      string     `toml:"author"`       // Matches PDFs and Office documents with an embedded author matching this glob, case-insensitively
+	Format      string     `toml:"format"`       // Archive format for archive rules: "tar.gz" (default) or "zip"
+	Originals   string     `toml:"originals"`    // What archive rules do with archived files: "trash" (default), "remove" or "keep"
+
+	olderThan   time.Duration
+	largerThan  int64
+	takenAfter  time.Time
+	takenBefore time.Time
+	target      *template.Template
+	destination *template.Template
+}
+
+// compileRules validates the configured rules and parses their predicates, dropping invalid rules.
+func compileRules(rules []Rule) []*Rule {
+	var compiled []*Rule
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.compile(); err != nil {
+			slog.Error(fmt.Sprintf("Ignoring rule %q: %v", rule.Name, err))
+			continue
+		}
+		compiled = append(compiled, &rule)
+	}
+	return compiled
+}
+
+func (rule *Rule) compile() error {
+	if rule.Action == "" {
+		rule.Action = RuleMove
+	}
+	if rule.Action != RuleMove && rule.Action != RuleArchive {
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if rule.Destination != "" {
+		if rule.Target != "" {
+			return fmt.Errorf("target and destination cannot be combined")
+		}
+		if rule.Action == RuleArchive {
+			return fmt.Errorf("archive rules cannot have a destination")
+		}
+	} else if rule.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+
+	rule.Extensions = normalizeExtensions(rule.Extensions)
+
+	if rule.OlderThan != "" {
+		age, err := ParseAge(rule.OlderThan)
+		if err != nil {
+			return err
+		}
+		rule.olderThan = age
+	}
+
+	if rule.LargerThan != "" {
+		size, err := ParseSize(rule.LargerThan)
+		if err != nil {
+			return err
+		}
+		rule.largerThan = size
+	}
+
+	for _, pattern := range []struct {
+		name  string
+		value *string
+	}{{"camera", &rule.Camera}, {"title", &rule.Title}, {"author", &rule.Author}} {
+		if *pattern.value == "" {
+			continue
+		}
+		*pattern.value = strings.ToLower(*pattern.value)
+		if _, err := filepath.Match(*pattern.value, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", pattern.name, *pattern.value, err)
+		}
+	}
+	for _, date := range []struct {
+		value string
+		dest  *time.Time
+	}{{rule.TakenAfter, &rule.takenAfter}, {rule.TakenBefore, &rule.takenBefore}} {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := time.ParseInLocation(time.DateOnly, date.value, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date.value)
+		}
+		*date.dest = parsed
+	}
+
+	if strings.Contains(rule.Target, "{{") {
+		if rule.Action == RuleArchive {
+			return fmt.Errorf("archive rules cannot have a target template")
+		}
+		target, err := parseTargetTemplate(rule.Name, rule.Target)
+		if err != nil {
+			return fmt.Errorf("invalid target template: %w", err)
+		}
+		rule.target = target
+	}
+	if rule.Destination != "" {
+		destination, err := parseTargetTemplate(rule.Name, rule.Destination)
+		if err != nil {
+			return fmt.Errorf("invalid destination template: %w", err)
+		}
+		rule.destination = destination
+	}
+
+	if rule.Action == RuleArchive {
+		if _, err := relativeTarget(rule.Target); err != nil {
+			return err
+		}
+		if rule.Format == "" {
+			rule.Format = string(ArchiveTarGz)
+		}
+		if _, err := ParseArchiveFormat(rule.Format); err != nil {
+			return err
+		}
+		if rule.Originals == "" {
+			rule.Originals = string(OriginalsTrash)
+		}
+		if _, err := ParseOriginalsMode(rule.Originals); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the file satisfies every predicate of the rule.
+func (rule *Rule) Matches(fileNode *FileNode, now time.Time) bool {
+	if len(rule.Extensions) > 0 {
+		found := false
+		for _, ext := range rule.Extensions {
+			if ext == fileNode.Extension {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if rule.olderThan > 0 && !fileNode.ModifiedAt.Before(now.Add(-rule.olderThan)) {
+		return false
+	}
+
+	if rule.largerThan > 0 && fileNode.Size <= rule.largerThan {
+		return false
+	}
+
+	for _, tag := range rule.Tags {
+		if !containsString(fileNode.Metadata.Tags, tag) {
+			return false
+		}
+	}
+
+	if rule.needsExif() {
+		exif := fileNode.Metadata.Exif
+		if exif == nil {
+			return false
+		}
+		if rule.Camera != "" && !matchFold(rule.Camera, exif.Camera()) {
+			return false
+		}
+		if rule.HasGPS != nil && exif.HasGPS != *rule.HasGPS {
+			return false
+		}
+		if !rule.takenAfter.IsZero() && (exif.TakenAt.IsZero() || exif.TakenAt.Before(rule.takenAfter)) {
+			return false
+		}
+		if !rule.takenBefore.IsZero() && (exif.TakenAt.IsZero() || !exif.TakenAt.Before(rule.takenBefore)) {
+			return false
+		}
+	}
+
+	if rule.needsDocument() {
+		document := fileNode.Metadata.Document
+		if document == nil {
+			return false
+		}
+		if rule.Title != "" && (document.Title == "" || !matchFold(rule.Title, document.Title)) {
+			return false
+		}
+		if rule.Author != "" && (document.Author == "" || !matchFold(rule.Author, document.Author)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchFold reports whether text matches a lowercase glob, case-insensitively. Slashes are ordinary
+// characters of titles and names, matched by '*' and '?'.
+func matchFold(pattern, text string) bool {
+	pattern = strings.ReplaceAll(pattern, "/", "\x00")
+	text = strings.ReplaceAll(strings.ToLower(text), "/", "\x00")
+	matched, _ := filepath.Match(pattern, text)
+	return matched
+}
+
+// needsExif reports whether the rule has predicates on the EXIF metadata of photos
+func (rule *Rule) needsExif() bool {
+	return rule.Camera != "" || rule.HasGPS != nil || rule.TakenAfter != "" || rule.TakenBefore != ""
+}
+
+// needsDocument reports whether the rule has predicates on the embedded metadata of documents
+func (rule *Rule) needsDocument() bool {
+	return rule.Title != "" || rule.Author != ""
+}
+
+// matchRule returns the first rule matching the file, if any.
+func (dfc *DeskFSConfig) matchRule(fileNode *FileNode) *Rule {
+	now := time.Now()
+	for _, rule := range dfc.Rules {
+		if rule.needsExif() || rule.needsDocument() {
+			ensureContentMetadata(fileNode)
+		}
+		// Files of a full scan are only tagged when a rule needs their tags
+		if len(rule.Tags) > 0 && !fileNode.Metadata.tagsGenerated {
+			ensureMetadata(fileNode)
+			if fileNode.Metadata.MimeType == "" {
+				fileNode.Metadata.MimeType = detectMimeType(fileNode.Path)
+			}
+			AddTagsToMetadata(fileNode.Path, &fileNode.Metadata, dfc.TagRules)
+		}
+		if rule.Matches(fileNode, now) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// parseTargetTemplate parses the target or destination template of a rule.
+func parseTargetTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Catch unknown fields before any file is moved
+	if err := tmpl.Execute(io.Discard, TargetData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// templateContentFields matches the fields of TargetData read from the content of files, whose metadata
+// templates only read when they use them
+var templateContentFields = regexp.MustCompile(`\.(Exif|Audio|Document)\b`)
+
+// TargetData is the data available to target templates, e.g. "Pics/{{.Exif.Year}}/{{.Exif.Camera}}".
+// Values are safe to use as folder names.
+type TargetData struct {
+	Name     string // File name without its extension
+	Ext      string // Extension without the dot, lowercase
+	Year     string // Date of the last modification
+	Month    string
+	Day      string
+	Exif     ExifTargetData
+	Audio    AudioTargetData
+	Document DocumentTargetData
+}
+
+// ExifTargetData is the EXIF metadata of a photo available to target templates.
+type ExifTargetData struct {
+	Year        string // Capture date, or the date of the last modification when the photo has none
+	Month       string
+	Day         string
+	Camera      string // Make and model of the camera, "Unknown Camera" when not recorded
+	Make        string
+	Model       string
+	HasGPS      bool
+	Orientation int
+}
+
+// AudioTargetData is the tags of an audio file available to target templates.
+type AudioTargetData struct {
+	Artist      string // Artist of the track, else of the album, "Unknown Artist" when not tagged
+	AlbumArtist string // Artist of the album, else of the track, keeping compilations together
+	Album       string // "Unknown Album" when not tagged
+	Title       string // Title of the track, else the file name without its extension
+	Track       string // Track number on two digits, "00" when not tagged
+	Year        string // Release year, "Unknown Year" when not tagged
+}
+
+// DocumentTargetData is the embedded metadata of a PDF or Office document available to target templates.
+type DocumentTargetData struct {
+	Title  string // Embedded title, else the file name without its extension
+	Author string // "Unknown Author" when not recorded
+	Year   string // Creation date, else the date of the last modification
+	Month  string
+	Day    string
+	Pages  int
+}
+
+// newTargetData returns the template data of a file.
+func newTargetData(fileNode *FileNode) TargetData {
+	modifiedAt := fileNode.ModifiedAt
+	if modifiedAt.IsZero() {
+		modifiedAt = fileNode.Metadata.ModifiedAt
+	}
+	data := TargetData{
+		Name:  safeFolderName(strings.TrimSuffix(fileNode.Name, filepath.Ext(fileNode.Name)), "Unnamed"),
+		Ext:   strings.TrimPrefix(fileNode.Extension, "."),
+		Year:  modifiedAt.Format("2006"),
+		Month: modifiedAt.Format("01"),
+		Day:   modifiedAt.Format("02"),
+	}
+
+	takenAt := modifiedAt
+	data.Exif.Camera = "Unknown Camera"
+	if exif := fileNode.Metadata.Exif; exif != nil {
+		if !exif.TakenAt.IsZero() {
+			takenAt = exif.TakenAt
+		}
+		data.Exif.Camera = safeFolderName(exif.Camera(), "Unknown Camera")
+		data.Exif.Make = safeFolderName(exif.Make, "")
+		data.Exif.Model = safeFolderName(exif.Model, "")
+		data.Exif.HasGPS = exif.HasGPS
+		data.Exif.Orientation = exif.Orientation
+	}
+	data.Exif.Year, data.Exif.Month, data.Exif.Day = takenAt.Format("2006"), takenAt.Format("01"), takenAt.Format("02")
+
+	audio := fileNode.Metadata.Audio
+	if audio == nil {
+		audio = &AudioData{}
+	}
+	data.Audio = AudioTargetData{
+		Artist:      safeFolderName(audio.Artist, safeFolderName(audio.AlbumArtist, "Unknown Artist")),
+		AlbumArtist: safeFolderName(audio.AlbumArtist, safeFolderName(audio.Artist, "Unknown Artist")),
+		Album:       safeFolderName(audio.Album, "Unknown Album"),
+		Title:       safeFolderName(audio.Title, data.Name),
+		Track:       fmt.Sprintf("%02d", audio.Track),
+		Year:        "Unknown Year",
+	}
+	if audio.Year > 0 {
+		data.Audio.Year = strconv.Itoa(audio.Year)
+	}
+
+	createdAt := modifiedAt
+	data.Document.Title, data.Document.Author = data.Name, "Unknown Author"
+	if document := fileNode.Metadata.Document; document != nil {
+		if !document.CreatedAt.IsZero() {
+			createdAt = document.CreatedAt
+		} else if !document.ModifiedAt.IsZero() {
+			createdAt = document.ModifiedAt
+		}
+		data.Document.Title = safeFolderName(document.Title, data.Name)
+		data.Document.Author = safeFolderName(document.Author, "Unknown Author")
+		data.Document.Pages = document.Pages
+	}
+	data.Document.Year, data.Document.Month, data.Document.Day = createdAt.Format("2006"), createdAt.Format("01"), createdAt.Format("02")
+	return data
+}
+
+// safeFolderName replaces the characters that cannot appear in a folder name, or returns fallback for empty names.
+func safeFolderName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		if r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// TargetFor returns the destination folder of a file matched by the rule, rendering its target template.
+func (rule *Rule) TargetFor(fileNode *FileNode) (string, error) {
+	if rule.target == nil {
+		return rule.Target, nil
+	}
+	return renderTarget(rule.target, fileNode)
+}
+
+// DestinationFor returns the destination folder of a file matched by the rule and, for rules with a
+// destination template, its new name with its original extension. The name is empty when the file keeps it.
+func (rule *Rule) DestinationFor(fileNode *FileNode) (string, string, error) {
+	if rule.destination == nil {
+		target, err := rule.TargetFor(fileNode)
+		return target, "", err
+	}
+
+	destination, err := renderTarget(rule.destination, fileNode)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Dir(destination), filepath.Base(destination) + filepath.Ext(fileNode.Name), nil
+}
+
+// renderTarget renders a target or destination template for a file, rejecting paths that leave the target directory.
+func renderTarget(tmpl *template.Template, fileNode *FileNode) (string, error) {
+	if templateContentFields.MatchString(tmpl.Root.String()) {
+		ensureContentMetadata(fileNode)
+	} else {
+		ensureMetadata(fileNode)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, newTargetData(fileNode)); err != nil {
+		return "", fmt.Errorf("failed to render target: %w", err)
+	}
+	return relativeTarget(b.String())
+}
+
+// relativeTarget cleans a target folder relative to the target directory, rejecting targets outside of it.
+func relativeTarget(target string) (string, error) {
+	cleaned := filepath.Clean(target)
+	if filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("target %q is outside of the target directory", target)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package deskfs
+
+import "os"
+
+// statIdentity is not available on this platform.
+func statIdentity(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
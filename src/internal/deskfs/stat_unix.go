@@ -0,0 +1,17 @@
+//go:build unix
+
+package deskfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// statIdentity returns the device and inode numbers backing a FileInfo.
+func statIdentity(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
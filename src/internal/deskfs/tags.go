@@ -1,45 +1,322 @@
 package deskfs
 
-import "strings"
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
 
-// GenerateTags generates tags based on the metadata of a file or directory
-func GenerateTags(metadata Metadata) []string {
+// Tagger returns tags for the node at path from its metadata
+type Tagger func(path string, metadata *Metadata) []string
+
+type namedTagger struct {
+	name   string
+	tagger Tagger
+}
+
+// Taggers run in order, the built-in ones first
+var (
+	taggersMu sync.RWMutex
+	taggers   = []namedTagger{
+		{"node", nodeTagger},
+		{"permissions", permissionsTagger},
+		{"extension", extensionTagger},
+		{"mime", mimeTagger},
+		{"age", ageTagger},
+		{"size", sizeTagger},
+		{"path", pathTagger},
+	}
+)
+
+// RegisterTagger adds a tagger run after the registered ones, or replaces the tagger registered with the same name.
+func RegisterTagger(name string, tagger Tagger) {
+	taggersMu.Lock()
+	defer taggersMu.Unlock()
+
+	for i := range taggers {
+		if taggers[i].name == name {
+			taggers[i].tagger = tagger
+			return
+		}
+	}
+	taggers = append(taggers, namedTagger{name: name, tagger: tagger})
+}
+
+// GenerateTags generates tags based on the metadata of a file or directory, from the registered taggers
+// and the tag rules of the config
+func GenerateTags(path string, metadata Metadata, rules []*TagRule) []string {
 	tags := []string{}
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	taggersMu.RLock()
+	for _, registered := range taggers {
+		for _, tag := range registered.tagger(path, &metadata) {
+			add(tag)
+		}
+	}
+	taggersMu.RUnlock()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.Matches(path, &metadata, now) {
+			add(rule.Tag)
+		}
+	}
+	return tags
+}
+
+// AddTagsToMetadata adds tags to a Metadata struct
+func AddTagsToMetadata(path string, metadata *Metadata, rules []*TagRule) {
+	metadata.Tags = GenerateTags(path, *metadata, rules)
+	metadata.tagsGenerated = true
+}
 
-	// Tag based on NodeType
-	if metadata.NodeType == "directory" {
-		tags = append(tags, "folder")
-	} else if metadata.NodeType == "file" {
-		tags = append(tags, "file")
+// tagRules returns the tag rules of the loaded config
+func (dfs *DesktopFS) tagRules() []*TagRule {
+	if dfs.InstanceConfig == nil {
+		return nil
 	}
+	return dfs.InstanceConfig.TagRules
+}
 
-	// Tag based on file size
-	if metadata.Size > 1e6 {
-		tags = append(tags, "large")
-	} else if metadata.Size > 1e3 {
-		tags = append(tags, "medium")
-	} else {
-		tags = append(tags, "small")
+// nodeTagger tags files and folders
+func nodeTagger(path string, metadata *Metadata) []string {
+	switch metadata.NodeType {
+	case "directory":
+		return []string{"folder"}
+	case "file":
+		return []string{"file"}
 	}
+	return nil
+}
 
-	// Tag based on permissions
+// permissionsTagger tags the nodes the owner can read or write
+func permissionsTagger(path string, metadata *Metadata) []string {
+	var tags []string
 	if metadata.Permissions&0200 != 0 {
 		tags = append(tags, "writable")
 	}
 	if metadata.Permissions&0400 != 0 {
 		tags = append(tags, "readable")
 	}
+	return tags
+}
+
+// extensionFamilies maps extensions to the family of files they belong to
+var extensionFamilies = map[string][]string{
+	"text":         {".txt", ".md", ".rst", ".log", ".nfo"},
+	"document":     {".pdf", ".doc", ".docx", ".odt", ".rtf", ".pages"},
+	"spreadsheet":  {".xls", ".xlsx", ".ods", ".csv", ".tsv", ".numbers"},
+	"presentation": {".ppt", ".pptx", ".odp", ".key"},
+	"ebook":        {".epub", ".mobi", ".azw3"},
+	"image":        {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".svg", ".webp", ".tif", ".tiff", ".heic", ".raw", ".cr2", ".nef", ".arw", ".dng"},
+	"video":        {".mp4", ".mkv", ".avi", ".mov", ".webm", ".m4v", ".wmv"},
+	"audio":        {".mp3", ".wav", ".ogg", ".flac", ".m4a", ".aac", ".opus"},
+	"subtitle":     {".srt", ".vtt", ".ass", ".ssa", ".sub"},
+	"archive":      {".zip", ".rar", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".7z"},
+	"installer":    {".deb", ".rpm", ".msi", ".dmg", ".pkg", ".appimage", ".flatpakref"},
+	"executable":   {".exe", ".bat", ".sh", ".bin", ".run"},
+	"code":         {".c", ".h", ".py", ".rs", ".go", ".js", ".ts", ".jsx", ".tsx", ".html", ".css", ".php", ".java", ".cpp", ".cs", ".swift", ".kt", ".rb", ".sql"},
+	"config":       {".json", ".xml", ".yml", ".yaml", ".ini", ".toml", ".cfg", ".conf"},
+	"font":         {".ttf", ".otf", ".woff", ".woff2"},
+	"partial":      {".part", ".crdownload", ".download", ".tmp"},
+}
+
+var familyByExtension = func() map[string]string {
+	families := make(map[string]string)
+	for family, extensions := range extensionFamilies {
+		for _, ext := range extensions {
+			families[ext] = family
+		}
+	}
+	return families
+}()
+
+// extensionTagger tags files with the family of their extension, e.g. "image" or "text"
+func extensionTagger(path string, metadata *Metadata) []string {
+	if metadata.NodeType != "file" {
+		return nil
+	}
+	if family, ok := familyByExtension[strings.ToLower(filepath.Ext(path))]; ok {
+		return []string{family}
+	}
+	return nil
+}
+
+// mimeTagger tags files with their MIME type, without parameters, e.g. "mime:application/pdf"
+func mimeTagger(path string, metadata *Metadata) []string {
+	if metadata.MimeType == "" {
+		return nil
+	}
+	mimeType, _, _ := strings.Cut(metadata.MimeType, ";")
+	return []string{"mime:" + strings.TrimSpace(mimeType)}
+}
+
+// Age buckets of the last modification, from the newest
+var ageBuckets = []struct {
+	tag    string
+	maxAge time.Duration
+}{
+	{"new", 7 * 24 * time.Hour},
+	{"recent", 90 * 24 * time.Hour},
+	{"old", 365 * 24 * time.Hour},
+}
 
-	if metadata.NodeType == "file" && strings.HasSuffix(metadata.Permissions.String(), ".txt") {
-		tags = append(tags, "text-file")
+// ageTagger tags files by the age of their last modification: "new" within a week, "recent" within
+// 90 days, "old" within a year and "stale" beyond
+func ageTagger(path string, metadata *Metadata) []string {
+	if metadata.NodeType != "file" || metadata.ModifiedAt.IsZero() {
+		return nil
 	}
+	age := time.Since(metadata.ModifiedAt)
+	for _, bucket := range ageBuckets {
+		if age < bucket.maxAge {
+			return []string{bucket.tag}
+		}
+	}
+	return []string{"stale"}
+}
 
-	// TODO: Add custom logic to generate other tags, e.g., by extension or modification time, user generated, llm generated, etc.
+// sizeTagger tags nodes by size: "small" up to 1KB, "medium" up to 1MB, "large" up to 1GB and "huge" beyond
+func sizeTagger(path string, metadata *Metadata) []string {
+	switch {
+	case metadata.Size > 1e9:
+		return []string{"huge"}
+	case metadata.Size > 1e6:
+		return []string{"large"}
+	case metadata.Size > 1e3:
+		return []string{"medium"}
+	}
+	return []string{"small"}
+}
 
+// pathTagger tags hidden nodes and the temporary files left by editors and office suites
+func pathTagger(path string, metadata *Metadata) []string {
+	name := filepath.Base(path)
+	var tags []string
+	if strings.HasPrefix(name, ".") {
+		tags = append(tags, "hidden")
+	}
+	if strings.HasPrefix(name, "~$") || strings.HasPrefix(name, ".~lock.") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp") {
+		tags = append(tags, "temporary")
+	}
 	return tags
 }
 
-// AddTagsToMetadata adds tags to a Metadata struct
-func AddTagsToMetadata(metadata *Metadata) {
-	metadata.Tags = GenerateTags(*metadata)
+// TagRule adds its tag to the files and directories matching all of its predicates.
+type TagRule struct {
+	Tag        string   `toml:"tag"`
+	Pattern    string   `toml:"pattern"`     // Glob matched against the name, or against the path when it contains a separator
+	Extensions []string `toml:"extensions"`  // Matches any of these extensions
+	MimeType   string   `toml:"mime_type"`   // Matches MIME types starting with this, e.g. "image/"; needs indexed files
+	OlderThan  string   `toml:"older_than"`  // Matches nodes last modified before this age, e.g. "90d"
+	LargerThan string   `toml:"larger_than"` // Matches nodes larger than this size, e.g. "100MB"
+
+	olderThan  time.Duration
+	largerThan int64
+}
+
+// compileTagRules validates the configured tag rules and parses their predicates, dropping invalid rules.
+func compileTagRules(rules []TagRule) []*TagRule {
+	var compiled []*TagRule
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.compile(); err != nil {
+			slog.Error(fmt.Sprintf("Ignoring tag rule %q: %v", rule.Tag, err))
+			continue
+		}
+		compiled = append(compiled, &rule)
+	}
+	return compiled
+}
+
+func (rule *TagRule) compile() error {
+	if rule.Tag == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if rule.Pattern == "" && len(rule.Extensions) == 0 && rule.MimeType == "" && rule.OlderThan == "" && rule.LargerThan == "" {
+		return fmt.Errorf("at least one predicate is required")
+	}
+	if rule.Pattern != "" {
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+		}
+	}
+	rule.Extensions = normalizeExtensions(rule.Extensions)
+
+	if rule.OlderThan != "" {
+		age, err := ParseAge(rule.OlderThan)
+		if err != nil {
+			return err
+		}
+		rule.olderThan = age
+	}
+	if rule.LargerThan != "" {
+		size, err := ParseSize(rule.LargerThan)
+		if err != nil {
+			return err
+		}
+		rule.largerThan = size
+	}
+	return nil
+}
+
+// Matches reports whether the node at path satisfies every predicate of the tag rule.
+func (rule *TagRule) Matches(path string, metadata *Metadata, now time.Time) bool {
+	if rule.Pattern != "" {
+		subject := filepath.Base(path)
+		if strings.ContainsRune(rule.Pattern, filepath.Separator) {
+			subject = path
+		}
+		if matched, _ := filepath.Match(rule.Pattern, subject); !matched {
+			return false
+		}
+	}
+
+	if len(rule.Extensions) > 0 && !containsString(rule.Extensions, strings.ToLower(filepath.Ext(path))) {
+		return false
+	}
+
+	if rule.MimeType != "" && !strings.HasPrefix(metadata.MimeType, rule.MimeType) {
+		return false
+	}
+
+	if rule.olderThan > 0 && !metadata.ModifiedAt.Before(now.Add(-rule.olderThan)) {
+		return false
+	}
+
+	if rule.largerThan > 0 && metadata.Size <= rule.largerThan {
+		return false
+	}
+	return true
+}
+
+// normalizeExtensions lowercases extensions and prefixes them with a dot
+func normalizeExtensions(extensions []string) []string {
+	for i, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[i] = ext
+	}
+	return extensions
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
 }
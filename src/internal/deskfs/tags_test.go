@@ -0,0 +1,109 @@
+package deskfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateTags(t *testing.T) {
+	metadata := Metadata{
+		NodeType:    "file",
+		Size:        2048,
+		Permissions: 0644,
+		ModifiedAt:  time.Now().Add(-200 * 24 * time.Hour),
+		MimeType:    "text/plain; charset=utf-8",
+	}
+	tags := GenerateTags("/home/user/notes.txt", metadata, nil)
+	assert.Equal(t, []string{"file", "writable", "readable", "text", "mime:text/plain", "old", "medium"}, tags)
+
+	tags = GenerateTags("/home/user/.cache", Metadata{NodeType: "directory", Permissions: 0500}, nil)
+	assert.Equal(t, []string{"folder", "readable", "small", "hidden"}, tags)
+
+	rules := compileTagRules([]TagRule{
+		{Tag: "invoice", Pattern: "*invoice*", Extensions: []string{"PDF"}},
+		{Tag: "scanned", Pattern: "/scans/*"},
+		{Tag: "photo", MimeType: "image/"},
+		{Tag: "invalid"},
+	})
+	assert.Len(t, rules, 3, "Expected the rule without predicates to be dropped")
+	assert.Contains(t, GenerateTags("/docs/invoice-2024.pdf", Metadata{NodeType: "file"}, rules), "invoice")
+	assert.NotContains(t, GenerateTags("/docs/invoice-2024.txt", Metadata{NodeType: "file"}, rules), "invoice")
+	assert.Contains(t, GenerateTags("/scans/page.png", Metadata{NodeType: "file", MimeType: "image/png"}, rules), "scanned")
+	assert.Contains(t, GenerateTags("/scans/page.png", Metadata{NodeType: "file", MimeType: "image/png"}, rules), "photo")
+
+	RegisterTagger("test", func(path string, metadata *Metadata) []string { return []string{"custom"} })
+	defer RegisterTagger("test", func(path string, metadata *Metadata) []string { return nil })
+	assert.Contains(t, GenerateTags("/a", Metadata{}, nil), "custom")
+}
+
+func TestOrganizeByTags(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/invoice-2024.pdf": "%PDF",
+		"source/manual.pdf":       "%PDF",
+		"config.toml": `file_types = { "Docs" = [".pdf"] }
+
+[[tag_rules]]
+tag = "invoice"
+pattern = "invoice-*"
+
+[[rules]]
+name = "invoices"
+target = "Finance"
+tags = ["invoice", "document"]
+`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	params := &FilePathParams{SourceDir: source, TargetDir: source, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(source, "Finance", "invoice-2024.pdf"))
+	assert.FileExists(t, filepath.Join(source, "Docs", "manual.pdf"))
+	_, err := os.Stat(filepath.Join(source, "invoice-2024.pdf"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOrganizeByTagsAfterMetadata(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/invoice-2024.pdf": "%PDF",
+		"source/manual.pdf":       "%PDF",
+		"config.toml": `file_types = { "Docs" = [".pdf"] }
+
+[[tag_rules]]
+tag = "invoice"
+pattern = "invoice-*"
+
+[[rules]]
+name = "photos"
+target = "Photos"
+camera = "canon*"
+
+[[rules]]
+name = "invoices"
+target = "Finance"
+tags = ["invoice"]
+`,
+	})
+	defer cleanup()
+
+	// Groups and the EXIF predicates of earlier rules read the metadata of the files before their tags
+	dfs := &DesktopFS{}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	params := &FilePathParams{SourceDir: source, TargetDir: source, KeepGroups: true, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	assert.FileExists(t, filepath.Join(source, "Finance", "invoice-2024.pdf"))
+	assert.FileExists(t, filepath.Join(source, "Docs", "manual.pdf"))
+}
@@ -0,0 +1,484 @@
+package deskfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"desktop-cleaner/internal/db"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextExtractor returns the plain text of a file content. The content is cut after maxTextRead bytes:
+// extractors of formats that must be read whole fail on larger files.
+type TextExtractor func(content []byte) (string, error)
+
+const (
+	maxTextRead      = 32 << 20 // Largest part of a file read for text extraction
+	maxExtractedText = 1 << 20  // Largest text kept for a file, in bytes
+)
+
+const (
+	mimeDocx = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimeXlsx = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mimePptx = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+)
+
+// Text extractors by MIME type, "type/*" extracting the subtypes without their own extractor
+var (
+	textExtractorsMu sync.RWMutex
+	textExtractors   = map[string]TextExtractor{
+		"text/plain":            plainTextExtractor,
+		"text/markdown":         markdownTextExtractor,
+		"text/html":             htmlTextExtractor,
+		"application/xhtml+xml": htmlTextExtractor,
+		"application/pdf":       pdfTextExtractor,
+		mimeDocx:                ooxmlTextExtractor,
+		mimeXlsx:                ooxmlTextExtractor,
+		mimePptx:                ooxmlTextExtractor,
+		"text/*":                plainTextExtractor,
+	}
+)
+
+// textMimeTypes are the MIME types of extensions that are missing from, or detected as a container
+// type by, the system MIME database
+var textMimeTypes = map[string]string{
+	".txt": "text/plain", ".md": "text/markdown", ".markdown": "text/markdown",
+	".htm": "text/html", ".html": "text/html", ".pdf": "application/pdf",
+	".docx": mimeDocx, ".docm": mimeDocx, ".xlsx": mimeXlsx, ".xlsm": mimeXlsx, ".pptx": mimePptx, ".pptm": mimePptx,
+}
+
+// RegisterTextExtractor sets the extractor of a MIME type, or of every subtype of a type with "type/*",
+// replacing the extractor registered for it.
+func RegisterTextExtractor(mimeType string, extractor TextExtractor) {
+	textExtractorsMu.Lock()
+	defer textExtractorsMu.Unlock()
+
+	textExtractors[strings.ToLower(mimeType)] = extractor
+}
+
+// textExtractorFor returns the MIME type of a file, without parameters, and its text extractor if any.
+// recordedType is the MIME type found by the indexer, detected again when empty.
+func textExtractorFor(path, recordedType string) (string, TextExtractor) {
+	mimeType, ok := textMimeTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		if recordedType == "" {
+			recordedType = detectMimeType(path)
+		}
+		mimeType, _, _ = mime.ParseMediaType(recordedType)
+	}
+
+	textExtractorsMu.RLock()
+	defer textExtractorsMu.RUnlock()
+
+	if extractor, ok := textExtractors[mimeType]; ok {
+		return mimeType, extractor
+	}
+	if family, _, ok := strings.Cut(mimeType, "/"); ok {
+		return mimeType, textExtractors[family+"/*"]
+	}
+	return mimeType, nil
+}
+
+// extractText reads up to maxTextRead bytes of a file and extracts its text, reporting whether its MIME
+// type has an extractor. The text is cut after maxExtractedText bytes.
+func extractText(path, recordedType string) (db.CachedText, bool, error) {
+	mimeType, extractor := textExtractorFor(path, recordedType)
+	if extractor == nil {
+		return db.CachedText{MimeType: mimeType}, false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return db.CachedText{}, true, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxTextRead+1))
+	if err != nil {
+		return db.CachedText{}, true, err
+	}
+	truncated := len(content) > maxTextRead
+	if truncated {
+		content = content[:maxTextRead]
+	}
+
+	text, err := extractor(content)
+	if err != nil {
+		return db.CachedText{}, true, fmt.Errorf("failed to extract text of %s: %w", path, err)
+	}
+	if len(text) > maxExtractedText {
+		text = trimPartialRune([]byte(text[:maxExtractedText]))
+		truncated = true
+	}
+	return db.CachedText{MimeType: mimeType, Text: text, Truncated: truncated, ExtractedAt: time.Now()}, true, nil
+}
+
+// TextStats summarizes a text extraction run.
+type TextStats struct {
+	Extracted   int // Files whose text was extracted
+	Cached      int // Files whose content already had a cached text
+	Unsupported int // Files of a type without text extractor
+	Failed      int // Files whose text could not be extracted
+	Pruned      int // Cached texts of contents that are no longer indexed
+}
+
+// textSaveBatch is the number of extracted texts saved at once, bounding the texts held in memory
+const textSaveBatch = 32
+
+// ExtractWorkspaceText extracts the text of the indexed files of a workspace whose content has no cached
+// text yet, and prunes the texts of contents that are no longer indexed.
+func (dfs *DesktopFS) ExtractWorkspaceText(workspaceDB db.WorkspaceStore) (TextStats, error) {
+	var stats TextStats
+	records, err := workspaceDB.ListFiles()
+	if err != nil {
+		return stats, err
+	}
+
+	extracted := make(map[string]bool)
+	var batch []db.CachedText
+	for _, record := range records {
+		if record.Hash == "" {
+			continue
+		}
+		if extracted[record.Hash] {
+			stats.Cached++
+			continue
+		}
+		if _, err := workspaceDB.GetCachedText(record.Hash); err == nil {
+			stats.Cached++
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return stats, err
+		}
+
+		text, supported, err := extractText(record.Path, record.MimeType)
+		switch {
+		case !supported:
+			stats.Unsupported++
+		case err != nil:
+			slog.Warn(fmt.Sprintf("Skipping text of %s: %v\n", record.Path, err))
+			stats.Failed++
+		default:
+			text.Hash = record.Hash
+			extracted[record.Hash] = true
+			batch = append(batch, text)
+			stats.Extracted++
+		}
+
+		if len(batch) >= textSaveBatch {
+			if err := workspaceDB.SaveCachedTexts(batch); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := workspaceDB.SaveCachedTexts(batch); err != nil {
+		return stats, err
+	}
+	stats.Pruned, err = workspaceDB.PruneTextCache()
+	return stats, err
+}
+
+// FileText returns the text of a file, cached in the workspace database by the hash of its content.
+// The file is hashed when it is not indexed or changed since it was.
+func (dfs *DesktopFS) FileText(workspaceDB db.WorkspaceStore, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var hash, mimeType string
+	record, err := workspaceDB.GetFile(path)
+	if err == nil && record.Size == info.Size() && record.ModifiedAt.Equal(info.ModTime()) && record.Hash != "" {
+		hash, mimeType = record.Hash, record.MimeType
+	} else if hash, mimeType, err = hashAndDetect(path); err != nil {
+		return "", err
+	}
+
+	if cached, err := workspaceDB.GetCachedText(hash); err == nil {
+		return cached.Text, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	text, supported, err := extractText(path, mimeType)
+	if err != nil {
+		return "", err
+	}
+	if !supported {
+		return "", fmt.Errorf("no text extractor for %s files", text.MimeType)
+	}
+	text.Hash = hash
+	if err := workspaceDB.SaveCachedTexts([]db.CachedText{text}); err != nil {
+		return "", err
+	}
+	return text.Text, nil
+}
+
+// decodeText decodes text content: UTF-8 or UTF-16 with a byte order mark, UTF-8, UTF-16 detected from
+// its zero bytes, else Windows-1252, a superset of Latin-1.
+func decodeText(content []byte) string {
+	var text string
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		text = strings.ToValidUTF8(string(content[3:]), "�")
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		text = decodeUTF16(content[2:], false)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		text = decodeUTF16(content[2:], true)
+	case utf8.Valid([]byte(trimPartialRune(content))):
+		text = trimPartialRune(content)
+	default:
+		if bigEndian, ok := detectUTF16(content); ok {
+			text = decodeUTF16(content, bigEndian)
+		} else {
+			text = decodeWindows1252(content)
+		}
+	}
+	text = strings.ReplaceAll(text, "\x00", "")
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+}
+
+// trimPartialRune drops the incomplete UTF-8 sequence a cut content may end with.
+func trimPartialRune(content []byte) string {
+	for i := 1; i <= utf8.UTFMax && i <= len(content); i++ {
+		if b := content[len(content)-i]; utf8.RuneStart(b) {
+			if !utf8.FullRune(content[len(content)-i:]) {
+				return string(content[:len(content)-i])
+			}
+			break
+		}
+	}
+	return string(content)
+}
+
+// detectUTF16 recognizes UTF-16 without byte order mark by the zero high bytes of ASCII characters.
+func detectUTF16(content []byte) (bool, bool) {
+	if len(content) < 4 {
+		return false, false
+	}
+	var even, odd int
+	for i, b := range content {
+		if b == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(content) / 2
+	switch {
+	case odd > half*2/5 && even < half/10:
+		return false, true
+	case even > half*2/5 && odd < half/10:
+		return true, true
+	}
+	return false, false
+}
+
+func decodeUTF16(content []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(content)/2)
+	for i := 0; i+1 < len(content); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(content[i])<<8|uint16(content[i+1]))
+		} else {
+			units = append(units, uint16(content[i+1])<<8|uint16(content[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252, which differ from Latin-1
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(content []byte) string {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		if b >= 0x80 && b < 0xA0 {
+			runes[i] = windows1252[b-0x80]
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return string(runes)
+}
+
+var (
+	spaceRuns      = regexp.MustCompile(`[ \t\f\v]+`)
+	blankLineRuns  = regexp.MustCompile(`\n{3,}`)
+	trailingSpaces = regexp.MustCompile(`(?m)^ +| +$`)
+)
+
+// normalizeSpace collapses runs of spaces and of blank lines.
+func normalizeSpace(text string) string {
+	text = spaceRuns.ReplaceAllString(text, " ")
+	text = trailingSpaces.ReplaceAllString(text, "")
+	return strings.TrimSpace(blankLineRuns.ReplaceAllString(text, "\n\n"))
+}
+
+// plainTextExtractor decodes text files
+func plainTextExtractor(content []byte) (string, error) {
+	return decodeText(content), nil
+}
+
+var markdownSyntax = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile("(?m)^[ \\t]*(```|~~~).*$"), ""},                               // Code fences, their code is kept
+	{regexp.MustCompile(`(?m)^[ \t]*\[[^\]]+\]:[ \t]+\S+.*$`), ""},                     // Link definitions
+	{regexp.MustCompile(`(?m)^[ \t]*([-*_][ \t]*){3,}$`), ""},                          // Horizontal rules
+	{regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+(.*?)([ \t]+#+)?[ \t]*$`), "$1"},   // Headings
+	{regexp.MustCompile(`(?m)^[ \t]*>[ \t]?`), ""},                                     // Block quotes
+	{regexp.MustCompile(`(?m)^([ \t]*)([-*+]|\d+[.)])[ \t]+(\[[ xX]\][ \t]+)?`), "$1"}, // List items and task boxes
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},                               // Images
+	{regexp.MustCompile(`\[([^\]]+)\](\([^)]*\)|\[[^\]]*\])`), "$1"},                   // Links
+	{regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`), "$1$2"},                    // Strong emphasis
+	{regexp.MustCompile(`\*([^*\n]+)\*|\b_([^_\n]+)_\b`), "$1$2"},                      // Emphasis
+	{regexp.MustCompile("`([^`\n]+)`"), "$1"},                                          // Inline code
+	{regexp.MustCompile(`<[^>\n]+>`), ""},                                              // Inline HTML
+}
+
+// markdownTextExtractor removes the syntax of Markdown files, keeping the text of links and images
+func markdownTextExtractor(content []byte) (string, error) {
+	text := decodeText(content)
+	for _, syntax := range markdownSyntax {
+		text = syntax.pattern.ReplaceAllString(text, syntax.replace)
+	}
+	return normalizeSpace(text), nil
+}
+
+var (
+	htmlIgnored = []*regexp.Regexp{
+		regexp.MustCompile(`(?s)<!--.*?-->`),
+		regexp.MustCompile(`(?is)<script\b.*?</script\s*>`),
+		regexp.MustCompile(`(?is)<style\b.*?</style\s*>`),
+		regexp.MustCompile(`(?is)<noscript\b.*?</noscript\s*>`),
+		regexp.MustCompile(`(?is)<template\b.*?</template\s*>`),
+	}
+	htmlBlockTags = regexp.MustCompile(`(?i)</?(address|article|aside|blockquote|br|dd|div|dl|dt|figcaption|footer|h[1-6]|header|hr|li|main|nav|ol|p|pre|section|table|title|tr|ul)\b[^>]*>`)
+	htmlCellTags  = regexp.MustCompile(`(?i)</?(td|th)\b[^>]*>`)
+	htmlTags      = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlTextExtractor strips the tags, scripts and styles of HTML files, breaking lines at blocks
+func htmlTextExtractor(content []byte) (string, error) {
+	text := decodeText(content)
+	for _, ignored := range htmlIgnored {
+		text = ignored.ReplaceAllString(text, " ")
+	}
+	// Line breaks of the source are spaces, lines are broken by blocks
+	text = strings.ReplaceAll(text, "\n", " ")
+	text = htmlBlockTags.ReplaceAllString(text, "\n")
+	text = htmlCellTags.ReplaceAllString(text, " ")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(html.UnescapeString(text), "\u00a0", " ")
+	return normalizeSpace(text), nil
+}
+
+var slideNumber = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// ooxmlTextExtractor reads the text of the body of Word documents, the slides of presentations and
+// the shared strings of spreadsheets
+func ooxmlTextExtractor(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid Office document: %w", err)
+	}
+
+	type part struct {
+		file  *zip.File
+		order int
+	}
+	var parts []part
+	for _, file := range archive.File {
+		switch {
+		case file.Name == "word/document.xml", file.Name == "xl/sharedStrings.xml":
+			parts = append(parts, part{file, 0})
+		case slideNumber.MatchString(file.Name):
+			number, _ := strconv.Atoi(slideNumber.FindStringSubmatch(file.Name)[1])
+			parts = append(parts, part{file, number})
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].order < parts[j].order })
+
+	var b strings.Builder
+	for _, part := range parts {
+		if err := ooxmlPartText(part.file, &b); err != nil {
+			return "", err
+		}
+		// The text is truncated by the caller
+		if b.Len() > maxExtractedText {
+			break
+		}
+		b.WriteString("\n\n")
+	}
+	return normalizeSpace(b.String()), nil
+}
+
+// ooxmlPartText writes the text runs of an XML part, breaking lines at paragraphs and shared strings. The
+// part is decoded until more than maxExtractedText bytes of text are written.
+func ooxmlPartText(file *zip.File, b *strings.Builder) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(reader)
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", file.Name, err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p", "si":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(token)
+			}
+		}
+		if b.Len() > maxExtractedText {
+			return nil
+		}
+	}
+}
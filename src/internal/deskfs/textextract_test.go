@@ -0,0 +1,192 @@
+package deskfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"desktop-cleaner/internal/db"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTextPDF returns a PDF of two pages, the first shown with a font whose ToUnicode map remaps its
+// codes, and a compressed content stream for the second
+func buildTextPDF() []byte {
+	cmap := "/CIDInit /ProcSet findresource begin\n1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <0048> <0002> <0069> endbfchar\n1 beginbfrange <0010> <0012> <0061> endbfrange\nendcmap"
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte("BT /F2 12 Tf 72 700 Td [(Second) -300 (page)] TJ 0 -14 Td (\\(done\\)) Tj ET"))
+	writer.Close()
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R /F2 8 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [6 0 R] >>",
+		fmt.Sprintf("<< /Length 0 >>\nstream\n%s\nendstream", "BT /F1 12 Tf 72 720 Td <00010002> Tj 30 0 Td <001000110012> Tj ET"),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String()),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 9 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(cmap), cmap),
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	b.WriteString("trailer\n<< /Size 10 /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestTextExtractors(t *testing.T) {
+	utf16LE := []byte{0xFF, 0xFE}
+	for _, r := range "Grüße" {
+		utf16LE = append(utf16LE, byte(r), byte(r>>8))
+	}
+
+	for name, test := range map[string]struct {
+		content  []byte
+		expected string
+	}{
+		"utf8.txt":   {[]byte("Grüße\r\naus Köln"), "Grüße\naus Köln"},
+		"utf16.txt":  {utf16LE, "Grüße"},
+		"cp1252.txt": {[]byte{'G', 'r', 0xFC, 0xDF, 'e', ' ', 0x80, '5'}, "Grüße €5"},
+		"notes.md": {[]byte("# Title #\n\nSome **bold** and _italic_ text, a [link](http://example.com) and `code`.\n\n- [x] done item\n> quoted snake_case_name\n\n```go\nfmt.Println()\n```\n"),
+			"Title\n\nSome bold and italic text, a link and code.\n\ndone item\nquoted snake_case_name\n\nfmt.Println()"},
+		"page.html": {[]byte("<html><head><title>Invoice</title><style>p { color: red }</style></head>\n<body><script>alert('x')</script><!-- note -->\n<h1>Total:\n42&nbsp;&euro;</h1><p>Due <b>soon</b></p><table><tr><td>A</td><td>B</td></tr></table></body></html>"),
+			"Invoice\n\nTotal: 42 €\n\nDue soon\n\nA B"},
+		"report.docx": {buildOOXMLParts(map[string]string{"word/document.xml": `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">report</w:t></w:r></w:p><w:p><w:r><w:t>Second paragraph</w:t></w:r></w:p></w:body></w:document>`}),
+			"Quarterly report\nSecond paragraph"},
+		"deck.pptx": {buildOOXMLParts(map[string]string{
+			"ppt/slides/slide10.xml": `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>Last</a:t></a:r></a:p></p:sld>`,
+			"ppt/slides/slide2.xml":  `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>First</a:t></a:r></a:p></p:sld>`,
+		}), "First\n\nLast"},
+		"sheet.xlsx": {buildOOXMLParts(map[string]string{"xl/sharedStrings.xml": `<sst xmlns="s"><si><t>Name</t></si><si><r><t>Total</t></r><r><t xml:space="preserve"> due</t></r></si></sst>`}),
+			"Name\nTotal due"},
+		"text.pdf": {buildTextPDF(), "Hi abc\n\nSecond page\n(done)"},
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(path, test.content, 0644))
+
+		text, supported, err := extractText(path, "")
+		assert.NoError(t, err, name)
+		assert.True(t, supported, name)
+		assert.Equal(t, test.expected, text.Text, name)
+		assert.False(t, text.Truncated, name)
+	}
+
+	// Files without extractor, and registered extractors
+	path := filepath.Join(t.TempDir(), "photo.png")
+	assert.NoError(t, os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0644))
+	_, supported, err := extractText(path, "image/png")
+	assert.NoError(t, err)
+	assert.False(t, supported)
+
+	RegisterTextExtractor("image/*", func(content []byte) (string, error) { return "an image", nil })
+	defer func() {
+		textExtractorsMu.Lock()
+		delete(textExtractors, "image/*")
+		textExtractorsMu.Unlock()
+	}()
+	text, supported, err := extractText(path, "image/png")
+	assert.NoError(t, err)
+	assert.True(t, supported)
+	assert.Equal(t, "an image", text.Text)
+	assert.Equal(t, "image/png", text.MimeType)
+
+	// Long texts are cut on a character boundary
+	path = filepath.Join(t.TempDir(), "long.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("a"+strings.Repeat("é", maxExtractedText)), 0644))
+	text, _, err = extractText(path, "")
+	assert.NoError(t, err)
+	assert.True(t, text.Truncated)
+	assert.Len(t, text.Text, maxExtractedText-1)
+
+	// Office documents are decoded until enough text is read, however large their parts
+	path = filepath.Join(t.TempDir(), "long.docx")
+	assert.NoError(t, os.WriteFile(path, buildOOXMLParts(map[string]string{"word/document.xml": `<w:document xmlns:w="w"><!--` +
+		strings.Repeat(" ", maxTextRead) + `--><w:body><w:p><w:r><w:t>` + strings.Repeat("a ", maxExtractedText) + `</w:t></w:r></w:p></w:body></w:document>`}), 0644))
+	text, _, err = extractText(path, "")
+	assert.NoError(t, err)
+	assert.True(t, text.Truncated)
+	assert.Len(t, text.Text, maxExtractedText)
+}
+
+// buildOOXMLParts returns a ZIP archive holding the given parts of an Office document
+func buildOOXMLParts(parts map[string]string) []byte {
+	parts["[Content_Types].xml"] = "<Types/>"
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for name, content := range parts {
+		part, _ := archive.Create(name)
+		part.Write([]byte(content))
+	}
+	archive.Close()
+	return b.Bytes()
+}
+
+func TestExtractWorkspaceText(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"notes.txt":      "meeting notes",
+		"copy/notes.txt": "meeting notes",
+		"readme.md":      "# Read me",
+		"photo.png":      "\x89PNG\r\n\x1a\n",
+	})
+	defer cleanup()
+
+	workspaceDB := db.NewMemoryWorkspaceStore()
+	dfs := &DesktopFS{}
+	_, err := dfs.IndexWorkspace(dir, workspaceDB, false)
+	assert.NoError(t, err)
+
+	// Copies share the text of their content
+	stats, err := dfs.ExtractWorkspaceText(workspaceDB)
+	assert.NoError(t, err)
+	assert.Equal(t, TextStats{Extracted: 2, Cached: 1, Unsupported: 1}, stats)
+
+	record, err := workspaceDB.GetFile(filepath.Join(dir, "readme.md"))
+	assert.NoError(t, err)
+	cached, err := workspaceDB.GetCachedText(record.Hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "Read me", cached.Text)
+	assert.Equal(t, "text/markdown", cached.MimeType)
+
+	// Texts are only extracted again for changed contents, and those of removed contents are dropped
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "readme.md"), []byte("# Changed"), 0644))
+	_, err = dfs.IndexWorkspace(dir, workspaceDB, true)
+	assert.NoError(t, err)
+	stats, err = dfs.ExtractWorkspaceText(workspaceDB)
+	assert.NoError(t, err)
+	assert.Equal(t, TextStats{Extracted: 1, Cached: 2, Unsupported: 1, Pruned: 1}, stats)
+
+	text, err := dfs.FileText(workspaceDB, filepath.Join(dir, "readme.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Changed", text)
+
+	// Files that are not indexed are hashed to find their text
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("fresh"), 0644))
+	text, err = dfs.FileText(workspaceDB, filepath.Join(dir, "new.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "fresh", text)
+	_, err = dfs.FileText(workspaceDB, filepath.Join(dir, "photo.png"))
+	assert.Error(t, err)
+
+	// Texts of more files than a batch are all saved
+	for i := 0; i <= textSaveBatch; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("batch%d.txt", i)), []byte(fmt.Sprintf("batch %d", i)), 0644))
+	}
+	_, err = dfs.IndexWorkspace(dir, workspaceDB, true)
+	assert.NoError(t, err)
+	stats, err = dfs.ExtractWorkspaceText(workspaceDB)
+	assert.NoError(t, err)
+	assert.Equal(t, textSaveBatch+1, stats.Extracted)
+	count, err := workspaceDB.CountCachedTexts()
+	assert.NoError(t, err)
+	assert.Equal(t, textSaveBatch+4, count)
+}
@@ -0,0 +1,568 @@
+package deskfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout of a trash directory as defined by the freedesktop.org Trash specification.
+const (
+	trashFilesDir      = "files"
+	trashInfoDir       = "info"
+	trashInfoExt       = ".trashinfo"
+	trashInfoHeader    = "[Trash Info]"
+	trashDeletionFmt   = "2006-01-02T15:04:05"
+	trashAdminDirName  = ".Trash"
+	trashUserDirPrefix = ".Trash-"
+	trashCleanerKey    = "X-Desktop-Cleaner" // Marks the items trashed by the cleaner, which the spec lets others ignore
+)
+
+// mountPoints lists the mount points searched for per-volume trash directories, replaced in tests.
+var mountPoints = systemMountPoints
+
+// TrashConfig holds the retention policy applied to the items trashed by the cleaner after each organize run.
+type TrashConfig struct {
+	Retention string `toml:"retention"` // Maximum age of trashed items, e.g. "30d"; empty disables
+	MaxSize   string `toml:"max_size"`  // Maximum total size of the trash, e.g. "10GB"; empty disables
+}
+
+// TrashDir is a trash directory containing the files/ and info/ subdirectories.
+type TrashDir struct {
+	Path   string // Absolute path of the trash directory
+	TopDir string // Mount point the trash belongs to, empty for the home trash
+}
+
+// TrashEntry describes a single item that has been moved to a trash directory.
+type TrashEntry struct {
+	Name         string    // Name of the item inside files/ and info/
+	Dir          *TrashDir // Trash directory holding the item
+	OriginalPath string    // Absolute path the item was trashed from
+	DeletionDate time.Time // Time the item was trashed
+	Size         int64     // Size of the item, including directory contents
+	Cleaner      bool      // Whether the item was trashed by the cleaner rather than another application
+}
+
+// ID identifies the item across all trash directories. Items of the home trash are identified by their
+// name, items of per-volume trash directories by their name prefixed with the trash directory, since the
+// same name may be used in several trash directories.
+func (entry *TrashEntry) ID() string {
+	if entry.Dir.TopDir == "" {
+		return entry.Name
+	}
+	return filepath.Join(entry.Dir.Path, entry.Name)
+}
+
+// FilesPath returns the path of the trashed item inside files/.
+func (entry *TrashEntry) FilesPath() string {
+	return filepath.Join(entry.Dir.Path, trashFilesDir, entry.Name)
+}
+
+// InfoPath returns the path of the .trashinfo file describing the item.
+func (entry *TrashEntry) InfoPath() string {
+	return filepath.Join(entry.Dir.Path, trashInfoDir, entry.Name+trashInfoExt)
+}
+
+// HomeTrashDir returns the user's home trash, $XDG_DATA_HOME/Trash.
+func HomeTrashDir() (*TrashDir, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not get user home directory: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return &TrashDir{Path: filepath.Join(dataHome, "Trash")}, nil
+}
+
+// MoveToTrash moves a file or directory to the trash directory matching its mount point
+func (dfs *DesktopFS) MoveToTrash(node *DirectoryNode) error {
+	_, err := dfs.TrashPath(node.Path)
+	return err
+}
+
+// TrashPath moves path into the appropriate trash directory and records where it came from.
+func (dfs *DesktopFS) TrashPath(path string) (*TrashEntry, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", absPath, err)
+	}
+
+	trashDir, err := trashDirFor(absPath, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if absPath == trashDir.Path || strings.HasPrefix(absPath, trashDir.Path+string(os.PathSeparator)) {
+		return nil, fmt.Errorf("refusing to trash %s: path is inside the trash directory", absPath)
+	}
+
+	if err := trashDir.ensure(); err != nil {
+		return nil, err
+	}
+
+	entry := &TrashEntry{
+		Dir:          trashDir,
+		OriginalPath: absPath,
+		DeletionDate: time.Now(),
+		Cleaner:      true,
+	}
+
+	// Reserve a unique name by atomically creating the info file first, as required by the spec
+	base := filepath.Base(absPath)
+	for i := 1; ; i++ {
+		entry.Name = base
+		if i > 1 {
+			ext := filepath.Ext(base)
+			entry.Name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(base, ext), i-1, ext)
+		}
+
+		if _, err := os.Lstat(entry.FilesPath()); err == nil {
+			continue
+		}
+
+		created, err := trashDir.writeInfo(entry)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			break
+		}
+	}
+
+	if err := os.Rename(absPath, entry.FilesPath()); err != nil {
+		os.Remove(entry.InfoPath())
+		return nil, fmt.Errorf("failed to move %s to trash: %w", absPath, err)
+	}
+
+	slog.Debug(fmt.Sprintf("Moved %s to trash as %s\n", absPath, entry.FilesPath()))
+	return entry, nil
+}
+
+// ListTrashDirs returns the home trash and every per-volume trash directory that exists.
+func ListTrashDirs() ([]*TrashDir, error) {
+	home, err := HomeTrashDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []*TrashDir{home}
+	seen := map[string]bool{home.Path: true}
+	uid := strconv.Itoa(os.Getuid())
+
+	for _, topDir := range mountPoints() {
+		candidates := []string{
+			filepath.Join(topDir, trashAdminDirName, uid),
+			filepath.Join(topDir, trashUserDirPrefix+uid),
+		}
+		for _, candidate := range candidates {
+			if seen[candidate] {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(candidate, trashInfoDir)); err == nil && info.IsDir() {
+				dirs = append(dirs, &TrashDir{Path: candidate, TopDir: topDir})
+				seen[candidate] = true
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+// ListTrash returns the entries of every known trash directory, oldest first.
+func ListTrash() ([]*TrashEntry, error) {
+	dirs, err := ListTrashDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*TrashEntry
+	for _, dir := range dirs {
+		dirEntries, err := dir.List()
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Skipping trash directory %s: %v\n", dir.Path, err))
+			continue
+		}
+		entries = append(entries, dirEntries...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletionDate.Before(entries[j].DeletionDate)
+	})
+	return entries, nil
+}
+
+// List reads the .trashinfo files of the trash directory.
+func (trash *TrashDir) List() ([]*TrashEntry, error) {
+	infos, err := os.ReadDir(filepath.Join(trash.Path, trashInfoDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*TrashEntry
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), trashInfoExt) {
+			continue
+		}
+
+		entry, err := trash.readInfo(strings.TrimSuffix(info.Name(), trashInfoExt))
+		if err != nil {
+			slog.Debug(fmt.Sprintf("Skipping invalid trash info %s: %v\n", info.Name(), err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readInfo parses the .trashinfo file of the named item.
+func (trash *TrashDir) readInfo(name string) (*TrashEntry, error) {
+	entry := &TrashEntry{Name: name, Dir: trash}
+
+	file, err := os.Open(entry.InfoPath())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	inSection := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inSection = line == trashInfoHeader
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !inSection || !found {
+			continue
+		}
+
+		switch key {
+		case "Path":
+			path, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %w", value, err)
+			}
+			path = filepath.FromSlash(path)
+			if !filepath.IsAbs(path) && trash.TopDir != "" {
+				path = filepath.Join(trash.TopDir, path)
+			}
+			entry.OriginalPath = path
+		case "DeletionDate":
+			if date, err := time.ParseInLocation(trashDeletionFmt, value, time.Local); err == nil {
+				entry.DeletionDate = date
+			}
+		case trashCleanerKey:
+			entry.Cleaner = value == "true"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if entry.OriginalPath == "" {
+		return nil, fmt.Errorf("missing Path key")
+	}
+
+	if _, err := os.Lstat(entry.FilesPath()); err != nil {
+		return nil, fmt.Errorf("trashed item is missing: %w", err)
+	}
+	entry.Size = pathSize(entry.FilesPath())
+
+	return entry, nil
+}
+
+// RestoreTrashEntry moves a trashed item back to its original location and returns the restored path.
+// An empty path is returned when the item was skipped because of a conflict.
+func (dfs *DesktopFS) RestoreTrashEntry(entry *TrashEntry, conflict ConflictResolutionType) (string, error) {
+	dst := entry.OriginalPath
+
+	if _, err := os.Lstat(dst); err == nil {
+		switch conflict {
+		case Overwrite:
+			// Trash the existing item instead of deleting it so the overwrite stays recoverable
+			if _, err := dfs.TrashPath(dst); err != nil {
+				return "", fmt.Errorf("failed to move existing %s out of the way: %w", dst, err)
+			}
+		case Skip:
+			slog.Info(fmt.Sprintf("Skipping restore of %s: destination exists\n", dst))
+			return "", nil
+		case RenameSuffix:
+			dst = generateUniqueFilename(dst)
+		default:
+			return "", fmt.Errorf("unknown conflict resolution type: %s", conflict)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", filepath.Dir(dst), err)
+	}
+
+	if err := os.Rename(entry.FilesPath(), dst); err != nil {
+		return "", fmt.Errorf("failed to restore %s: %w", entry.Name, err)
+	}
+
+	if err := os.Remove(entry.InfoPath()); err != nil {
+		return "", fmt.Errorf("failed to remove trash info for %s: %w", entry.Name, err)
+	}
+
+	return dst, nil
+}
+
+// PurgeTrashEntry permanently deletes a trashed item and its info file.
+func PurgeTrashEntry(entry *TrashEntry) error {
+	if err := os.RemoveAll(entry.FilesPath()); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", entry.FilesPath(), err)
+	}
+	if err := os.Remove(entry.InfoPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", entry.InfoPath(), err)
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes the items trashed by the cleaner older than olderThan; zero deletes all of
+// them. With all set, the items trashed by other applications are deleted as well.
+func EmptyTrash(olderThan time.Duration, all bool) ([]*TrashEntry, error) {
+	list := cleanerTrash
+	if all {
+		list = ListTrash
+	}
+	entries, err := list()
+	if err != nil {
+		return nil, err
+	}
+	return purgeTrashEntries(entries, olderThan)
+}
+
+// purgeTrashEntries permanently deletes the entries older than olderThan; zero deletes all of them.
+func purgeTrashEntries(entries []*TrashEntry, olderThan time.Duration) ([]*TrashEntry, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var purged []*TrashEntry
+	for _, entry := range entries {
+		if olderThan > 0 && entry.DeletionDate.After(cutoff) {
+			continue
+		}
+		if err := PurgeTrashEntry(entry); err != nil {
+			return purged, err
+		}
+		purged = append(purged, entry)
+	}
+	return purged, nil
+}
+
+// cleanerTrash returns the entries of the trash that were trashed by the cleaner, oldest first.
+func cleanerTrash() ([]*TrashEntry, error) {
+	entries, err := ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []*TrashEntry
+	for _, entry := range entries {
+		if entry.Cleaner {
+			owned = append(owned, entry)
+		}
+	}
+	return owned, nil
+}
+
+// EnforceTrashRetention applies the configured retention age and size cap to the items trashed by the
+// cleaner. Items trashed by other applications are never purged, nor counted towards the size cap.
+func EnforceTrashRetention(cfg TrashConfig) ([]*TrashEntry, error) {
+	if cfg.Retention == "" && cfg.MaxSize == "" {
+		return nil, nil
+	}
+	var purged []*TrashEntry
+
+	if cfg.Retention != "" {
+		maxAge, err := ParseAge(cfg.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trash retention: %w", err)
+		}
+		entries, err := cleanerTrash()
+		if err != nil {
+			return nil, err
+		}
+		expired, err := purgeTrashEntries(entries, maxAge)
+		purged = append(purged, expired...)
+		if err != nil {
+			return purged, err
+		}
+	}
+
+	if cfg.MaxSize != "" {
+		maxSize, err := ParseSize(cfg.MaxSize)
+		if err != nil {
+			return purged, fmt.Errorf("invalid trash max size: %w", err)
+		}
+
+		entries, err := cleanerTrash()
+		if err != nil {
+			return purged, err
+		}
+
+		var total int64
+		for _, entry := range entries {
+			total += entry.Size
+		}
+
+		// Entries are sorted oldest first, so the oldest items are dropped until the cap is met
+		for _, entry := range entries {
+			if total <= maxSize {
+				break
+			}
+			if err := PurgeTrashEntry(entry); err != nil {
+				return purged, err
+			}
+			total -= entry.Size
+			purged = append(purged, entry)
+		}
+	}
+
+	return purged, nil
+}
+
+// ensure creates the trash directory and its files/ and info/ subdirectories.
+func (trash *TrashDir) ensure() error {
+	for _, dir := range []string{trashFilesDir, trashInfoDir} {
+		if err := os.MkdirAll(filepath.Join(trash.Path, dir), 0700); err != nil {
+			return fmt.Errorf("failed to create trash directory %s: %w", trash.Path, err)
+		}
+	}
+	return nil
+}
+
+// writeInfo creates the .trashinfo file for entry. It reports false if the name is already taken.
+func (trash *TrashDir) writeInfo(entry *TrashEntry) (bool, error) {
+	file, err := os.OpenFile(entry.InfoPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create trash info file: %w", err)
+	}
+	defer file.Close()
+
+	// Paths in per-volume trash directories are stored relative to the mount point
+	storedPath := entry.OriginalPath
+	if trash.TopDir != "" {
+		if rel, err := filepath.Rel(trash.TopDir, entry.OriginalPath); err == nil {
+			storedPath = rel
+		}
+	}
+
+	content := fmt.Sprintf("%s\nPath=%s\nDeletionDate=%s\n",
+		trashInfoHeader,
+		(&url.URL{Path: filepath.ToSlash(storedPath)}).EscapedPath(),
+		entry.DeletionDate.Format(trashDeletionFmt),
+	)
+	if entry.Cleaner {
+		content += trashCleanerKey + "=true\n"
+	}
+	if _, err := file.WriteString(content); err != nil {
+		os.Remove(entry.InfoPath())
+		return false, fmt.Errorf("failed to write trash info file: %w", err)
+	}
+	return true, nil
+}
+
+// trashDirFor selects the trash directory for a path: the home trash when the path lives on
+// the same device, otherwise a per-volume trash at the top directory of the path's mount.
+func trashDirFor(absPath string, info os.FileInfo) (*TrashDir, error) {
+	home, err := HomeTrashDir()
+	if err != nil {
+		return nil, err
+	}
+
+	pathDev, _, ok := statIdentity(info)
+	if !ok {
+		return home, nil
+	}
+
+	homeDev, ok := deviceOfNearest(home.Path)
+	if !ok || homeDev == pathDev {
+		return home, nil
+	}
+
+	topDir := mountTopDir(filepath.Dir(absPath), pathDev)
+	uid := strconv.Itoa(os.Getuid())
+
+	// $topdir/.Trash/$uid may only be used if .Trash is a real, sticky directory
+	adminDir := filepath.Join(topDir, trashAdminDirName)
+	if adminInfo, err := os.Lstat(adminDir); err == nil {
+		if adminInfo.IsDir() && adminInfo.Mode()&os.ModeSticky != 0 && adminInfo.Mode()&os.ModeSymlink == 0 {
+			return &TrashDir{Path: filepath.Join(adminDir, uid), TopDir: topDir}, nil
+		}
+		slog.Warn(fmt.Sprintf("Ignoring %s: not a sticky directory\n", adminDir))
+	}
+
+	return &TrashDir{Path: filepath.Join(topDir, trashUserDirPrefix+uid), TopDir: topDir}, nil
+}
+
+// deviceOfNearest returns the device of path, or of its closest existing ancestor.
+func deviceOfNearest(path string) (uint64, bool) {
+	for {
+		if info, err := os.Stat(path); err == nil {
+			dev, _, ok := statIdentity(info)
+			return dev, ok
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
+
+// mountTopDir walks up from dir while the parent directory is still on device dev.
+func mountTopDir(dir string, dev uint64) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		info, err := os.Stat(parent)
+		if err != nil {
+			return dir
+		}
+		if parentDev, _, ok := statIdentity(info); !ok || parentDev != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// pathSize returns the size of a file, or the total size of the files within a directory.
+func pathSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package deskfs
+
+// systemMountPoints is not implemented on this platform, so only the home trash is listed.
+func systemMountPoints() []string {
+	return nil
+}
@@ -0,0 +1,200 @@
+package deskfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// isolateTrash points the home trash to a temporary directory and hides the trash directories of the
+// system mounts, so that tests never list or purge real trashed files. It returns the home data directory.
+func isolateTrash(t *testing.T, mounts ...string) string {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	systemMounts := mountPoints
+	mountPoints = func() []string { return mounts }
+	t.Cleanup(func() { mountPoints = systemMounts })
+	return dataHome
+}
+
+// addForeignTrashEntry trashes a file of size bytes into trash as another application would, at date.
+func addForeignTrashEntry(t *testing.T, trash *TrashDir, name string, size int, date time.Time) {
+	assert.NoError(t, trash.ensure())
+	assert.NoError(t, os.WriteFile(filepath.Join(trash.Path, trashFilesDir, name), make([]byte, size), 0644))
+	info := fmt.Sprintf("%s\nPath=/home/user/%s\nDeletionDate=%s\n", trashInfoHeader, name, date.Format(trashDeletionFmt))
+	assert.NoError(t, os.WriteFile(filepath.Join(trash.Path, trashInfoDir, name+trashInfoExt), []byte(info), 0644))
+}
+
+func TestTrashPath(t *testing.T) {
+	dataHome := isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"a/report.txt": "first",
+		"b/report.txt": "second",
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+
+	first, err := dfs.TrashPath(filepath.Join(dir, "a", "report.txt"))
+	assert.NoError(t, err)
+	second, err := dfs.TrashPath(filepath.Join(dir, "b", "report.txt"))
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, first.Name, second.Name, "Expected same-named files to get unique trash names")
+	assert.False(t, pathExists(filepath.Join(dir, "a", "report.txt")))
+
+	for _, entry := range []*TrashEntry{first, second} {
+		assert.True(t, strings.HasPrefix(entry.FilesPath(), filepath.Join(dataHome, "Trash", "files")))
+		assert.FileExists(t, entry.FilesPath())
+
+		info, err := os.ReadFile(entry.InfoPath())
+		assert.NoError(t, err)
+		assert.Contains(t, string(info), "[Trash Info]")
+		assert.Contains(t, string(info), "Path="+entry.OriginalPath)
+		assert.Contains(t, string(info), "DeletionDate=")
+	}
+
+	content, err := os.ReadFile(second.FilesPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+}
+
+func TestRestoreTrashEntry(t *testing.T) {
+	isolateTrash(t)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"notes.txt": "original",
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{}
+	notesPath := filepath.Join(dir, "notes.txt")
+
+	_, err := dfs.TrashPath(notesPath)
+	assert.NoError(t, err)
+
+	entries, err := ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, notesPath, entries[0].OriginalPath)
+	assert.Equal(t, int64(len("original")), entries[0].Size)
+
+	// A new file at the original path forces the conflict resolution to kick in
+	assert.NoError(t, os.WriteFile(notesPath, []byte("replacement"), 0644))
+
+	restored, err := dfs.RestoreTrashEntry(entries[0], RenameSuffix)
+	assert.NoError(t, err)
+	assert.NotEqual(t, notesPath, restored)
+	assert.FileExists(t, restored)
+	assert.NoFileExists(t, entries[0].InfoPath())
+
+	entries, err = ListTrash()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestEnforceTrashRetention(t *testing.T) {
+	volume := t.TempDir()
+	dataHome := isolateTrash(t, volume)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"old.txt": "0123456789",
+		"new.txt": "0123456789",
+	})
+	defer cleanup()
+
+	// Items trashed by other applications, in the home trash and in the trash of a volume
+	longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local)
+	addForeignTrashEntry(t, &TrashDir{Path: filepath.Join(dataHome, "Trash")}, "photo.jpg", 100, longAgo)
+	addForeignTrashEntry(t, &TrashDir{Path: filepath.Join(volume, trashUserDirPrefix+strconv.Itoa(os.Getuid())), TopDir: volume}, "video.mp4", 100, longAgo)
+
+	dfs := &DesktopFS{}
+	old, err := dfs.TrashPath(filepath.Join(dir, "old.txt"))
+	assert.NoError(t, err)
+	assert.True(t, old.Cleaner)
+	// Deletion dates are stored to the second, so the first item is backdated to be the oldest
+	old.DeletionDate = old.DeletionDate.Add(-time.Hour)
+	assert.NoError(t, os.Remove(old.InfoPath()))
+	_, err = old.Dir.writeInfo(old)
+	assert.NoError(t, err)
+	_, err = dfs.TrashPath(filepath.Join(dir, "new.txt"))
+	assert.NoError(t, err)
+
+	entries, err := ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	// Only the items trashed by the cleaner count towards the cap, and are purged
+	purged, err := EnforceTrashRetention(TrashConfig{MaxSize: "15B"})
+	assert.NoError(t, err)
+	if assert.Len(t, purged, 1) {
+		assert.Equal(t, old.OriginalPath, purged[0].OriginalPath)
+	}
+
+	purged, err = EnforceTrashRetention(TrashConfig{Retention: "1d"})
+	assert.NoError(t, err)
+	assert.Empty(t, purged)
+
+	entries, err = ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, filepath.Base(entry.OriginalPath) == "new.txt", entry.Cleaner, entry.Name)
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	volume := t.TempDir()
+	dataHome := isolateTrash(t, volume)
+
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"report.txt": "0123456789",
+	})
+	defer cleanup()
+
+	// Items of the same name trashed by other applications, in the home trash and in the trash of a volume
+	home := &TrashDir{Path: filepath.Join(dataHome, "Trash")}
+	volumeTrash := &TrashDir{Path: filepath.Join(volume, trashUserDirPrefix+strconv.Itoa(os.Getuid())), TopDir: volume}
+	addForeignTrashEntry(t, home, "photo.jpg", 100, time.Now())
+	addForeignTrashEntry(t, volumeTrash, "photo.jpg", 100, time.Now())
+
+	dfs := &DesktopFS{}
+	_, err := dfs.TrashPath(filepath.Join(dir, "report.txt"))
+	assert.NoError(t, err)
+
+	entries, err := ListTrash()
+	assert.NoError(t, err)
+	ids := map[string]bool{}
+	for _, entry := range entries {
+		ids[entry.ID()] = true
+	}
+	assert.Len(t, ids, 3, "Expected same-named items of different trash directories to get unique IDs")
+	assert.True(t, ids["photo.jpg"])
+	assert.True(t, ids[filepath.Join(volumeTrash.Path, "photo.jpg")])
+
+	// Without all, only the items trashed by the cleaner are deleted
+	purged, err := EmptyTrash(0, false)
+	assert.NoError(t, err)
+	if assert.Len(t, purged, 1) {
+		assert.Equal(t, "report.txt", purged[0].Name)
+	}
+
+	entries, err = ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	purged, err = EmptyTrash(0, true)
+	assert.NoError(t, err)
+	assert.Len(t, purged, 2)
+
+	entries, err = ListTrash()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
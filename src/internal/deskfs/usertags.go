@@ -0,0 +1,519 @@
+package deskfs
+
+import (
+	"database/sql"
+	"desktop-cleaner/internal/db"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// NormalizeTag lowercases a user tag and checks that it can be used in a tag expression.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("empty tag")
+	}
+	if strings.IndexFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' }) >= 0 {
+		return "", fmt.Errorf("invalid tag %q: tags cannot contain spaces or parentheses", tag)
+	}
+	switch strings.ToUpper(tag) {
+	case "AND", "OR", "NOT":
+		return "", fmt.Errorf("invalid tag %q: reserved word", tag)
+	}
+	return tag, nil
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// TagExpr is a boolean query over the tags of a file, e.g. "work AND NOT archived".
+type TagExpr interface {
+	Match(tags map[string]bool) bool
+	String() string
+}
+
+type tagTerm string
+
+func (term tagTerm) Match(tags map[string]bool) bool { return tags[string(term)] }
+func (term tagTerm) String() string                  { return string(term) }
+
+type tagNot struct{ expr TagExpr }
+
+func (not tagNot) Match(tags map[string]bool) bool { return !not.expr.Match(tags) }
+func (not tagNot) String() string                  { return "NOT " + not.expr.String() }
+
+type tagBinary struct {
+	op          string
+	left, right TagExpr
+}
+
+func (binary tagBinary) Match(tags map[string]bool) bool {
+	if binary.op == "AND" {
+		return binary.left.Match(tags) && binary.right.Match(tags)
+	}
+	return binary.left.Match(tags) || binary.right.Match(tags)
+}
+
+func (binary tagBinary) String() string {
+	return "(" + binary.left.String() + " " + binary.op + " " + binary.right.String() + ")"
+}
+
+// ParseTagExpr parses a tag expression made of tags, AND, OR, NOT and parentheses. Operators are
+// case-insensitive; NOT binds tighter than AND, which binds tighter than OR.
+func ParseTagExpr(value string) (TagExpr, error) {
+	parser := &tagExprParser{tokens: tokenizeTagExpr(value)}
+	if len(parser.tokens) == 0 {
+		return nil, fmt.Errorf("empty tag expression")
+	}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := parser.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q in tag expression, expected AND or OR", token)
+	}
+	return expr, nil
+}
+
+func tokenizeTagExpr(value string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range value {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type tagExprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (parser *tagExprParser) peek() (string, bool) {
+	if parser.pos >= len(parser.tokens) {
+		return "", false
+	}
+	return parser.tokens[parser.pos], true
+}
+
+// accept consumes the next token when it is the operator op
+func (parser *tagExprParser) accept(op string) bool {
+	if token, ok := parser.peek(); ok && strings.EqualFold(token, op) {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *tagExprParser) parseOr() (TagExpr, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("OR") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = tagBinary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *tagExprParser) parseAnd() (TagExpr, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("AND") {
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = tagBinary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *tagExprParser) parseNot() (TagExpr, error) {
+	if parser.accept("NOT") {
+		expr, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{expr: expr}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *tagExprParser) parsePrimary() (TagExpr, error) {
+	token, ok := parser.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of tag expression")
+	}
+	if token == "(" {
+		parser.pos++
+		expr, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.accept(")") {
+			return nil, fmt.Errorf("missing ) in tag expression")
+		}
+		return expr, nil
+	}
+	if token == ")" {
+		return nil, fmt.Errorf("unexpected ) in tag expression")
+	}
+
+	tag, err := NormalizeTag(token)
+	if err != nil {
+		return nil, fmt.Errorf("expected a tag, got %q", token)
+	}
+	parser.pos++
+	return tagTerm(tag), nil
+}
+
+// openTagStore opens the store of the workspace containing path, which holds the tags of its files.
+func (dfs *DesktopFS) openTagStore(path string) (db.WorkspaceStore, error) {
+	if dfs.WorkspaceManager == nil {
+		return nil, fmt.Errorf("no workspace manager")
+	}
+	workspaceID, _, err := dfs.WorkspaceManager.FindWorkspaceForPath(path)
+	if err != nil {
+		return nil, err
+	}
+	store, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(workspaceID)
+	return store, err
+}
+
+// lookupTaggedFile returns the tagged file at path, a new one when it has no tags yet. The recorded
+// path and identity of a file found by its identity are updated to the current ones.
+func lookupTaggedFile(store db.WorkspaceStore, path string) (db.TaggedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+	device, inode, _ := statIdentity(info)
+
+	file, err := store.FindTaggedFile(path, inode, device)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.TaggedFile{Path: path, Inode: inode, Device: device, Tags: []string{}}, nil
+	}
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+	file.Path, file.Inode, file.Device = path, inode, device
+	return file, nil
+}
+
+// AddUserTags adds tags to the file or directory at path and returns its tags.
+func (dfs *DesktopFS) AddUserTags(path string, tags []string) (db.TaggedFile, error) {
+	if len(tags) == 0 {
+		return db.TaggedFile{}, fmt.Errorf("no tags to add")
+	}
+	return dfs.updateUserTags(path, tags, true)
+}
+
+// RemoveUserTags removes tags from the file or directory at path, every tag when none are given, and
+// returns its remaining tags.
+func (dfs *DesktopFS) RemoveUserTags(path string, tags []string) (db.TaggedFile, error) {
+	return dfs.updateUserTags(path, tags, false)
+}
+
+func (dfs *DesktopFS) updateUserTags(path string, tags []string, add bool) (db.TaggedFile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+
+	store, err := dfs.openTagStore(path)
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+	defer store.Close()
+
+	file, err := lookupTaggedFile(store, path)
+	if err != nil {
+		return db.TaggedFile{}, err
+	}
+	before := append([]string{}, file.Tags...)
+
+	current := make(map[string]bool, len(file.Tags))
+	for _, tag := range file.Tags {
+		current[tag] = true
+	}
+	if !add && len(tags) == 0 {
+		current = map[string]bool{}
+	}
+	for _, tag := range tags {
+		if add {
+			current[tag] = true
+		} else {
+			delete(current, tag)
+		}
+	}
+	file.Tags = sortedKeys(current)
+
+	if file.ID, err = store.SaveTaggedFile(file); err != nil {
+		return db.TaggedFile{}, err
+	}
+	dfs.mirrorXattrTags(store, file)
+
+	payload := NewHistoryPayload("")
+	payload.AddResult("tag", path, "", nil)
+	payload.Details = map[string]string{"before": strings.Join(before, ","), "after": strings.Join(file.Tags, ",")}
+	dfs.RecordHistory(path, EventTag, payload)
+	return file, nil
+}
+
+// UserTags returns the tagged file at path or, for a directory, the tagged files below it as well.
+func (dfs *DesktopFS) UserTags(path string) ([]db.TaggedFile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := dfs.openTagStore(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	var files []db.TaggedFile
+	file, err := lookupTaggedFile(store, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Tags) > 0 {
+		files = append(files, file)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		tagged, err := dfs.locateTaggedFiles(store)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range tagged {
+			if strings.HasPrefix(candidate.Path, path+string(filepath.Separator)) {
+				files = append(files, candidate)
+			}
+		}
+	}
+	return files, nil
+}
+
+// FindUserTagged returns the files of the workspace containing path whose tags match expr. With
+// generated, the tags generated by the indexer match as well, and indexed files without user tags
+// are considered too.
+func (dfs *DesktopFS) FindUserTagged(path string, expr TagExpr, generated bool) ([]db.TaggedFile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := dfs.openTagStore(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	tagged, err := dfs.locateTaggedFiles(store)
+	if err != nil {
+		return nil, err
+	}
+	candidates := tagged
+	if generated {
+		records, err := store.ListFiles()
+		if err != nil {
+			return nil, err
+		}
+		byPath := make(map[string]int, len(tagged))
+		for i, file := range tagged {
+			byPath[file.Path] = i
+		}
+		for _, record := range records {
+			i, ok := byPath[record.Path]
+			if !ok {
+				i = len(candidates)
+				candidates = append(candidates, db.TaggedFile{Path: record.Path, Inode: record.Inode, Device: record.Device})
+			}
+			candidates[i].Tags = append(candidates[i].Tags, record.Tags...)
+		}
+	}
+
+	var matches []db.TaggedFile
+	for _, file := range candidates {
+		tags := make(map[string]bool, len(file.Tags))
+		for _, tag := range file.Tags {
+			tags[strings.ToLower(tag)] = true
+		}
+		if expr.Match(tags) {
+			file.Tags = sortedKeys(tags)
+			matches = append(matches, file)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, nil
+}
+
+// locateTaggedFiles returns the tagged files of a workspace at their current paths. Files moved since
+// they were tagged are found by their identity in the file index, and their recorded path is updated.
+// Files that cannot be found are left out.
+func (dfs *DesktopFS) locateTaggedFiles(store db.WorkspaceStore) ([]db.TaggedFile, error) {
+	tagged, err := store.ListTaggedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var indexed map[[2]uint64]string
+	located := make([]db.TaggedFile, 0, len(tagged))
+	for _, file := range tagged {
+		if sameIdentity(file.Path, file) {
+			located = append(located, file)
+			continue
+		}
+
+		if indexed == nil {
+			indexed = make(map[[2]uint64]string)
+			records, err := store.ListFiles()
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				if record.Inode != 0 {
+					indexed[[2]uint64{record.Device, record.Inode}] = record.Path
+				}
+			}
+		}
+		path, ok := indexed[[2]uint64{file.Device, file.Inode}]
+		if !ok || file.Inode == 0 || !sameIdentity(path, file) {
+			slog.Warn(fmt.Sprintf("Tagged file %s was not found", file.Path))
+			continue
+		}
+
+		slog.Debug(fmt.Sprintf("Tagged file %s moved to %s\n", file.Path, path))
+		file.Path = path
+		if _, err := store.SaveTaggedFile(file); err != nil {
+			return nil, err
+		}
+		located = append(located, file)
+	}
+	return located, nil
+}
+
+// sameIdentity reports whether path is the tagged file, by its identity when it was recorded
+func sameIdentity(path string, file db.TaggedFile) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if file.Inode == 0 {
+		return true
+	}
+	device, inode, ok := statIdentity(info)
+	return !ok || (device == file.Device && inode == file.Inode)
+}
+
+// relocateUserTags moves the tags of the files and directories moved by a run to their destinations,
+// so that tags survive moves across file systems, which change the identity of the files.
+func (dfs *DesktopFS) relocateUserTags(path string, entries []JournalEntry) {
+	moves := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Op == JournalMove {
+			moves[entry.Source] = entry.Destination
+		}
+	}
+	if len(moves) == 0 || dfs.WorkspaceManager == nil {
+		return
+	}
+
+	workspaceID, _, err := dfs.WorkspaceManager.FindWorkspaceForPath(path)
+	if err != nil {
+		return
+	}
+	store, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(workspaceID)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Failed to relocate tags: %v\n", err))
+		return
+	}
+	defer store.Close()
+
+	tagged, err := store.ListTaggedFiles()
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Failed to relocate tags: %v\n", err))
+		return
+	}
+	for _, file := range tagged {
+		destination, ok := movedPath(file.Path, moves)
+		if !ok {
+			continue
+		}
+		// Moves that failed, or were not undone, leave the file where it was
+		info, err := os.Stat(destination)
+		if err != nil {
+			continue
+		}
+		file.Path = destination
+		file.Device, file.Inode, _ = statIdentity(info)
+		if _, err := store.SaveTaggedFile(file); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to relocate tags of %s: %v\n", destination, err))
+			continue
+		}
+		// Moves across filesystems may not carry extended attributes
+		dfs.mirrorXattrTags(store, file)
+	}
+}
+
+// movedPath returns the destination of path when it, or one of its parent directories, was moved
+func movedPath(path string, moves map[string]string) (string, bool) {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if destination, ok := moves[dir]; ok {
+			return filepath.Join(destination, strings.TrimPrefix(path, dir)), true
+		}
+		if filepath.Dir(dir) == dir {
+			return "", false
+		}
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"work", "work"},
+		{"work AND NOT archived", "(work AND NOT archived)"},
+		{"a or b and c", "(a OR (b AND c))"},
+		{"(a OR b) AND c", "((a OR b) AND c)"},
+		{"NOT NOT Work", "NOT NOT work"},
+	}
+	for _, test := range tests {
+		expr, err := ParseTagExpr(test.expr)
+		if assert.NoError(t, err, test.expr) {
+			assert.Equal(t, test.expected, expr.String(), test.expr)
+		}
+	}
+
+	for _, invalid := range []string{"", "work archived", "work AND", "(work", "work)", "NOT", "AND work"} {
+		_, err := ParseTagExpr(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	expr, err := ParseTagExpr("work AND NOT archived")
+	assert.NoError(t, err)
+	assert.True(t, expr.Match(map[string]bool{"work": true}))
+	assert.False(t, expr.Match(map[string]bool{"work": true, "archived": true}))
+	assert.False(t, expr.Match(map[string]bool{}))
+}
+
+func TestUserTagsFollowMoves(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"source/report.pdf": "%PDF",
+		"source/old.pdf":    "%PDF",
+		"config.toml":       `file_types = { "Docs" = [".pdf"] }`,
+	})
+	defer cleanup()
+
+	dfs := &DesktopFS{WorkspaceManager: NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	dfs.InstanceConfig.CacheDir = t.TempDir()
+
+	source := filepath.Join(dir, "source")
+	_, err := dfs.WorkspaceManager.CreateWorkspace(source, "")
+	assert.NoError(t, err)
+
+	_, err = dfs.AddUserTags(filepath.Join(source, "report.pdf"), []string{"Work"})
+	assert.NoError(t, err)
+	file, err := dfs.AddUserTags(filepath.Join(source, "old.pdf"), []string{"work", "archived"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"archived", "work"}, file.Tags)
+	_, err = dfs.AddUserTags(filepath.Join(source, "old.pdf"), []string{"not"})
+	assert.Error(t, err)
+
+	params := &FilePathParams{SourceDir: source, TargetDir: source, ConflictResolution: RenameSuffix}
+	assert.NoError(t, dfs.EnhancedOrganize(dfs.InstanceConfig, params))
+
+	expr, err := ParseTagExpr("work AND NOT archived")
+	assert.NoError(t, err)
+	matches, err := dfs.FindUserTagged(source, expr, false)
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, filepath.Join(source, "Docs", "report.pdf"), matches[0].Path)
+	}
+
+	// Files moved outside of organize are found by their identity
+	renamed := filepath.Join(source, "Docs", "q3-report.pdf")
+	assert.NoError(t, os.Rename(filepath.Join(source, "Docs", "report.pdf"), renamed))
+	files, err := dfs.UserTags(renamed)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, []string{"work"}, files[0].Tags)
+	}
+	assert.NoError(t, os.Rename(renamed, filepath.Join(source, "Docs", "report.pdf")))
+
+	// Undoing the run takes the tags back
+	journal, err := FindJournal(dfs.InstanceConfig.CacheDir, "")
+	assert.NoError(t, err)
+	_, err = dfs.UndoRun(journal)
+	assert.NoError(t, err)
+	files, err = dfs.UserTags(source)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, filepath.Join(source, "old.pdf"), files[0].Path)
+		assert.Equal(t, filepath.Join(source, "report.pdf"), files[1].Path)
+	}
+
+	file, err = dfs.RemoveUserTags(filepath.Join(source, "old.pdf"), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, file.Tags)
+	matches, err = dfs.FindUserTagged(source, expr, false)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
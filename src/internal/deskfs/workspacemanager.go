@@ -2,27 +2,33 @@ package deskfs
 
 import (
 	"context"
+	"database/sql"
 	"desktop-cleaner/internal/db"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/ZanzyTHEbar/assert-lib"
 )
 
 type WorkspaceManager struct {
-	centralDB     *db.CentralDBProvider
+	centralDB     db.CentralStore
 	AssertHandler *assert.AssertHandler
 }
 
-func NewWorkspaceManager(centralDB *db.CentralDBProvider, assertHandler *assert.AssertHandler) *WorkspaceManager {
+func NewWorkspaceManager(centralDB db.CentralStore, assertHandler *assert.AssertHandler) *WorkspaceManager {
 	return &WorkspaceManager{
 		centralDB:     centralDB,
 		AssertHandler: assertHandler,
 	}
 }
 
+// pinnedWorkspaceSetting is the central setting holding the ID of the workspace pinned with `workspace use`
+const pinnedWorkspaceSetting = "pinned_workspace"
+
 func createWorkspacePath(rootPath string) string {
 	return filepath.Join(rootPath, DefaultConfigName)
 }
@@ -44,7 +50,7 @@ func (wm *WorkspaceManager) CreateWorkspace(rootPath, config string) (int, error
 	}
 
 	// Initialize workspace-specific database
-	workspaceDB, err := db.NewWorkspaceDB(rootPath)
+	workspaceDB, err := wm.centralDB.OpenWorkspaceStore(rootPath)
 	if err != nil {
 		return 0, fmt.Errorf("failed to initialize workspace DB: %v", err)
 	}
@@ -83,10 +89,16 @@ func (wm *WorkspaceManager) DeleteWorkspace(workspaceID int) error {
 		return fmt.Errorf("failed to delete workspace from central DB: %v", err)
 	}
 
-	// Remove the workspace database file
+	// Forget the workspace if it was pinned
+	if pinnedID, err := wm.PinnedWorkspace(); err == nil && pinnedID == workspaceID {
+		if err := wm.UnpinWorkspace(); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to unpin workspace %d: %v\n", workspaceID, err))
+		}
+	}
+
+	// Remove the workspace database file, the stored root path is already the workspace directory
 
 	// Stat the workspace DB file, and if it doesn't exist, return
-	rootPath = createWorkspacePath(rootPath)
 	workspaceDBPath := filepath.Join(rootPath, "workspace.db")
 
 	if _, err := os.Stat(workspaceDBPath); os.IsNotExist(err) {
@@ -100,6 +112,136 @@ func (wm *WorkspaceManager) DeleteWorkspace(workspaceID int) error {
 	return nil
 }
 
+// OpenWorkspaceDB opens the store of a workspace and returns it with the workspace root directory.
+func (wm *WorkspaceManager) OpenWorkspaceDB(workspaceID int) (db.WorkspaceStore, string, error) {
+	workspaceDB, err := db.LoadWorkspaceDBProvider(wm.centralDB, workspaceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	workspacePath, err := wm.centralDB.GetWorkspacePath(workspaceID)
+	if err != nil {
+		workspaceDB.Close()
+		return nil, "", fmt.Errorf("failed to find workspace: %v", err)
+	}
+	return workspaceDB, filepath.Dir(workspacePath), nil
+}
+
+// FindWorkspaceID returns the ID of the workspace rooted at rootPath.
+func (wm *WorkspaceManager) FindWorkspaceID(rootPath string) (int, error) {
+	absPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return 0, err
+	}
+
+	workspaceID, err := wm.centralDB.GetWorkspaceID(createWorkspacePath(absPath))
+	if err != nil {
+		return 0, fmt.Errorf("no workspace found at %s: %v", absPath, err)
+	}
+	return workspaceID, nil
+}
+
+// FindWorkspaceForPath returns the ID and root directory of the innermost workspace containing path.
+func (wm *WorkspaceManager) FindWorkspaceForPath(path string) (int, string, error) {
+	if wm.centralDB == nil {
+		return 0, "", fmt.Errorf("no central database")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for dir := absPath; ; dir = filepath.Dir(dir) {
+		workspacePath := createWorkspacePath(dir)
+		if info, err := os.Stat(workspacePath); err == nil && info.IsDir() {
+			if workspaceID, err := wm.centralDB.GetWorkspaceID(workspacePath); err == nil {
+				return workspaceID, dir, nil
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return 0, "", fmt.Errorf("%s is not inside a workspace", absPath)
+		}
+	}
+}
+
+// ResolveWorkspace returns the ID and root directory of the active workspace for path: the innermost
+// workspace containing it or, outside of any workspace, the workspace pinned with PinWorkspace.
+func (wm *WorkspaceManager) ResolveWorkspace(path string) (int, string, error) {
+	workspaceID, rootDir, err := wm.FindWorkspaceForPath(path)
+	if err == nil {
+		return workspaceID, rootDir, nil
+	}
+
+	pinnedID, pinErr := wm.PinnedWorkspace()
+	if pinErr != nil || pinnedID == 0 {
+		return 0, "", err
+	}
+
+	workspacePath, pinErr := wm.centralDB.GetWorkspacePath(pinnedID)
+	if pinErr != nil {
+		return 0, "", fmt.Errorf("pinned workspace %d not found: %v", pinnedID, pinErr)
+	}
+	return pinnedID, filepath.Dir(workspacePath), nil
+}
+
+// PinnedWorkspace returns the ID of the pinned workspace, or 0 when none is pinned.
+func (wm *WorkspaceManager) PinnedWorkspace() (int, error) {
+	if wm.centralDB == nil {
+		return 0, fmt.Errorf("no central database")
+	}
+
+	value, err := wm.centralDB.GetSetting(pinnedWorkspaceSetting)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read pinned workspace: %v", err)
+	}
+
+	workspaceID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pinned workspace %q: %v", value, err)
+	}
+	return workspaceID, nil
+}
+
+// PinWorkspace makes a workspace the active workspace outside of any workspace directory.
+func (wm *WorkspaceManager) PinWorkspace(workspaceID int) error {
+	exists, err := wm.centralDB.WorkspaceExists(workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to find workspace: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("workspace %d does not exist", workspaceID)
+	}
+
+	if err := wm.centralDB.SetSetting(pinnedWorkspaceSetting, strconv.Itoa(workspaceID)); err != nil {
+		return fmt.Errorf("failed to pin workspace: %v", err)
+	}
+	slog.Debug(fmt.Sprintf("Workspace with ID %d pinned.\n", workspaceID))
+	return nil
+}
+
+func (wm *WorkspaceManager) UnpinWorkspace() error {
+	if err := wm.centralDB.DeleteSetting(pinnedWorkspaceSetting); err != nil {
+		return fmt.Errorf("failed to unpin workspace: %v", err)
+	}
+	return nil
+}
+
+// GetWorkspace returns a registered workspace, with its root directory rather than its data directory.
+func (wm *WorkspaceManager) GetWorkspace(workspaceID int) (db.Workspace, error) {
+	workspacePath, err := wm.centralDB.GetWorkspacePath(workspaceID)
+	if err != nil {
+		return db.Workspace{}, fmt.Errorf("failed to find workspace %d: %v", workspaceID, err)
+	}
+	config, err := wm.centralDB.GetWorkspaceConfig(workspaceID)
+	if err != nil {
+		return db.Workspace{}, fmt.Errorf("failed to read config of workspace %d: %v", workspaceID, err)
+	}
+	return db.Workspace{ID: workspaceID, RootPath: filepath.Dir(workspacePath), Config: config}, nil
+}
+
 func (wm *WorkspaceManager) ListWorkspaces() ([]db.Workspace, error) {
 	workspaces, err := wm.centralDB.ListWorkspaces()
 	if err != nil {
@@ -138,7 +280,9 @@ func Init() error {
 	if err := fs.AddMetadataToTree(directoryTree.Root); err != nil {
 		return fmt.Errorf("failed to add metadata: %w", err)
 	}
-	fs.AddRelationships(fs.DirectoryTree.Root)
+	if err := fs.AddRelationships(fs.DirectoryTree.Root); err != nil {
+		return fmt.Errorf("failed to add relationships: %w", err)
+	}
 
 	// Store metadata in database
 	for path, metadata := range fs.FlattenMetadata(fs.DirectoryTree.Root) {
@@ -0,0 +1,115 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaceManager(t *testing.T) {
+	dir := t.TempDir()
+	wm := NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())
+
+	id, err := wm.CreateWorkspace(dir, "")
+	assert.NoError(t, err)
+	assert.DirExists(t, createWorkspacePath(dir))
+
+	foundID, err := wm.FindWorkspaceID(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, id, foundID)
+
+	store, rootPath, err := wm.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	assert.Equal(t, dir, rootPath)
+	assert.NoError(t, store.UpsertFiles([]db.FileRecord{{Path: "a.txt"}}))
+
+	// Stores persist across opens
+	store, _, err = wm.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	records, err := store.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	assert.NoError(t, wm.DeleteWorkspace(id))
+	workspaces, err := wm.ListWorkspaces()
+	assert.NoError(t, err)
+	assert.Empty(t, workspaces)
+}
+
+func TestResolveWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	wm := NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())
+
+	id, err := wm.CreateWorkspace(dir, "")
+	assert.NoError(t, err)
+
+	// Paths inside the workspace resolve to it
+	foundID, rootDir, err := wm.ResolveWorkspace(filepath.Join(dir, "a", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, id, foundID)
+	assert.Equal(t, dir, rootDir)
+
+	// Paths outside of any workspace only resolve to the pinned workspace
+	_, _, err = wm.ResolveWorkspace(outside)
+	assert.Error(t, err)
+
+	assert.Error(t, wm.PinWorkspace(id+1))
+	assert.NoError(t, wm.PinWorkspace(id))
+	foundID, rootDir, err = wm.ResolveWorkspace(outside)
+	assert.NoError(t, err)
+	assert.Equal(t, id, foundID)
+	assert.Equal(t, dir, rootDir)
+
+	// Deleting the pinned workspace unpins it
+	assert.NoError(t, wm.DeleteWorkspace(id))
+	pinnedID, err := wm.PinnedWorkspace()
+	assert.NoError(t, err)
+	assert.Zero(t, pinnedID)
+}
+
+func TestActivateWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	dfs := &DesktopFS{
+		WorkspaceManager: NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler()),
+		baseConfig: &IntermediateConfig{
+			FileTypes: map[string][]string{"Notes": {".txt"}, "Pics": {".png"}},
+			CacheDir:  "/base/cache",
+			Trash:     TrashConfig{Retention: "30d", MaxSize: "1GB"},
+		},
+	}
+
+	id, err := dfs.WorkspaceManager.CreateWorkspace(dir, `
+cache_dir = "/workspace/cache"
+
+[file_types]
+Notes = [".md"]
+
+[trash]
+retention = "7d"
+`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dfs.ActivateWorkspace(dir))
+	assert.Equal(t, id, dfs.WorkspaceID)
+	assert.Equal(t, dir, dfs.WorkspaceRoot)
+	assert.Equal(t, "/workspace/cache", dfs.InstanceConfig.CacheDir)
+	assert.Equal(t, TrashConfig{Retention: "7d", MaxSize: "1GB"}, dfs.InstanceConfig.Trash)
+
+	// The base config is not modified by the workspace config
+	assert.Equal(t, []string{".txt"}, dfs.baseConfig.FileTypes["Notes"])
+
+	// Leaving the workspace restores the base config
+	assert.NoError(t, dfs.ActivateWorkspace(t.TempDir()))
+	assert.Zero(t, dfs.WorkspaceID)
+	assert.Equal(t, "/base/cache", dfs.InstanceConfig.CacheDir)
+
+	// An invalid workspace config is reported, and the workspace stays active
+	assert.NoError(t, dfs.WorkspaceManager.UpdateWorkspace(id, "cache_dir = "))
+	assert.Error(t, dfs.ActivateWorkspace(dir))
+	assert.Equal(t, id, dfs.WorkspaceID)
+	assert.Equal(t, "/base/cache", dfs.InstanceConfig.CacheDir)
+}
@@ -0,0 +1,50 @@
+package deskfs
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// getXattr returns the value of an extended attribute of the node at path. A missing attribute has an
+// empty value, and filesystems without extended attributes return errXattrUnsupported.
+func getXattr(path, name string) (string, error) {
+	for {
+		size, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			return "", xattrError(err)
+		}
+		if size <= 0 {
+			return "", nil
+		}
+		value := make([]byte, size)
+		size, err = unix.Getxattr(path, name, value)
+		// The attribute grew since its size was read
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return "", xattrError(err)
+		}
+		return string(value[:size]), nil
+	}
+}
+
+// setXattr sets an extended attribute of the node at path, or removes it when value is empty.
+func setXattr(path, name, value string) error {
+	if value == "" {
+		return xattrError(unix.Removexattr(path, name))
+	}
+	return xattrError(unix.Setxattr(path, name, []byte(value), 0))
+}
+
+func xattrError(err error) error {
+	switch {
+	case err == nil, errors.Is(err, unix.ENODATA):
+		return nil
+	case errors.Is(err, unix.ENOTSUP), errors.Is(err, unix.EOPNOTSUPP):
+		return errXattrUnsupported
+	}
+	return fmt.Errorf("extended attribute error: %w", err)
+}
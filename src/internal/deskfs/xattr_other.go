@@ -0,0 +1,13 @@
+//go:build !linux
+
+package deskfs
+
+// getXattr is not supported on this platform.
+func getXattr(path, name string) (string, error) {
+	return "", errXattrUnsupported
+}
+
+// setXattr is not supported on this platform.
+func setXattr(path, name, value string) error {
+	return errXattrUnsupported
+}
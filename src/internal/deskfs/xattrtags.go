@@ -0,0 +1,198 @@
+package deskfs
+
+import (
+	"database/sql"
+	"desktop-cleaner/internal/db"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// xdgTagsXattr is the extended attribute holding the comma-separated tags of a file, as read and
+// written by file managers following the freedesktop.org convention.
+const xdgTagsXattr = "user.xdg.tags"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported")
+
+// UserTagsConfig configures how user tags are stored.
+type UserTagsConfig struct {
+	Xattr *bool `toml:"xattr"` // Mirror user tags into the user.xdg.tags extended attribute of the files; off when unset
+}
+
+// XattrEnabled reports whether user tags are mirrored into extended attributes.
+func (cfg UserTagsConfig) XattrEnabled() bool {
+	return cfg.Xattr != nil && *cfg.Xattr
+}
+
+// xattrTagsEnabled reports whether the loaded config mirrors user tags into extended attributes
+func (dfs *DesktopFS) xattrTagsEnabled() bool {
+	return dfs.InstanceConfig != nil && dfs.InstanceConfig.UserTags.XattrEnabled()
+}
+
+// readXattrTags returns the tags stored in the extended attributes of the node at path, and whether
+// the attribute is set.
+func readXattrTags(path string) ([]string, bool, error) {
+	value, err := getXattr(path, xdgTagsXattr)
+	if err != nil || value == "" {
+		return nil, false, err
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true, nil
+}
+
+// splitXattrTags separates the values of the tags attribute into normalized tags and the foreign values
+// that are not valid tags, which belong to other applications.
+func splitXattrTags(values []string) (tags, foreign []string) {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		normalized, err := NormalizeTag(value)
+		if err != nil {
+			foreign = append(foreign, value)
+			continue
+		}
+		set[normalized] = true
+	}
+	return sortedKeys(set), foreign
+}
+
+// writeXattrTags stores tags in the extended attributes of the node at path, keeping the foreign values
+// of the attribute, and removes the attribute when nothing is left.
+func writeXattrTags(path string, tags []string) error {
+	values, _, err := readXattrTags(path)
+	if err != nil {
+		return err
+	}
+	_, foreign := splitXattrTags(values)
+	return setXattr(path, xdgTagsXattr, strings.Join(append(append([]string{}, tags...), foreign...), ","))
+}
+
+// mirrorXattrTags writes the user tags of a file to its extended attributes when enabled, and records the
+// mirrored tags so that a scan can tell an attribute cleared by the user from one never written. Failures
+// are logged as warnings, the workspace database remains the reference.
+func (dfs *DesktopFS) mirrorXattrTags(store db.WorkspaceStore, file db.TaggedFile) {
+	if !dfs.xattrTagsEnabled() {
+		return
+	}
+	if err := writeXattrTags(file.Path, file.Tags); err != nil {
+		warnXattr(file.Path, err)
+		return
+	}
+	// A file without tags is no longer recorded
+	mirrored := strings.Join(file.Tags, ",")
+	if len(file.Tags) == 0 || file.Xattr == mirrored {
+		return
+	}
+	file.Xattr = mirrored
+	if _, err := store.SaveTaggedFile(file); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to record the mirrored tags of %s: %v", file.Path, err))
+	}
+}
+
+// warnXattrUnsupported limits warnings about filesystems without extended attributes to one per run
+var warnXattrUnsupported sync.Once
+
+func warnXattr(path string, err error) {
+	if errors.Is(err, errXattrUnsupported) {
+		warnXattrUnsupported.Do(func() {
+			slog.Warn(fmt.Sprintf("The filesystem of %s does not support extended attributes, tags are only stored in the workspace", path))
+		})
+		return
+	}
+	slog.Warn(fmt.Sprintf("Failed to sync the tags of %s with its extended attributes: %v", path, err))
+}
+
+// xattrTaggedFile is a scanned file with the values of its tags attribute, none when it is not set
+type xattrTaggedFile struct {
+	inode, device uint64
+	tags          []string
+}
+
+// addXattrTags adds the tags of the extended attributes of a scanned file to its metadata, and keeps
+// them to sync the user tags of the workspace once the scan is done.
+func (s *scanner) addXattrTags(fileNode *FileNode, dev, ino uint64) {
+	if !s.dfs.xattrTagsEnabled() {
+		return
+	}
+	tags, _, err := readXattrTags(fileNode.Path)
+	if err != nil {
+		warnXattr(fileNode.Path, err)
+		return
+	}
+
+	for _, tag := range tags {
+		if !containsString(fileNode.Metadata.Tags, tag) {
+			fileNode.Metadata.Tags = append(fileNode.Metadata.Tags, tag)
+		}
+	}
+	s.xattrTags[fileNode.Path] = xattrTaggedFile{inode: ino, device: dev, tags: tags}
+}
+
+// syncXattrTags reconciles the user tags of the workspace with the extended attributes of the scanned
+// files. An attribute edited since the tags were last mirrored wins, since file managers edit it
+// directly, and an attribute cleared by the user removes the tags of the file; otherwise the tags of
+// the database are written to the file.
+func (dfs *DesktopFS) syncXattrTags(store db.WorkspaceStore, scanned map[string]xattrTaggedFile) error {
+	paths := make([]string, 0, len(scanned))
+	for path := range scanned {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := scanned[path]
+		tags, foreign := splitXattrTags(entry.tags)
+		if len(foreign) > 0 {
+			slog.Debug(fmt.Sprintf("Keeping foreign values of the tags of %s: %s\n", path, strings.Join(foreign, ",")))
+		}
+		value := strings.Join(tags, ",")
+
+		// Files moved since they were tagged are found by their identity
+		file, err := store.FindTaggedFile(path, entry.inode, entry.device)
+		if errors.Is(err, sql.ErrNoRows) {
+			if len(tags) == 0 {
+				continue
+			}
+		} else if err != nil {
+			return err
+		}
+		// A file replacing a tagged file at its path, as editors saving through a rename do, never had the attribute
+		sameFile := file.Inode == 0 || (file.Inode == entry.inode && file.Device == entry.device)
+		changed := file.Path != path || file.Inode != entry.inode || file.Device != entry.device
+
+		switch {
+		case len(tags) == 0 && file.Xattr != "" && sameFile:
+			slog.Debug(fmt.Sprintf("Tags of %s cleared from its extended attributes\n", path))
+			file.Tags, changed = nil, true
+		case len(tags) == 0 || value == file.Xattr:
+			mirrored := strings.Join(file.Tags, ",")
+			if value != mirrored {
+				if err := writeXattrTags(path, file.Tags); err != nil {
+					warnXattr(path, err)
+					continue
+				}
+			}
+			changed = changed || file.Xattr != mirrored
+			file.Xattr = mirrored
+		default:
+			slog.Debug(fmt.Sprintf("Synced tags of %s from its extended attributes: %s\n", path, value))
+			file.Tags, file.Xattr, changed = tags, value, true
+		}
+
+		if !changed {
+			continue
+		}
+		file.Path, file.Inode, file.Device = path, entry.inode, entry.device
+		if _, err := store.SaveTaggedFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package deskfs
+
+import (
+	"desktop-cleaner/internal/db"
+	"path/filepath"
+	"testing"
+
+	assertlib "github.com/ZanzyTHEbar/assert-lib"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestSyncXattrTags(t *testing.T) {
+	dir, cleanup := setupTestDir(t, map[string]string{
+		"report.pdf":  "%PDF",
+		"notes.txt":   "todo",
+		"photo.jpg":   "jpeg",
+		"config.toml": "[user_tags]\nxattr = true\n",
+	})
+	defer cleanup()
+	if err := unix.Setxattr(filepath.Join(dir, "notes.txt"), xdgTagsXattr, []byte("Personal, todo"), 0); err != nil {
+		t.Skipf("Extended attributes are not supported: %v", err)
+	}
+
+	dfs := &DesktopFS{WorkspaceManager: NewWorkspaceManager(db.NewMemoryCentralStore(), assertlib.NewAssertHandler())}
+	dfs.InitConfig(filepath.Join(dir, "config.toml"))
+	id, err := dfs.WorkspaceManager.CreateWorkspace(dir, "")
+	assert.NoError(t, err)
+
+	// Tags added by the user are mirrored into the file
+	_, err = dfs.AddUserTags(filepath.Join(dir, "report.pdf"), []string{"work"})
+	assert.NoError(t, err)
+	tags, ok, err := readXattrTags(filepath.Join(dir, "report.pdf"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"work"}, tags)
+
+	// Tags edited in a file manager win on the next scan, tags only in the database are written out
+	assert.NoError(t, unix.Setxattr(filepath.Join(dir, "report.pdf"), xdgTagsXattr, []byte("work,urgent"), 0))
+	store, _, err := dfs.WorkspaceManager.OpenWorkspaceDB(id)
+	assert.NoError(t, err)
+	_, err = store.SaveTaggedFile(db.TaggedFile{Path: filepath.Join(dir, "photo.jpg"), Tags: []string{"holiday"}})
+	assert.NoError(t, err)
+
+	_, err = dfs.IndexWorkspace(dir, store, false)
+	assert.NoError(t, err)
+
+	files, err := dfs.UserTags(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 3) {
+		assert.Equal(t, []string{"personal", "todo"}, files[0].Tags)
+		assert.Equal(t, []string{"holiday"}, files[1].Tags)
+		assert.Equal(t, []string{"urgent", "work"}, files[2].Tags)
+	}
+	tags, _, err = readXattrTags(filepath.Join(dir, "photo.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"holiday"}, tags)
+
+	record, err := store.GetFile(filepath.Join(dir, "notes.txt"))
+	assert.NoError(t, err)
+	assert.Contains(t, record.Tags, "todo")
+
+	// Values of other applications that are not valid tags are kept when the tags are written
+	assert.NoError(t, unix.Setxattr(filepath.Join(dir, "photo.jpg"), xdgTagsXattr, []byte("holiday,Project (2024)"), 0))
+	_, err = dfs.AddUserTags(filepath.Join(dir, "photo.jpg"), []string{"family"})
+	assert.NoError(t, err)
+	value, err := getXattr(filepath.Join(dir, "photo.jpg"), xdgTagsXattr)
+	assert.NoError(t, err)
+	assert.Equal(t, "family,holiday,Project (2024)", value)
+	value, err = getXattr(filepath.Join(dir, "notes.txt"), xdgTagsXattr)
+	assert.NoError(t, err)
+	assert.Equal(t, "Personal, todo", value)
+
+	// Clearing the attribute in a file manager removes the tags instead of writing them back
+	assert.NoError(t, unix.Removexattr(filepath.Join(dir, "report.pdf"), xdgTagsXattr))
+	_, err = dfs.IndexWorkspace(dir, store, false)
+	assert.NoError(t, err)
+
+	files, err = dfs.UserTags(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, filepath.Join(dir, "notes.txt"), files[0].Path)
+		assert.Equal(t, []string{"family", "holiday"}, files[1].Tags)
+	}
+	_, ok, err = readXattrTags(filepath.Join(dir, "report.pdf"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}